@@ -3,50 +3,72 @@
 # Base URL
 BASE_URL="http://localhost:3000"
 
+# Every API route requires a session token for the matching role
+login() {
+    curl -s -X POST "$BASE_URL/login" \
+        -H "Content-Type: application/x-www-form-urlencoded" \
+        -d "username=$1&password=$2" | sed -n 's/.*"token":"\([^"]*\)".*/\1/p'
+}
+
+STUDENT_TOKEN=$(login johndoe studentpass)
+AGENT_TOKEN=$(login libagent1 libagentpass)
+ADMIN_TOKEN=$(login admin1 adminpass)
+
 # Student Endpoints
 echo "Testing Student Endpoints..."
 
 echo "1. GET /student/resources"
-curl -X GET "$BASE_URL/student/resources" -H "Content-Type: application/json"
+curl -X GET "$BASE_URL/student/resources" -H "Content-Type: application/json" \
+    -H "Authorization: $STUDENT_TOKEN"
 echo -e "\n"
 
-echo "2. POST /student/loans"
-curl -X POST "$BASE_URL/student/loans" \
-    -H "Content-Type: application/x-www-form-urlencoded" \
-    -d "student_id=1"
+echo "2. GET /student/me/loans"
+curl -X GET "$BASE_URL/student/me/loans" \
+    -H "Authorization: $STUDENT_TOKEN"
+echo -e "\n"
+
+echo "3. GET /student/me/profile"
+curl -X GET "$BASE_URL/student/me/profile" \
+    -H "Authorization: $STUDENT_TOKEN"
 echo -e "\n"
 
-echo "3. PATCH /student/update-password"
-curl -X PATCH "$BASE_URL/student/update-password" \
+echo "4. PATCH /student/me/password"
+curl -X PATCH "$BASE_URL/student/me/password" \
+    -H "Authorization: $STUDENT_TOKEN" \
     -H "Content-Type: application/x-www-form-urlencoded" \
-    -d "old_password=studentpasss&new_password=newpass&student_id=1"
+    -d "old_password=studentpasss&new_password=newpass"
 echo -e "\n"
 
-echo "3. PATCH /student/update-password"
-curl -X PATCH "$BASE_URL/student/update-password" \
+echo "4. PATCH /student/me/password"
+curl -X PATCH "$BASE_URL/student/me/password" \
+    -H "Authorization: $STUDENT_TOKEN" \
     -H "Content-Type: application/x-www-form-urlencoded" \
-    -d "old_password=studentpass&new_password=newpass&student_id=1"
+    -d "old_password=studentpass&new_password=newpass"
 echo -e "\n"
 
 # Library Agent Endpoints
 echo "Testing Library Agent Endpoints..."
 
 echo "4. GET /library-agent/overdue-loans"
-curl -X GET "$BASE_URL/library-agent/overdue-loans" -H "Content-Type: application/json"
+curl -X GET "$BASE_URL/library-agent/overdue-loans" -H "Content-Type: application/json" \
+    -H "Authorization: $AGENT_TOKEN"
 echo -e "\n"
 
 echo "5. POST /library-agent/return-resource"
 curl -X POST "$BASE_URL/library-agent/return-resource" \
+    -H "Authorization: $AGENT_TOKEN" \
     -H "Content-Type: application/x-www-form-urlencoded" \
     -d "loan_id=1"
 echo -e "\n"
 
 echo "6. GET /library-agent/student-profile/:student_id"
-curl -X GET "$BASE_URL/library-agent/student-profile/3" -H "Content-Type: application/json"
+curl -X GET "$BASE_URL/library-agent/student-profile/3" -H "Content-Type: application/json" \
+    -H "Authorization: $AGENT_TOKEN"
 echo -e "\n"
 
 echo "7. POST /library-agent/assign-resource"
 curl -X POST "$BASE_URL/library-agent/assign-resource" \
+    -H "Authorization: $AGENT_TOKEN" \
     -H "Content-Type: application/x-www-form-urlencoded" \
     -d "student_id=1&book_code=978-3-16-148410-0&loan_duration_days=15"
 echo -e "\n"
@@ -56,22 +78,26 @@ echo "Testing Admin Endpoints..."
 
 echo "8. POST /admin/create-student"
 curl -X POST "$BASE_URL/admin/create-student" \
+    -H "Authorization: $ADMIN_TOKEN" \
     -H "Content-Type: application/x-www-form-urlencoded" \
     -d "first_name=John&last_name=Doe&email=john.doe2@example.com&phone=1234567891&postal_address=123 Elm Street"
 echo -e "\n"
 
 echo "9. PATCH /admin/activate-card"
 curl -X PATCH "$BASE_URL/admin/activate-card" \
+    -H "Authorization: $ADMIN_TOKEN" \
     -H "Content-Type: application/x-www-form-urlencoded" \
-    -d "student_id=1"
+    -d "student_id=1&reason=card returned to desk"
 echo -e "\n"
 
 echo "10. POST /admin/add-resource"
+# location 2 is "Main library, Rack 1", created from the seeded rack numbers.
 curl -X POST "$BASE_URL/admin/add-resource" \
+    -H "Authorization: $ADMIN_TOKEN" \
     -H "Content-Type: application/x-www-form-urlencoded" \
     --data-urlencode "book_code=978-3-16-148410-0" \
     --data-urlencode "barcode=BC005" \
-    --data-urlencode "rack=1" \
+    --data-urlencode "location_id=2" \
     --data-urlencode "price=29.99" \
     --data-urlencode "purchase_date=2023-05-01"
 echo -e "\n"
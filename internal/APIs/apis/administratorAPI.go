@@ -2,7 +2,13 @@ package apis
 
 import (
 	"db_project2/internal/services/subservices"
+	"encoding/csv"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,6 +28,12 @@ func InitAdministratorAPI(router *gin.Engine, adminService *subservices.Administ
 		adminRoutes.POST("/create-student", handler.CreateStudent)
 		adminRoutes.PATCH("/activate-card", handler.ActivateCard)
 		adminRoutes.POST("/add-resource", handler.AddResource)
+		adminRoutes.POST("/students/import", handler.ImportStudents)
+		adminRoutes.PATCH("/students/:student_id", handler.UpdateStudent)
+		adminRoutes.POST("/students/:student_id/deactivate", handler.DeactivateStudent)
+		adminRoutes.POST("/students/:student_id/reactivate", handler.ReactivateStudent)
+		adminRoutes.POST("/students/:student_id/archive", handler.ArchiveStudent)
+		adminRoutes.DELETE("/students/:student_id", handler.DeleteStudent)
 	}
 }
 
@@ -41,7 +53,8 @@ func (h *AdminHandler) CreateStudent(c *gin.Context) {
 	}
 
 
-	err := h.administratorService.CreateStudentWithCard(
+	account, err := h.administratorService.CreateStudentWithCard(
+		actorFromContext(c),
 		reqData.FirstName,
 		reqData.LastName,
 		reqData.Email,
@@ -53,12 +66,15 @@ func (h *AdminHandler) CreateStudent(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Student created successfully"})
+	c.JSON(http.StatusCreated, gin.H{"message": "Student created successfully", "account": account})
 }
 
+// ActivateCard activates the student's current card. It used to toggle the
+// status; use /admin/cards/:card_id for the other transitions.
 func (h *AdminHandler) ActivateCard(c *gin.Context) {
 	var reqData struct {
-		StudentID int `form:"student_id" binding:"required"`
+		StudentID int    `form:"student_id" binding:"required"`
+		Reason    string `form:"reason" binding:"required"`
 	}
 
 
@@ -68,19 +84,19 @@ func (h *AdminHandler) ActivateCard(c *gin.Context) {
 	}
 
 
-	err := h.administratorService.ActivateCard(reqData.StudentID)
+	card, err := h.administratorService.ActivateCard(actorFromContext(c), reqData.StudentID, reqData.Reason)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update card status", "details": err.Error()})
+		respondCardError(c, "Failed to update card status", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Card status updated successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Card status updated successfully", "card": card})
 }
 
 func (h *AdminHandler) AddResource(c *gin.Context) {
 	var reqData struct {
 		BookCode     string  `form:"book_code" binding:"required"`   
-		Rack         string  `form:"rack" binding:"required"`       
+		LocationID   int     `form:"location_id" binding:"required"`
 		Barcode      string  `form:"barcode" binding:"required"`    
 		Price        float64 `form:"price" binding:"required"`      
 		PurchaseDate string  `form:"purchase_date" binding:"required"` 
@@ -92,16 +108,218 @@ func (h *AdminHandler) AddResource(c *gin.Context) {
 	}
 
 	err := h.administratorService.AddResource(
+		actorFromContext(c),
 		reqData.BookCode,
-		reqData.Rack,
+		reqData.LocationID,
 		reqData.Barcode,
 		reqData.Price,
 		reqData.PurchaseDate,
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add resource", "details": err.Error()})
+		respondCatalogError(c, "Failed to add resource", err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"message": "Resource added successfully"})
 }
+
+func (h *AdminHandler) UpdateStudent(c *gin.Context) {
+	studentID, ok := adminStudentID(c)
+	if !ok {
+		return
+	}
+
+	var reqData struct {
+		FirstName     string `form:"first_name"`
+		LastName      string `form:"last_name"`
+		Email         string `form:"email" binding:"omitempty,email"`
+		Phone         string `form:"phone"`
+		PostalAddress string `form:"postal_address"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	student, err := h.administratorService.UpdateStudent(actorFromContext(c), studentID, subservices.StudentInput{
+		FirstName:     reqData.FirstName,
+		LastName:      reqData.LastName,
+		Email:         reqData.Email,
+		Phone:         reqData.Phone,
+		PostalAddress: reqData.PostalAddress,
+	})
+	if err != nil {
+		respondStudentError(c, "Failed to update student", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Student updated successfully", "student": student})
+}
+
+func (h *AdminHandler) DeactivateStudent(c *gin.Context) {
+	h.setStudentActive(c, false)
+}
+
+func (h *AdminHandler) ReactivateStudent(c *gin.Context) {
+	h.setStudentActive(c, true)
+}
+
+func (h *AdminHandler) setStudentActive(c *gin.Context, active bool) {
+	studentID, ok := adminStudentID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.administratorService.SetStudentActive(actorFromContext(c), studentID, active); err != nil {
+		respondStudentError(c, "Failed to update student status", err)
+		return
+	}
+
+	message := "Student deactivated successfully"
+	if active {
+		message = "Student reactivated successfully"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+func (h *AdminHandler) ArchiveStudent(c *gin.Context) {
+	studentID, ok := adminStudentID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.administratorService.ArchiveStudent(actorFromContext(c), studentID); err != nil {
+		respondStudentError(c, "Failed to archive student", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Student archived successfully"})
+}
+
+func (h *AdminHandler) DeleteStudent(c *gin.Context) {
+	studentID, ok := adminStudentID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.administratorService.DeleteStudent(actorFromContext(c), studentID); err != nil {
+		respondStudentError(c, "Failed to delete student", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Student deleted successfully"})
+}
+
+func adminStudentID(c *gin.Context) (int, bool) {
+	studentID, err := strconv.Atoi(c.Param("student_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+		return 0, false
+	}
+	return studentID, true
+}
+
+func respondStudentError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, subservices.ErrStudentNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, subservices.ErrStudentArchived), errors.Is(err, subservices.ErrStudentHasOpenLoans),
+		errors.Is(err, subservices.ErrStudentContactTaken):
+		status = http.StatusConflict
+	case errors.Is(err, subservices.ErrInvalidStudentField):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": message, "details": err.Error()})
+}
+
+// importMaxUploadSize bounds the CSV upload; importMaxRows in the service
+// caps the row count.
+const importMaxUploadSize = 5 << 20
+
+// ImportStudents takes a multipart "file" upload. dry_run defaults to true,
+// so rows are only created when the caller explicitly sends dry_run=false.
+// With format=csv the report is returned as a downloadable file holding the
+// generated usernames and temporary passwords.
+func (h *AdminHandler) ImportStudents(c *gin.Context) {
+	var reqData struct {
+		DryRun *bool  `form:"dry_run"`
+		Format string `form:"format"`
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, importMaxUploadSize)
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+	dryRun := reqData.DryRun == nil || *reqData.DryRun
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": "a CSV file is required in the file field"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload", "details": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	report, err := h.administratorService.ImportStudents(actorFromContext(c), file, dryRun)
+	if err != nil && report == nil {
+		if errors.Is(err, subservices.ErrInvalidImportFile) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to import students", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import students", "details": err.Error()})
+		return
+	}
+
+	// A partial import still returns the report: the students it lists as
+	// created exist and their temporary passwords are shown only here.
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusInternalServerError
+	}
+
+	if reqData.Format == "csv" {
+		writeImportReportCSV(c, status, report)
+		return
+	}
+
+	if err != nil {
+		c.JSON(status, gin.H{"error": "Import stopped before finishing", "details": err.Error(), "report": report})
+		return
+	}
+	c.JSON(status, report)
+}
+
+func writeImportReportCSV(c *gin.Context, status int, report *subservices.ImportReport) {
+	filename := fmt.Sprintf("student-import-%s.csv", time.Now().Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	c.Writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"row", "status", "email", "student_id", "username", "temporary_password", "errors"})
+	for _, row := range report.Rows {
+		studentID := ""
+		if row.StudentID != 0 {
+			studentID = strconv.Itoa(row.StudentID)
+		}
+		writer.Write([]string{
+			strconv.Itoa(row.Row),
+			row.Status,
+			row.Email,
+			studentID,
+			row.Username,
+			row.TemporaryPassword,
+			strings.Join(row.Errors, "; "),
+		})
+	}
+	writer.Flush()
+}
@@ -0,0 +1,127 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	apiKeyService *subservices.APIKeyService
+}
+
+func NewAPIKeyHandler(service *subservices.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: service}
+}
+
+func InitAPIKeyAPI(router *gin.Engine, apiKeyService *subservices.APIKeyService) {
+	handler := NewAPIKeyHandler(apiKeyService)
+	apiKeyRoutes := router.Group("/admin/api-keys")
+	{
+		apiKeyRoutes.GET("", handler.ListKeys)
+		apiKeyRoutes.POST("", handler.CreateKey)
+		apiKeyRoutes.POST("/:key_id/rotate", handler.RotateKey)
+		apiKeyRoutes.DELETE("/:key_id", handler.RevokeKey)
+	}
+}
+
+func (h *APIKeyHandler) ListKeys(c *gin.Context) {
+	keys, err := h.apiKeyService.ListKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys, "available_scopes": subservices.APIKeyScopes})
+}
+
+// CreateKey accepts scopes and allowed_ips either as repeated form values or
+// comma-separated. expires_at is optional, as RFC 3339 or a plain date.
+func (h *APIKeyHandler) CreateKey(c *gin.Context) {
+	var reqData struct {
+		Name       string   `form:"name" binding:"required"`
+		Scopes     []string `form:"scopes" binding:"required"`
+		AllowedIPs []string `form:"allowed_ips"`
+		ExpiresAt  string   `form:"expires_at"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	var expiresAt *time.Time
+	if reqData.ExpiresAt != "" {
+		parsed, err := time.Parse(time.RFC3339, reqData.ExpiresAt)
+		if err != nil {
+			parsed, err = time.ParseInLocation("2006-01-02", reqData.ExpiresAt, time.Local)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": "expires_at must be RFC 3339 or YYYY-MM-DD"})
+			return
+		}
+		expiresAt = &parsed
+	}
+
+	key, err := h.apiKeyService.CreateKey(actorFromContext(c), reqData.Name, reqData.Scopes, expiresAt, reqData.AllowedIPs)
+	if err != nil {
+		respondAPIKeyError(c, "Failed to create API key", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "API key created; store it now, it is not shown again", "api_key": key})
+}
+
+func (h *APIKeyHandler) RotateKey(c *gin.Context) {
+	keyID, ok := apiKeyID(c)
+	if !ok {
+		return
+	}
+
+	key, err := h.apiKeyService.RotateKey(actorFromContext(c), keyID)
+	if err != nil {
+		respondAPIKeyError(c, "Failed to rotate API key", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key rotated; store it now, it is not shown again", "api_key": key})
+}
+
+func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
+	keyID, ok := apiKeyID(c)
+	if !ok {
+		return
+	}
+
+	err := h.apiKeyService.RevokeKey(actorFromContext(c), keyID)
+	if err != nil {
+		respondAPIKeyError(c, "Failed to revoke API key", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
+
+func apiKeyID(c *gin.Context) (int, bool) {
+	keyID, err := strconv.Atoi(c.Param("key_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key ID"})
+		return 0, false
+	}
+	return keyID, true
+}
+
+func respondAPIKeyError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, subservices.ErrAPIKeyNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, subservices.ErrInvalidScope), errors.Is(err, subservices.ErrInvalidIPFilter), errors.Is(err, subservices.ErrInvalidExpiry):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": message, "details": err.Error()})
+}
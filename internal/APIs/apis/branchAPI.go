@@ -0,0 +1,149 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BranchHandler struct {
+	administratorService *subservices.AdministratorService
+}
+
+func NewBranchHandler(service *subservices.AdministratorService) *BranchHandler {
+	return &BranchHandler{administratorService: service}
+}
+
+func InitBranchAPI(router *gin.Engine, adminService *subservices.AdministratorService) {
+	handler := NewBranchHandler(adminService)
+	branchRoutes := router.Group("/admin/branches")
+	{
+		branchRoutes.GET("", handler.ListBranches)
+		branchRoutes.POST("", handler.CreateBranch)
+		branchRoutes.GET("/:branch_id", handler.GetBranch)
+		branchRoutes.PATCH("/:branch_id", handler.UpdateBranch)
+		branchRoutes.PUT("/:branch_id/hours", handler.SetHours)
+	}
+}
+
+func (h *BranchHandler) ListBranches(c *gin.Context) {
+	branches, err := h.administratorService.ListBranches()
+	if err != nil {
+		respondBranchError(c, "Failed to list branches", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"branches": branches})
+}
+
+func (h *BranchHandler) GetBranch(c *gin.Context) {
+	branchID, ok := libraryBranchID(c)
+	if !ok {
+		return
+	}
+
+	branch, err := h.administratorService.GetBranch(branchID)
+	if err != nil {
+		respondBranchError(c, "Failed to fetch branch", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"branch": branch})
+}
+
+func (h *BranchHandler) CreateBranch(c *gin.Context) {
+	var reqData struct {
+		Name    string `form:"name" json:"name" binding:"required"`
+		Address string `form:"address" json:"address"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	branch, err := h.administratorService.CreateBranch(actorFromContext(c), reqData.Name, reqData.Address)
+	if err != nil {
+		respondBranchError(c, "Failed to create branch", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Branch created successfully", "branch": branch})
+}
+
+func (h *BranchHandler) UpdateBranch(c *gin.Context) {
+	branchID, ok := libraryBranchID(c)
+	if !ok {
+		return
+	}
+
+	var reqData struct {
+		Name    string `form:"name" json:"name"`
+		Address string `form:"address" json:"address"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	branch, err := h.administratorService.UpdateBranch(actorFromContext(c), branchID, reqData.Name, reqData.Address)
+	if err != nil {
+		respondBranchError(c, "Failed to update branch", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Branch updated successfully", "branch": branch})
+}
+
+// SetHours replaces the opening week with JSON
+// {"hours": [{"weekday": 1, "opens_at": "09:00", "closes_at": "18:00"}]};
+// weekdays left out are closed.
+func (h *BranchHandler) SetHours(c *gin.Context) {
+	branchID, ok := libraryBranchID(c)
+	if !ok {
+		return
+	}
+
+	var reqData struct {
+		Hours []subservices.BranchHours `json:"hours"`
+	}
+
+	if err := c.ShouldBindJSON(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	branch, err := h.administratorService.SetBranchHours(actorFromContext(c), branchID, reqData.Hours)
+	if err != nil {
+		respondBranchError(c, "Failed to set opening hours", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Opening hours updated successfully", "branch": branch})
+}
+
+func libraryBranchID(c *gin.Context) (int, bool) {
+	branchID, err := strconv.Atoi(c.Param("branch_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid branch ID"})
+		return 0, false
+	}
+	return branchID, true
+}
+
+func respondBranchError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, subservices.ErrBranchNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, subservices.ErrBranchExists):
+		status = http.StatusConflict
+	case errors.Is(err, subservices.ErrInvalidBranch):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": message, "details": err.Error()})
+}
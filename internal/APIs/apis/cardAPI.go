@@ -0,0 +1,146 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CardHandler struct {
+	administratorService *subservices.AdministratorService
+}
+
+func NewCardHandler(service *subservices.AdministratorService) *CardHandler {
+	return &CardHandler{administratorService: service}
+}
+
+func InitCardAPI(router *gin.Engine, adminService *subservices.AdministratorService) {
+	handler := NewCardHandler(adminService)
+	cardRoutes := router.Group("/admin/cards")
+	{
+		cardRoutes.GET("/:card_id", handler.GetCard)
+		cardRoutes.POST("/:card_id/activate", handler.statusChange(subservices.CardActive))
+		cardRoutes.POST("/:card_id/suspend", handler.statusChange(subservices.CardSuspended))
+		cardRoutes.POST("/:card_id/block", handler.statusChange(subservices.CardBlocked))
+		cardRoutes.POST("/:card_id/expire", handler.statusChange(subservices.CardExpired))
+		cardRoutes.POST("/:card_id/renew", handler.RenewCard)
+		cardRoutes.POST("/:card_id/replace", handler.ReplaceLostCard)
+	}
+}
+
+func (h *CardHandler) GetCard(c *gin.Context) {
+	cardID, ok := libraryCardID(c)
+	if !ok {
+		return
+	}
+
+	card, history, err := h.administratorService.GetCard(cardID)
+	if err != nil {
+		respondCardError(c, "Failed to fetch library card", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"card": card, "history": history})
+}
+
+// statusChange returns the handler for one explicit card transition.
+func (h *CardHandler) statusChange(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cardID, ok := libraryCardID(c)
+		if !ok {
+			return
+		}
+
+		var reqData struct {
+			Reason string `form:"reason" binding:"required"`
+		}
+
+		if err := c.ShouldBind(&reqData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+			return
+		}
+
+		card, err := h.administratorService.ChangeCardStatus(actorFromContext(c), cardID, status, reqData.Reason)
+		if err != nil {
+			respondCardError(c, "Failed to update card status", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Card status updated successfully", "card": card})
+	}
+}
+
+func (h *CardHandler) RenewCard(c *gin.Context) {
+	cardID, ok := libraryCardID(c)
+	if !ok {
+		return
+	}
+
+	var reqData struct {
+		Reason string `form:"reason"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	card, err := h.administratorService.RenewCard(actorFromContext(c), cardID, reqData.Reason)
+	if err != nil {
+		respondCardError(c, "Failed to renew library card", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Card renewed successfully", "card": card})
+}
+
+// ReplaceLostCard invalidates a lost card and returns its replacement with
+// the new card number to print.
+func (h *CardHandler) ReplaceLostCard(c *gin.Context) {
+	cardID, ok := libraryCardID(c)
+	if !ok {
+		return
+	}
+
+	var reqData struct {
+		Reason string `form:"reason"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	card, err := h.administratorService.ReplaceLostCard(actorFromContext(c), cardID, reqData.Reason)
+	if err != nil {
+		respondCardError(c, "Failed to replace library card", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Replacement card issued successfully", "card": card})
+}
+
+func libraryCardID(c *gin.Context) (int, bool) {
+	cardID, err := strconv.Atoi(c.Param("card_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid card ID"})
+		return 0, false
+	}
+	return cardID, true
+}
+
+func respondCardError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, subservices.ErrCardNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, subservices.ErrInvalidCardTransition):
+		status = http.StatusConflict
+	case errors.Is(err, subservices.ErrCardReasonRequired), errors.Is(err, subservices.ErrInvalidCardNumber):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": message, "details": err.Error()})
+}
@@ -0,0 +1,174 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CatalogHandler struct {
+	catalogService *subservices.CatalogService
+}
+
+func NewCatalogHandler(service *subservices.CatalogService) *CatalogHandler {
+	return &CatalogHandler{catalogService: service}
+}
+
+func InitCatalogAPI(router *gin.Engine, catalogService *subservices.CatalogService) {
+	handler := NewCatalogHandler(catalogService)
+	bookRoutes := router.Group("/admin/books")
+	{
+		bookRoutes.GET("", handler.ListBooks)
+		bookRoutes.POST("", handler.CreateBook)
+		bookRoutes.POST("/import", handler.ImportMARC)
+		bookRoutes.GET("/:book_code", handler.GetBook)
+		bookRoutes.PUT("/:book_code", handler.UpdateBook)
+		bookRoutes.DELETE("/:book_code", handler.DeleteBook)
+	}
+}
+
+// bookRequest accepts either a form (repeat authors, publishers, ... once
+// per value) or a JSON body with arrays.
+type bookRequest struct {
+	BookCode   string   `form:"book_code" json:"book_code"`
+	Title      string   `form:"title" json:"title" binding:"required"`
+	Pages      *int     `form:"pages" json:"pages"`
+	CallNumber string   `form:"call_number" json:"call_number"`
+	AuthorIDs  []int    `form:"author_ids" json:"author_ids"`
+	Authors    []string `form:"authors" json:"authors"`
+	Publishers []string `form:"publishers" json:"publishers"`
+	Subjects   []string `form:"subjects" json:"subjects"`
+	Languages  []string `form:"languages" json:"languages"`
+}
+
+func (r bookRequest) input() subservices.BookInput {
+	return subservices.BookInput{
+		BookCode:   r.BookCode,
+		Title:      r.Title,
+		Pages:      r.Pages,
+		CallNumber: r.CallNumber,
+		AuthorIDs:  r.AuthorIDs,
+		Authors:    r.Authors,
+		Publishers: r.Publishers,
+		Subjects:   r.Subjects,
+		Languages:  r.Languages,
+	}
+}
+
+func (h *CatalogHandler) ListBooks(c *gin.Context) {
+	books, err := h.catalogService.ListBooks(c.Query("q"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"books": books})
+}
+
+func (h *CatalogHandler) GetBook(c *gin.Context) {
+	book, err := h.catalogService.GetBook(c.Param("book_code"))
+	if err != nil {
+		respondCatalogError(c, "Failed to fetch book", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"book": book})
+}
+
+func (h *CatalogHandler) CreateBook(c *gin.Context) {
+	var reqData bookRequest
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	book, err := h.catalogService.CreateBook(actorFromContext(c), reqData.input())
+	if err != nil {
+		respondCatalogError(c, "Failed to create book", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Book created successfully", "book": book})
+}
+
+// UpdateBook replaces the book's fields and relations with the request;
+// relations left out are removed.
+func (h *CatalogHandler) UpdateBook(c *gin.Context) {
+	var reqData bookRequest
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	book, err := h.catalogService.UpdateBook(actorFromContext(c), c.Param("book_code"), reqData.input())
+	if err != nil {
+		respondCatalogError(c, "Failed to update book", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Book updated successfully", "book": book})
+}
+
+func (h *CatalogHandler) DeleteBook(c *gin.Context) {
+	if err := h.catalogService.DeleteBook(actorFromContext(c), c.Param("book_code")); err != nil {
+		respondCatalogError(c, "Failed to delete book", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Book deleted successfully"})
+}
+
+// marcMaxUploadSize bounds the MARC upload; the service also caps the
+// record count.
+const marcMaxUploadSize = 20 << 20
+
+// ImportMARC takes a multipart "file" holding binary MARC21 or MARCXML; the
+// format is detected from the content. Matching titles are updated, new
+// ones created, and the report lists every record.
+func (h *CatalogHandler) ImportMARC(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, marcMaxUploadSize)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": "a MARC21 or MARCXML file is required in the file field"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload", "details": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	report, err := h.catalogService.ImportMARC(actorFromContext(c), file)
+	if err != nil && report == nil {
+		if errors.Is(err, subservices.ErrInvalidMARCFile) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to import records", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import records", "details": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Import stopped before finishing", "details": err.Error(), "report": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func respondCatalogError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, subservices.ErrBookNotFound), errors.Is(err, subservices.ErrLocationNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, subservices.ErrBookExists), errors.Is(err, subservices.ErrBookHasCopies):
+		status = http.StatusConflict
+	case errors.Is(err, subservices.ErrInvalidBook), errors.Is(err, subservices.ErrInvalidBookCode),
+		errors.Is(err, subservices.ErrAuthorNotFound):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": message, "details": err.Error()})
+}
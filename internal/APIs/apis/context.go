@@ -0,0 +1,53 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	contextUserID    = "user_id"
+	contextRole      = "role"
+	contextStudentID = "student_id"
+	contextAPIKeyID  = "api_key_id"
+	contextSessionID = "session_id"
+)
+
+func setSessionContext(c *gin.Context, session *subservices.Session) {
+	c.Set(contextUserID, session.UserID)
+	c.Set(contextRole, session.UserRole)
+	c.Set(contextStudentID, session.StudentID)
+	c.Set(contextSessionID, session.CurrentSessionID())
+}
+
+func setAPIKeyContext(c *gin.Context, key *subservices.APIKey) {
+	c.Set(contextAPIKeyID, key.KeyID)
+}
+
+// actorFromContext returns the authenticated caller set by AuthMiddleware.
+func actorFromContext(c *gin.Context) subservices.Actor {
+	return subservices.Actor{UserID: c.GetInt(contextUserID), APIKeyID: c.GetInt(contextAPIKeyID)}
+}
+
+// studentIDFromContext returns the student linked to the authenticated
+// user, and false for staff accounts without one.
+func studentIDFromContext(c *gin.Context) (int, bool) {
+	studentID := c.GetInt(contextStudentID)
+	return studentID, studentID != 0
+}
+
+// apiKeyHeader carries API keys, kept apart from Authorization so a key is
+// never mistaken for a session token or JWT.
+const apiKeyHeader = "X-API-Key"
+
+// bearerToken reads the Authorization header, accepting both the raw token
+// sent by the bundled dashboards and the standard "Bearer <token>" form.
+func bearerToken(c *gin.Context) string {
+	header := strings.TrimSpace(c.GetHeader("Authorization"))
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return header
+}
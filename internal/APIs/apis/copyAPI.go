@@ -0,0 +1,217 @@
+package apis
+
+import (
+	"bytes"
+	"db_project2/internal/services/subservices"
+	"db_project2/pkg/labels"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CopyHandler struct {
+	administratorService *subservices.AdministratorService
+}
+
+func NewCopyHandler(service *subservices.AdministratorService) *CopyHandler {
+	return &CopyHandler{administratorService: service}
+}
+
+func InitCopyAPI(router *gin.Engine, adminService *subservices.AdministratorService) {
+	handler := NewCopyHandler(adminService)
+	copyRoutes := router.Group("/admin/copies")
+	{
+		copyRoutes.GET("/labels", handler.PrintLabels)
+		copyRoutes.POST("/move", handler.MoveCopies)
+		copyRoutes.GET("/:copy_id", handler.GetCopy)
+		copyRoutes.POST("/:copy_id/withdraw", handler.statusChange(subservices.CopyWithdrawn))
+		copyRoutes.POST("/:copy_id/damage", handler.statusChange(subservices.CopyDamaged))
+		copyRoutes.POST("/:copy_id/repair", handler.statusChange(subservices.CopyInRepair))
+		copyRoutes.POST("/:copy_id/report-lost", handler.statusChange(subservices.CopyLost))
+		copyRoutes.POST("/:copy_id/hold", handler.statusChange(subservices.CopyOnHoldShelf))
+		copyRoutes.POST("/:copy_id/restore", handler.statusChange(subservices.CopyAvailable))
+	}
+}
+
+func (h *CopyHandler) GetCopy(c *gin.Context) {
+	copyID, ok := bookCopyID(c)
+	if !ok {
+		return
+	}
+
+	bookCopy, history, err := h.administratorService.GetCopy(copyID)
+	if err != nil {
+		respondCopyError(c, "Failed to fetch book copy", err)
+		return
+	}
+
+	locationHistory, err := h.administratorService.CopyLocationHistory(copyID)
+	if err != nil {
+		respondCopyError(c, "Failed to fetch book copy", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"copy": bookCopy, "history": history, "location_history": locationHistory})
+}
+
+// MoveCopies reshelves the copies given as repeated copy_id values at
+// location_id, with an optional reason for the location history.
+func (h *CopyHandler) MoveCopies(c *gin.Context) {
+	var reqData struct {
+		CopyIDs    []int  `form:"copy_id" json:"copy_ids" binding:"required"`
+		LocationID int    `form:"location_id" json:"location_id" binding:"required"`
+		Reason     string `form:"reason" json:"reason"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	moved, err := h.administratorService.MoveCopies(actorFromContext(c), reqData.CopyIDs, reqData.LocationID, reqData.Reason)
+	if err != nil {
+		respondCopyError(c, "Failed to move copies", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Copies moved successfully", "copies": moved})
+}
+
+// statusChange returns the handler for one explicit copy transition.
+func (h *CopyHandler) statusChange(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		copyID, ok := bookCopyID(c)
+		if !ok {
+			return
+		}
+
+		var reqData struct {
+			Reason string `form:"reason" binding:"required"`
+		}
+
+		if err := c.ShouldBind(&reqData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+			return
+		}
+
+		bookCopy, err := h.administratorService.ChangeCopyStatus(actorFromContext(c), copyID, status, reqData.Reason)
+		if err != nil {
+			respondCopyError(c, "Failed to update copy status", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Copy status updated successfully", "copy": bookCopy})
+	}
+}
+
+// PrintLabels renders barcode labels for the copies given as repeated
+// copy_id parameters, or for those added between from and to (YYYY-MM-DD).
+// The default is a PDF for the label sheet named by sheet, skipping the
+// first skip positions; format=png returns a single label as an image.
+func (h *CopyHandler) PrintLabels(c *gin.Context) {
+	var reqData struct {
+		CopyIDs []int  `form:"copy_id"`
+		From    string `form:"from"`
+		To      string `form:"to"`
+		Format  string `form:"format"`
+		Sheet   string `form:"sheet"`
+		Skip    int    `form:"skip"`
+	}
+
+	if err := c.ShouldBindQuery(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	from, err := labelDate(reqData.From)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+	to, err := labelDate(reqData.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+	selection := subservices.LabelSelection{CopyIDs: reqData.CopyIDs, From: from, To: to}
+
+	if reqData.Format != "" && reqData.Format != "pdf" && reqData.Format != "png" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": "format must be pdf or png"})
+		return
+	}
+	sheet, err := labels.LookupSheet(reqData.Sheet)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	copyLabels, err := h.administratorService.CopyLabels(selection)
+	if err != nil {
+		respondCopyError(c, "Failed to prepare labels", err)
+		return
+	}
+	if len(copyLabels) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No copies match the selection"})
+		return
+	}
+
+	var out bytes.Buffer
+	contentType, extension := "application/pdf", "pdf"
+	if reqData.Format == "png" {
+		if len(copyLabels) != 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": "png output is for a single label"})
+			return
+		}
+		contentType, extension = "image/png", "png"
+		err = labels.WritePNG(&out, copyLabels[0])
+	} else {
+		err = labels.WritePDF(&out, sheet, copyLabels, reqData.Skip)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to render labels", "details": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("copy-labels-%s.%s", time.Now().Format("20060102-150405"), extension)
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	c.Data(http.StatusOK, contentType, out.Bytes())
+}
+
+// labelDate parses an optional YYYY-MM-DD query value.
+func labelDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, errors.New("dates must be given as YYYY-MM-DD")
+	}
+	return &date, nil
+}
+
+func bookCopyID(c *gin.Context) (int, bool) {
+	copyID, err := strconv.Atoi(c.Param("copy_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid copy ID"})
+		return 0, false
+	}
+	return copyID, true
+}
+
+func respondCopyError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, subservices.ErrCopyNotFound), errors.Is(err, subservices.ErrLocationNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, subservices.ErrInvalidCopyTransition):
+		status = http.StatusConflict
+	case errors.Is(err, subservices.ErrCopyReasonRequired), errors.Is(err, subservices.ErrInvalidLabelSelection),
+		errors.Is(err, subservices.ErrInvalidLocation):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": message, "details": err.Error()})
+}
@@ -1,9 +1,10 @@
 package apis
 
 import (
-	"log"
+	"errors"
+	"math"
 	"net/http"
-	"strings"
+	"strconv"
 
 	"db_project2/internal/services/subservices"
 
@@ -11,42 +12,44 @@ import (
 )
 
 type HomeHandler struct {
-	authService *subservices.AuthService
+	authService      *subservices.AuthService
+	throttleService  *subservices.LoginThrottleService
+	twoFactorService *subservices.TwoFactorService
+	apiKeyService    apiKeyAuthenticator
 }
 
-func NewHomeHandler(authService *subservices.AuthService) *HomeHandler {
-	return &HomeHandler{authService: authService}
+// apiKeyAuthenticator is the part of APIKeyService the middleware uses.
+type apiKeyAuthenticator interface {
+	Authenticate(key, ipAddress string) (*subservices.APIKey, bool)
 }
 
-
-func InitHomeAPI(router *gin.Engine, authService *subservices.AuthService) {
-	handler := NewHomeHandler(authService)
-	router.LoadHTMLGlob("templates/*.html")
+func NewHomeHandler(authService *subservices.AuthService, throttleService *subservices.LoginThrottleService, twoFactorService *subservices.TwoFactorService, apiKeyService *subservices.APIKeyService) *HomeHandler {
+	return &HomeHandler{authService: authService, throttleService: throttleService, twoFactorService: twoFactorService, apiKeyService: apiKeyService}
+}
 
 
+// InitHomeAPI must run before any other API is registered: the auth
+// middleware only wraps routes added after router.Use.
+func InitHomeAPI(router *gin.Engine, authService *subservices.AuthService, throttleService *subservices.LoginThrottleService, twoFactorService *subservices.TwoFactorService, apiKeyService *subservices.APIKeyService, ssoEnabled bool) {
+	handler := NewHomeHandler(authService, throttleService, twoFactorService, apiKeyService)
+	router.LoadHTMLGlob("templates/*.html")
+	router.Use(handler.AuthMiddleware())
 
 	router.GET("/", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "index.html", nil)
+		c.HTML(http.StatusOK, "index.html", gin.H{"sso_enabled": ssoEnabled})
 	})
 	router.POST("/login", handler.Login)
+	router.POST("/login/2fa", handler.LoginTwoFactor)
 	router.POST("/logout", handler.Logout)
+	router.POST("/token/refresh", handler.RefreshToken)
+	router.PATCH("/me/password", handler.ChangePassword)
 
-
-
-	adminRoutes := router.Group("/admin")
-	adminRoutes.Use(handler.AuthMiddleware("admin"))
 	router.GET("/admin/dashboard", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "admin_dashboard.html", nil)
 	})
-
-	agentRoutes := router.Group("/library_agent")
-	agentRoutes.Use(handler.AuthMiddleware("library_agent"))
 	router.GET("/library_agent/dashboard", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "library_agent_dashboard.html", nil)
 	})
-
-	studentRoutes := router.Group("/student")
-	studentRoutes.Use(handler.AuthMiddleware("student"))
 	router.GET("/student/dashboard", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "student_dashboard.html", nil)
 	})
@@ -63,67 +66,307 @@ func (h *HomeHandler) Login(c *gin.Context) {
 		return
 	}
 
-	role, studentID, err := h.authService.ValidateCredentials(loginRequest.Username, loginRequest.Password)
+	if !h.checkLoginThrottle(c, loginRequest.Username) {
+		return
+	}
+
+	user, err := h.authService.ValidateCredentials(loginRequest.Username, loginRequest.Password)
 	if err != nil {
+		h.throttleService.RecordLoginFailure(loginRequest.Username, c.ClientIP(), err)
+		if errors.Is(err, subservices.ErrAccountDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	role = strings.ToLower(role)
+	// The failure counter is only reset once the second factor passes, so a
+	// known password does not buy unlimited code guesses.
+	if user.TOTPEnabled {
+		challenge, err := h.twoFactorService.CreateChallenge(user.UserID, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor login"})
+			return
+		}
 
-	token := h.authService.CreateSession(loginRequest.Username, role)
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor code required", "two_factor_required": true, "challenge_token": challenge})
+		return
+	}
+
+	h.throttleService.RecordLoginSuccess(loginRequest.Username, c.ClientIP())
+	h.completeLogin(c, user)
+}
+
+// LoginTwoFactor finishes a login started by Login for accounts with
+// two-factor authentication. code is either a TOTP code or a recovery code.
+func (h *HomeHandler) LoginTwoFactor(c *gin.Context) {
+	var reqData struct {
+		ChallengeToken string `form:"challenge_token" binding:"required"`
+		Code           string `form:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	pending, err := h.twoFactorService.PendingChallenge(reqData.ChallengeToken)
+	if err != nil {
+		if errors.Is(err, subservices.ErrInvalidChallenge) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login challenge"})
+		return
+	}
+
+	if !h.checkLoginThrottle(c, pending.Username) {
+		return
+	}
+
+	user, err := h.twoFactorService.CompleteChallenge(reqData.ChallengeToken, reqData.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, subservices.ErrInvalidTwoFactorCode):
+			h.throttleService.RecordLoginFailure(pending.Username, c.ClientIP(), err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, subservices.ErrInvalidChallenge):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, subservices.ErrAccountDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify two-factor code"})
+		}
+		return
+	}
+
+	h.throttleService.RecordLoginSuccess(user.Username, c.ClientIP())
+	h.completeLogin(c, user)
+}
+
+// checkLoginThrottle answers 429 and returns false while username or the
+// client IP is backing off.
+func (h *HomeHandler) checkLoginThrottle(c *gin.Context, username string) bool {
+	err := h.throttleService.CheckLoginAllowed(username, c.ClientIP())
+	if err != nil {
+		var throttled *subservices.ThrottledError
+		if errors.As(err, &throttled) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": throttled.Error()})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+		return false
+	}
+	return true
+}
+
+// completeLogin issues a session or token pair for an authenticated user.
+func (h *HomeHandler) completeLogin(c *gin.Context, user *subservices.User) {
+	response, err := issueLogin(c, h.authService, h.twoFactorService, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// issueLogin creates the session or token pair and builds the login
+// response body. Password and single sign-on logins both finish here.
+func issueLogin(c *gin.Context, authService *subservices.AuthService, twoFactorService *subservices.TwoFactorService, user *subservices.User) (gin.H, error) {
+	role := user.UserRole
+	studentID := user.StudentID
+	twoFactorSetupRequired := twoFactorService.SetupRequired(role, user.TOTPEnabled)
 
 	redirectURL := ""
 	switch role {
-	case "admin":
+	case RoleAdmin:
 		redirectURL = "/admin/dashboard"
-	case "libraryagent":
+	case RoleLibraryAgent:
 		redirectURL = "/library_agent/dashboard"
-	case "student":
+	case RoleStudent:
 		redirectURL = "/student/dashboard"
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Login successful", "redirect": redirectURL, "token": token, "studentID": studentID})
+
+	if authService.UsesJWT() {
+		pair, err := authService.IssueTokenPair(user, c.ClientIP(), c.Request.UserAgent())
+		if err != nil {
+			return nil, errors.New("Failed to issue tokens")
+		}
+
+		return gin.H{
+			"message":       "Login successful",
+			"redirect":      redirectURL,
+			"token":         pair.AccessToken,
+			"token_type":    "Bearer",
+			"expires_in":    pair.ExpiresIn,
+			"refresh_token": pair.RefreshToken,
+			"role":          role,
+			"studentID":     studentID,
+
+			"must_change_password":      user.MustChangePassword,
+			"two_factor_setup_required": twoFactorSetupRequired,
+		}, nil
+	}
+
+	token, err := authService.CreateSession(user.UserID, role, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		return nil, errors.New("Failed to create session")
+	}
+
+	return gin.H{"message": "Login successful", "redirect": redirectURL, "token": token, "role": role, "studentID": studentID, "must_change_password": user.MustChangePassword, "two_factor_setup_required": twoFactorSetupRequired}, nil
+}
+
+func (h *HomeHandler) ChangePassword(c *gin.Context) {
+	var reqData struct {
+		OldPassword string `form:"old_password" binding:"required"`
+		NewPassword string `form:"new_password" binding:"required"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	err := h.authService.ChangePassword(actorFromContext(c).UserID, reqData.OldPassword, reqData.NewPassword)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if subservices.IsPasswordPolicyError(err) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": "Failed to update password", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
 }
 
+func (h *HomeHandler) RefreshToken(c *gin.Context) {
+	var reqData struct {
+		RefreshToken string `form:"refresh_token" binding:"required"`
+	}
+
+	if !h.authService.UsesJWT() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token refresh is not enabled"})
+		return
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	pair, err := h.authService.RefreshTokens(reqData.RefreshToken, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if errors.Is(err, subservices.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         pair.AccessToken,
+		"token_type":    "Bearer",
+		"expires_in":    pair.ExpiresIn,
+		"refresh_token": pair.RefreshToken,
+	})
+}
 
 func (h *HomeHandler) Logout(c *gin.Context) {
-	token := c.GetHeader("Authorization")
-	if token == "" {
+	token := bearerToken(c)
+	refreshToken := c.PostForm("refresh_token")
+	if token == "" && refreshToken == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing token"})
 		return
 	}
 
-	h.authService.InvalidateSession(token)
+	if h.authService.UsesSessions() && token != "" {
+		h.authService.InvalidateSession(token)
+	}
+	if h.authService.UsesJWT() {
+		h.authService.RevokeTokens(token, refreshToken)
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
-func (h *HomeHandler) AuthMiddleware(requiredRole string) gin.HandlerFunc {
+// AuthMiddleware enforces routePermissions for every matched route.
+// Unmatched paths fall through so gin can answer 404.
+func (h *HomeHandler) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := c.GetHeader("Authorization")
+		if c.FullPath() == "" {
+			c.Next()
+			return
+		}
+
+		permission, ok := lookupPermission(c.Request.Method, c.FullPath())
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: route has no permission entry"})
+			c.Abort()
+			return
+		}
+
+		if permission.public {
+			c.Next()
+			return
+		}
+
+		if key := c.GetHeader(apiKeyHeader); key != "" {
+			h.authenticateAPIKey(c, key, permission)
+			return
+		}
+
+		token := bearerToken(c)
 		if token == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
 			c.Abort()
 			return
 		}
 
-		log.Println("PRINTING TOKEN: ", token)
-
-		role, ok := h.authService.GetSessionRole(token)
+		session, ok := h.authService.Authenticate(token)
 		if !ok {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired session"})
 			c.Abort()
 			return
 		}
 
-		log.Println("Requiredrole is ", requiredRole)
-		log.Println("ROle is ", role)
-
-		if role != requiredRole && requiredRole != "" {
+		if !permission.allows(session.UserRole) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied for your role"})
 			c.Abort()
 			return
 		}
 
+		twoFactorSetupRequired := h.twoFactorService.SetupRequired(session.UserRole, session.TOTPEnabled)
+		if blocked := setupGate(permission, session.MustChangePassword, twoFactorSetupRequired); blocked != nil {
+			c.JSON(http.StatusForbidden, blocked)
+			c.Abort()
+			return
+		}
+
+		setSessionContext(c, session)
 		c.Next()
 	}
 }
+
+// authenticateAPIKey authorises a request made with an API key. Keys are
+// checked against the route's scope rather than a role.
+func (h *HomeHandler) authenticateAPIKey(c *gin.Context, key string, permission routePermission) {
+	apiKey, ok := h.apiKeyService.Authenticate(key, c.ClientIP())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key"})
+		c.Abort()
+		return
+	}
+
+	if permission.scope == "" || !apiKey.HasScope(permission.scope) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key is not scoped for this route"})
+		c.Abort()
+		return
+	}
+
+	setAPIKeyContext(c, apiKey)
+	c.Next()
+}
@@ -0,0 +1,84 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stubAPIKeys accepts one key, and only from allowedIP, as a key with an
+// IP allow-list would.
+type stubAPIKeys struct {
+	key       string
+	allowedIP string
+	scope     string
+}
+
+func (s stubAPIKeys) Authenticate(key, ipAddress string) (*subservices.APIKey, bool) {
+	if key != s.key || ipAddress != s.allowedIP {
+		return nil, false
+	}
+	return &subservices.APIKey{KeyID: 1, Scopes: []string{s.scope}}, true
+}
+
+func newAPIKeyTestRouter(t *testing.T, trustedProxies []string) *gin.Engine {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := &HomeHandler{apiKeyService: stubAPIKeys{
+		key:       "kiosk-key",
+		allowedIP: "203.0.113.7",
+		scope:     subservices.ScopeAssignResource,
+	}}
+	router.Use(handler.AuthMiddleware())
+	router.POST("/library-agent/assign-resource", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return router
+}
+
+func apiKeyRequest(remoteAddr, forwardedFor string) *http.Request {
+	request := httptest.NewRequest(http.MethodPost, "/library-agent/assign-resource", nil)
+	request.RemoteAddr = remoteAddr
+	request.Header.Set(apiKeyHeader, "kiosk-key")
+	if forwardedFor != "" {
+		request.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	return request
+}
+
+// With no trusted proxies, as server.Start configures by default, a client
+// cannot claim an allow-listed address through X-Forwarded-For.
+func TestAPIKeyAllowListIgnoresSpoofedForwardedFor(t *testing.T) {
+	router := newAPIKeyTestRouter(t, nil)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, apiKeyRequest("198.51.100.20:40000", "203.0.113.7"))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("spoofed X-Forwarded-For got %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, apiKeyRequest("203.0.113.7:40000", ""))
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("allow-listed address got %d, want %d", recorder.Code, http.StatusNoContent)
+	}
+}
+
+func TestAPIKeyAllowListHonoursConfiguredProxy(t *testing.T) {
+	router := newAPIKeyTestRouter(t, []string{"10.0.0.1"})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, apiKeyRequest("10.0.0.1:40000", "203.0.113.7"))
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("request through a trusted proxy got %d, want %d", recorder.Code, http.StatusNoContent)
+	}
+}
@@ -2,6 +2,7 @@ package apis
 
 import (
 	"db_project2/internal/services/subservices"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -24,14 +25,30 @@ func InitLibraryAgentAPI(router *gin.Engine, agentService *subservices.LibraryAg
 		agentRoutes.GET("/overdue-loans", handler.ListOverdueLoans)
 		agentRoutes.POST("/return-resource", handler.MarkResourceAsReturned)
 		agentRoutes.GET("/student-profile/:student_id", handler.ViewStudentProfile)
+		agentRoutes.GET("/cards/:card_number", handler.LookupCard)
 		agentRoutes.POST("/assign-resource", handler.AssignResource)
 		agentRoutes.GET("/all-loans", handler.GetAllLoans)
 		agentRoutes.GET("/all-books", handler.GetAllAvailableBooks)
 	}
 }
 
+// ListOverdueLoans covers the staff member's own branch unless branch_id
+// is given; branch_id=0 lists every branch.
 func (h *LibraryAgentHandler) ListOverdueLoans(c *gin.Context) {
-	overdueLoans, err := h.libraryAgentService.GetOverdueLoans()
+	var reqData struct {
+		BranchID *int `form:"branch_id"`
+	}
+
+	if err := c.ShouldBindQuery(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	overdueLoans, err := h.libraryAgentService.GetOverdueLoans(actorFromContext(c), reqData.BranchID)
+	if errors.Is(err, subservices.ErrBranchNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to fetch overdue loans", "details": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch overdue loans"})
 		return
@@ -42,7 +59,8 @@ func (h *LibraryAgentHandler) ListOverdueLoans(c *gin.Context) {
 
 func (h *LibraryAgentHandler) MarkResourceAsReturned(c *gin.Context) {
 	var reqData struct {
-		LoanID int `form:"loan_id" binding:"required"`
+		LoanID   int  `form:"loan_id" binding:"required"`
+		BranchID *int `form:"branch_id"`
 	}
 
 	if err := c.ShouldBind(&reqData); err != nil {
@@ -50,7 +68,11 @@ func (h *LibraryAgentHandler) MarkResourceAsReturned(c *gin.Context) {
 		return
 	}
 
-	err := h.libraryAgentService.MarkResourceReturned(reqData.LoanID)
+	err := h.libraryAgentService.MarkResourceReturned(actorFromContext(c), reqData.LoanID, reqData.BranchID)
+	if errors.Is(err, subservices.ErrBranchNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to mark resource as returned", "details": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark resource as returned", "details": err.Error()})
 		return
@@ -68,7 +90,7 @@ func (h *LibraryAgentHandler) ViewStudentProfile(c *gin.Context) {
 		return
 	}
 
-	studentProfile, err := h.libraryAgentService.GetStudentProfile(studentID)
+	studentProfile, err := h.libraryAgentService.GetStudentProfile(actorFromContext(c), studentID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch student profile", "details": err.Error()})
 		return
@@ -77,10 +99,22 @@ func (h *LibraryAgentHandler) ViewStudentProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"student_profile": studentProfile})
 }
 
+// LookupCard resolves a scanned card number to the patron at the desk.
+func (h *LibraryAgentHandler) LookupCard(c *gin.Context) {
+	lookup, err := h.libraryAgentService.LookupCard(actorFromContext(c), c.Param("card_number"))
+	if err != nil {
+		respondCardError(c, "Failed to look up card", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, lookup)
+}
+
 func (h *LibraryAgentHandler) AssignResource(c *gin.Context) {
 	var reqData struct {
-		StudentID           int    `form:"student_id" binding:"required"`
-		BookCode         string `form:"book_code" binding:"required"`
+		StudentID int    `form:"student_id" binding:"required"`
+		BookCode  string `form:"book_code" binding:"required"`
+		BranchID  *int   `form:"branch_id"`
 	}
 
 	if err := c.ShouldBind(&reqData); err != nil {
@@ -91,7 +125,21 @@ func (h *LibraryAgentHandler) AssignResource(c *gin.Context) {
 		return
 	}
 
-	err := h.libraryAgentService.AssignResource(reqData.StudentID, reqData.BookCode)
+	err := h.libraryAgentService.AssignResource(actorFromContext(c), reqData.StudentID, reqData.BookCode, reqData.BranchID)
+	if errors.Is(err, subservices.ErrBranchNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Failed to assign resource",
+			"details": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, subservices.ErrCardNotActive) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Checkout refused",
+			"details": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to assign resource",
@@ -105,8 +153,22 @@ func (h *LibraryAgentHandler) AssignResource(c *gin.Context) {
 	})
 }
 
+// GetAllLoans picks the branch the same way as ListOverdueLoans.
 func (h *LibraryAgentHandler) GetAllLoans(c *gin.Context) {
-	loans, err := h.libraryAgentService.GetAllLoans()
+	var reqData struct {
+		BranchID *int `form:"branch_id"`
+	}
+
+	if err := c.ShouldBindQuery(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	loans, err := h.libraryAgentService.GetAllLoans(actorFromContext(c), reqData.BranchID)
+	if errors.Is(err, subservices.ErrBranchNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to fetch all loans", "details": err.Error()})
+		return
+	}
 	if err!= nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch all loans"})
         return
@@ -0,0 +1,150 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LocationHandler struct {
+	administratorService *subservices.AdministratorService
+}
+
+func NewLocationHandler(service *subservices.AdministratorService) *LocationHandler {
+	return &LocationHandler{administratorService: service}
+}
+
+func InitLocationAPI(router *gin.Engine, adminService *subservices.AdministratorService) {
+	handler := NewLocationHandler(adminService)
+	locationRoutes := router.Group("/admin/locations")
+	{
+		locationRoutes.GET("", handler.ListLocations)
+		locationRoutes.POST("", handler.CreateLocation)
+		locationRoutes.GET("/:location_id", handler.GetLocation)
+		locationRoutes.PATCH("/:location_id", handler.RenameLocation)
+		locationRoutes.DELETE("/:location_id", handler.DeleteLocation)
+	}
+}
+
+// ListLocations returns every location, or those of one branch when
+// branch_id is given.
+func (h *LocationHandler) ListLocations(c *gin.Context) {
+	var reqData struct {
+		BranchID int `form:"branch_id"`
+	}
+
+	if err := c.ShouldBindQuery(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	locations, err := h.administratorService.ListLocations(reqData.BranchID)
+	if err != nil {
+		respondLocationError(c, "Failed to list locations", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"locations": locations})
+}
+
+func (h *LocationHandler) GetLocation(c *gin.Context) {
+	locationID, ok := shelvingLocationID(c)
+	if !ok {
+		return
+	}
+
+	location, children, copies, err := h.administratorService.GetLocation(locationID)
+	if err != nil {
+		respondLocationError(c, "Failed to fetch location", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"location": location, "children": children, "copies": copies})
+}
+
+// CreateLocation adds a building, floor, room, rack or shelf; parent_id is
+// left out for a top-level location, which then needs a branch_id.
+func (h *LocationHandler) CreateLocation(c *gin.Context) {
+	var reqData struct {
+		ParentID *int   `form:"parent_id" json:"parent_id"`
+		BranchID *int   `form:"branch_id" json:"branch_id"`
+		Kind     string `form:"kind" json:"kind" binding:"required"`
+		Label    string `form:"label" json:"label" binding:"required"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	location, err := h.administratorService.CreateLocation(actorFromContext(c), reqData.ParentID, reqData.BranchID, reqData.Kind, reqData.Label)
+	if err != nil {
+		respondLocationError(c, "Failed to create location", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Location created successfully", "location": location})
+}
+
+func (h *LocationHandler) RenameLocation(c *gin.Context) {
+	locationID, ok := shelvingLocationID(c)
+	if !ok {
+		return
+	}
+
+	var reqData struct {
+		Label string `form:"label" json:"label" binding:"required"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	location, err := h.administratorService.RenameLocation(actorFromContext(c), locationID, reqData.Label)
+	if err != nil {
+		respondLocationError(c, "Failed to rename location", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Location renamed successfully", "location": location})
+}
+
+func (h *LocationHandler) DeleteLocation(c *gin.Context) {
+	locationID, ok := shelvingLocationID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.administratorService.DeleteLocation(actorFromContext(c), locationID); err != nil {
+		respondLocationError(c, "Failed to delete location", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Location deleted successfully"})
+}
+
+func shelvingLocationID(c *gin.Context) (int, bool) {
+	locationID, err := strconv.Atoi(c.Param("location_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return 0, false
+	}
+	return locationID, true
+}
+
+func respondLocationError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, subservices.ErrLocationNotFound), errors.Is(err, subservices.ErrBranchNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, subservices.ErrLocationExists), errors.Is(err, subservices.ErrLocationInUse):
+		status = http.StatusConflict
+	case errors.Is(err, subservices.ErrInvalidLocation):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": message, "details": err.Error()})
+}
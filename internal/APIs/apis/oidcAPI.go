@@ -0,0 +1,100 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OIDCHandler struct {
+	oidcService      *subservices.OIDCService
+	authService      *subservices.AuthService
+	twoFactorService *subservices.TwoFactorService
+}
+
+func NewOIDCHandler(oidcService *subservices.OIDCService, authService *subservices.AuthService, twoFactorService *subservices.TwoFactorService) *OIDCHandler {
+	return &OIDCHandler{oidcService: oidcService, authService: authService, twoFactorService: twoFactorService}
+}
+
+func InitOIDCAPI(router *gin.Engine, oidcService *subservices.OIDCService, authService *subservices.AuthService, twoFactorService *subservices.TwoFactorService) {
+	handler := NewOIDCHandler(oidcService, authService, twoFactorService)
+	oidcRoutes := router.Group("/oidc")
+	{
+		oidcRoutes.GET("/login", handler.Login)
+		oidcRoutes.GET("/callback", handler.Callback)
+	}
+}
+
+func (h *OIDCHandler) Login(c *gin.Context) {
+	authURL, err := h.oidcService.BeginLogin(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, subservices.ErrOIDCDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to start single sign-on: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to reach the identity provider"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback is where the provider sends the browser back. It renders a page
+// that stores the session token just like the password login form does.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if providerError := c.Query("error"); providerError != "" {
+		h.renderResult(c, http.StatusUnauthorized, gin.H{"error": "Single sign-on failed: " + providerError})
+		return
+	}
+
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		h.renderResult(c, http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	user, err := h.oidcService.CompleteLogin(c.Request.Context(), state, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, subservices.ErrOIDCDisabled):
+			h.renderResult(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, subservices.ErrInvalidOIDCState):
+			h.renderResult(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, subservices.ErrOIDCNoRole), errors.Is(err, subservices.ErrOIDCNoAccount),
+			errors.Is(err, subservices.ErrOIDCRoleMismatch), errors.Is(err, subservices.ErrOIDCEmailUnverified),
+			errors.Is(err, subservices.ErrAccountDisabled):
+			h.renderResult(c, http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Single sign-on callback failed: %v", err)
+			h.renderResult(c, http.StatusBadGateway, gin.H{"error": "Single sign-on failed"})
+		}
+		return
+	}
+
+	// Local two-factor authentication still applies to SSO logins.
+	if user.TOTPEnabled {
+		challenge, err := h.twoFactorService.CreateChallenge(user.UserID, c.ClientIP())
+		if err != nil {
+			h.renderResult(c, http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor login"})
+			return
+		}
+		h.renderResult(c, http.StatusOK, gin.H{"message": "Two-factor code required", "two_factor_required": true, "challenge_token": challenge})
+		return
+	}
+
+	response, err := issueLogin(c, h.authService, h.twoFactorService, user)
+	if err != nil {
+		h.renderResult(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.renderResult(c, http.StatusOK, response)
+}
+
+func (h *OIDCHandler) renderResult(c *gin.Context, status int, result gin.H) {
+	c.HTML(status, "oidc_callback.html", gin.H{"result": result})
+}
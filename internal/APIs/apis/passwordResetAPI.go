@@ -0,0 +1,76 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PasswordResetHandler struct {
+	passwordResetService *subservices.PasswordResetService
+}
+
+func NewPasswordResetHandler(service *subservices.PasswordResetService) *PasswordResetHandler {
+	return &PasswordResetHandler{passwordResetService: service}
+}
+
+func InitPasswordResetAPI(router *gin.Engine, passwordResetService *subservices.PasswordResetService) {
+	handler := NewPasswordResetHandler(passwordResetService)
+	passwordRoutes := router.Group("/password")
+	{
+		passwordRoutes.POST("/forgot", handler.ForgotPassword)
+		passwordRoutes.GET("/reset", handler.ResetPasswordPage)
+		passwordRoutes.POST("/reset", handler.ResetPassword)
+	}
+}
+
+func (h *PasswordResetHandler) ForgotPassword(c *gin.Context) {
+	var reqData struct {
+		Email string `form:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if err := h.passwordResetService.RequestReset(reqData.Email, c.ClientIP()); err != nil {
+		log.Printf("Password reset request failed: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the address is registered, a reset link has been sent"})
+}
+
+func (h *PasswordResetHandler) ResetPasswordPage(c *gin.Context) {
+	c.HTML(http.StatusOK, "reset_password.html", gin.H{"token": c.Query("token")})
+}
+
+func (h *PasswordResetHandler) ResetPassword(c *gin.Context) {
+	var reqData struct {
+		Token       string `form:"token" binding:"required"`
+		NewPassword string `form:"new_password" binding:"required"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	err := h.passwordResetService.ResetPassword(reqData.Token, reqData.NewPassword)
+	if err != nil {
+		switch {
+		case errors.Is(err, subservices.ErrInvalidResetToken):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case subservices.IsPasswordPolicyError(err):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to reset password", "details": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
@@ -0,0 +1,223 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RoleAdmin        = "Admin"
+	RoleLibraryAgent = "LibraryAgent"
+	RoleStudent      = "Student"
+)
+
+type routePermission struct {
+	public bool
+	roles  []string
+	// allowedDuringPasswordChange keeps the route reachable for accounts
+	// flagged with must_change_password.
+	allowedDuringPasswordChange bool
+	// allowedDuringTwoFactorSetup keeps the route reachable for admins who
+	// still have to enrol while two-factor authentication is mandatory.
+	allowedDuringTwoFactorSetup bool
+	// scope is the API key scope that grants the route. Routes without one
+	// cannot be called with an API key.
+	scope string
+}
+
+func public() routePermission {
+	return routePermission{public: true}
+}
+
+func allow(roles ...string) routePermission {
+	return routePermission{roles: roles}
+}
+
+// routePermissions is the single source of truth for who may call what.
+// Keys are "METHOD /full/path" exactly as registered with gin. Any route
+// missing from this table is rejected by AuthMiddleware and by
+// VerifyRoutePermissions at startup.
+var routePermissions = map[string]routePermission{
+	"GET /":                        public(),
+	"POST /login":                  public(),
+	"POST /login/2fa":              public(),
+	"GET /oidc/login":              public(),
+	"GET /oidc/callback":           public(),
+	"POST /logout":                 public(),
+	"POST /token/refresh":          public(),
+	"POST /password/forgot":        public(),
+	"GET /password/reset":          public(),
+	"POST /password/reset":         public(),
+	"GET /admin/dashboard":         public(),
+	"GET /library_agent/dashboard": public(),
+	"GET /student/dashboard":       public(),
+
+	"PATCH /me/password": accountSetup(RoleAdmin, RoleLibraryAgent, RoleStudent),
+
+	"GET /me/sessions":                passwordChange(RoleAdmin, RoleLibraryAgent, RoleStudent),
+	"DELETE /me/sessions/:session_id": passwordChange(RoleAdmin, RoleLibraryAgent, RoleStudent),
+	"POST /me/sessions/revoke-others": passwordChange(RoleAdmin, RoleLibraryAgent, RoleStudent),
+
+	"GET /me/2fa":                 accountSetup(RoleAdmin, RoleLibraryAgent),
+	"POST /me/2fa/setup":          accountSetup(RoleAdmin, RoleLibraryAgent),
+	"POST /me/2fa/confirm":        accountSetup(RoleAdmin, RoleLibraryAgent),
+	"POST /me/2fa/disable":        allow(RoleAdmin, RoleLibraryAgent),
+	"POST /me/2fa/recovery-codes": allow(RoleAdmin, RoleLibraryAgent),
+
+	"POST /admin/create-student":                  allow(RoleAdmin).scoped(subservices.ScopeCreateStudent),
+	"PATCH /admin/activate-card":                  allow(RoleAdmin),
+	"GET /admin/cards/:card_id":                   allow(RoleAdmin, RoleLibraryAgent),
+	"POST /admin/cards/:card_id/activate":         allow(RoleAdmin),
+	"POST /admin/cards/:card_id/suspend":          allow(RoleAdmin),
+	"POST /admin/cards/:card_id/block":            allow(RoleAdmin),
+	"POST /admin/cards/:card_id/expire":           allow(RoleAdmin),
+	"POST /admin/cards/:card_id/renew":            allow(RoleAdmin),
+	"POST /admin/cards/:card_id/replace":          allow(RoleAdmin, RoleLibraryAgent),
+	"POST /admin/students/import":                 allow(RoleAdmin).scoped(subservices.ScopeCreateStudent),
+	"PATCH /admin/students/:student_id":           allow(RoleAdmin),
+	"POST /admin/students/:student_id/deactivate": allow(RoleAdmin),
+	"POST /admin/students/:student_id/reactivate": allow(RoleAdmin),
+	"POST /admin/students/:student_id/archive":    allow(RoleAdmin),
+	"DELETE /admin/students/:student_id":          allow(RoleAdmin),
+	"GET /admin/copies/labels":                    allow(RoleAdmin, RoleLibraryAgent),
+	"POST /admin/copies/move":                     allow(RoleAdmin, RoleLibraryAgent),
+	"GET /admin/copies/:copy_id":                  allow(RoleAdmin, RoleLibraryAgent),
+	"POST /admin/copies/:copy_id/withdraw":        allow(RoleAdmin),
+	"POST /admin/copies/:copy_id/damage":          allow(RoleAdmin, RoleLibraryAgent),
+	"POST /admin/copies/:copy_id/repair":          allow(RoleAdmin, RoleLibraryAgent),
+	"POST /admin/copies/:copy_id/report-lost":     allow(RoleAdmin, RoleLibraryAgent),
+	"POST /admin/copies/:copy_id/hold":            allow(RoleAdmin, RoleLibraryAgent),
+	"POST /admin/copies/:copy_id/restore":         allow(RoleAdmin, RoleLibraryAgent),
+	"POST /admin/add-resource":                    allow(RoleAdmin).scoped(subservices.ScopeAddResource),
+
+	"GET /admin/locations":                 allow(RoleAdmin, RoleLibraryAgent).scoped(subservices.ScopeViewBooks),
+	"POST /admin/locations":                allow(RoleAdmin),
+	"GET /admin/locations/:location_id":    allow(RoleAdmin, RoleLibraryAgent).scoped(subservices.ScopeViewBooks),
+	"PATCH /admin/locations/:location_id":  allow(RoleAdmin),
+	"DELETE /admin/locations/:location_id": allow(RoleAdmin),
+
+	"GET /admin/branches":                  allow(RoleAdmin, RoleLibraryAgent),
+	"POST /admin/branches":                 allow(RoleAdmin),
+	"GET /admin/branches/:branch_id":       allow(RoleAdmin, RoleLibraryAgent),
+	"PATCH /admin/branches/:branch_id":     allow(RoleAdmin),
+	"PUT /admin/branches/:branch_id/hours": allow(RoleAdmin),
+
+	"GET /admin/books":               allow(RoleAdmin, RoleLibraryAgent).scoped(subservices.ScopeViewBooks),
+	"POST /admin/books":              allow(RoleAdmin),
+	"POST /admin/books/import":       allow(RoleAdmin),
+	"GET /admin/books/:book_code":    allow(RoleAdmin, RoleLibraryAgent).scoped(subservices.ScopeViewBooks),
+	"PUT /admin/books/:book_code":    allow(RoleAdmin),
+	"DELETE /admin/books/:book_code": allow(RoleAdmin),
+
+	"GET /admin/locked-accounts": allow(RoleAdmin),
+	"POST /admin/unlock-account": allow(RoleAdmin),
+
+	"GET /admin/staff":                          allow(RoleAdmin),
+	"POST /admin/staff":                         allow(RoleAdmin),
+	"PATCH /admin/staff/:user_id":               allow(RoleAdmin),
+	"PATCH /admin/staff/:user_id/role":          allow(RoleAdmin),
+	"PATCH /admin/staff/:user_id/branch":        allow(RoleAdmin),
+	"POST /admin/staff/:user_id/disable":        allow(RoleAdmin),
+	"POST /admin/staff/:user_id/enable":         allow(RoleAdmin),
+	"POST /admin/staff/:user_id/reset-password": allow(RoleAdmin),
+	"DELETE /admin/staff/:user_id":              allow(RoleAdmin),
+	"POST /admin/staff/:user_id/reset-2fa":      allow(RoleAdmin),
+
+	"GET /admin/users/:user_id/sessions":      allow(RoleAdmin),
+	"POST /admin/users/:user_id/force-logout": allow(RoleAdmin),
+
+	"GET /admin/api-keys":                 allow(RoleAdmin),
+	"POST /admin/api-keys":                allow(RoleAdmin),
+	"POST /admin/api-keys/:key_id/rotate": allow(RoleAdmin),
+	"DELETE /admin/api-keys/:key_id":      allow(RoleAdmin),
+
+	"GET /library-agent/overdue-loans":               allow(RoleLibraryAgent, RoleAdmin).scoped(subservices.ScopeViewLoans),
+	"POST /library-agent/return-resource":            allow(RoleLibraryAgent, RoleAdmin).scoped(subservices.ScopeReturnResource),
+	"GET /library-agent/student-profile/:student_id": allow(RoleLibraryAgent, RoleAdmin).scoped(subservices.ScopeViewStudentProfile),
+	"GET /library-agent/cards/:card_number":          allow(RoleLibraryAgent, RoleAdmin).scoped(subservices.ScopeViewStudentProfile),
+	"POST /library-agent/assign-resource":            allow(RoleLibraryAgent, RoleAdmin).scoped(subservices.ScopeAssignResource),
+	"GET /library-agent/all-loans":                   allow(RoleLibraryAgent, RoleAdmin).scoped(subservices.ScopeViewLoans),
+	"GET /library-agent/all-books":                   allow(RoleLibraryAgent, RoleAdmin).scoped(subservices.ScopeViewBooks),
+
+	"POST /library-agent/stocktakes":                   allow(RoleLibraryAgent, RoleAdmin).scoped(subservices.ScopeStocktake),
+	"GET /library-agent/stocktakes/:session_id":        allow(RoleLibraryAgent, RoleAdmin).scoped(subservices.ScopeStocktake),
+	"POST /library-agent/stocktakes/:session_id/scans": allow(RoleLibraryAgent, RoleAdmin).scoped(subservices.ScopeStocktake),
+	"POST /library-agent/stocktakes/:session_id/close": allow(RoleLibraryAgent, RoleAdmin).scoped(subservices.ScopeStocktake),
+
+	"GET /library-agent/transfers":                       allow(RoleLibraryAgent, RoleAdmin),
+	"POST /library-agent/transfers":                      allow(RoleLibraryAgent, RoleAdmin),
+	"POST /library-agent/transfers/:transfer_id/receive": allow(RoleLibraryAgent, RoleAdmin),
+
+	"GET /student/resources":     allow(RoleStudent),
+	"GET /student/me/loans":      allow(RoleStudent),
+	"GET /student/me/profile":    allow(RoleStudent),
+	"PATCH /student/me/password": passwordChange(RoleStudent),
+}
+
+func permissionKey(method, path string) string {
+	return method + " " + path
+}
+
+func lookupPermission(method, path string) (routePermission, bool) {
+	permission, ok := routePermissions[permissionKey(method, path)]
+	return permission, ok
+}
+
+func passwordChange(roles ...string) routePermission {
+	return routePermission{roles: roles, allowedDuringPasswordChange: true}
+}
+
+// accountSetup marks the routes a new account needs to finish both steps,
+// in either order: a staff account created with a temporary password may
+// also have to enrol in two-factor authentication.
+func accountSetup(roles ...string) routePermission {
+	return routePermission{roles: roles, allowedDuringPasswordChange: true, allowedDuringTwoFactorSetup: true}
+}
+
+// setupGate returns the error body for a session that still has to change
+// its password or enrol in two-factor authentication before calling the
+// route, or nil when it may go ahead.
+func setupGate(permission routePermission, mustChangePassword, twoFactorSetupRequired bool) gin.H {
+	if mustChangePassword && !permission.allowedDuringPasswordChange {
+		return gin.H{"error": "Password change required", "must_change_password": true}
+	}
+	if twoFactorSetupRequired && !permission.allowedDuringTwoFactorSetup {
+		return gin.H{"error": "Two-factor authentication setup required", "two_factor_setup_required": true}
+	}
+	return nil
+}
+
+func (p routePermission) scoped(scope string) routePermission {
+	p.scope = scope
+	return p
+}
+
+func (p routePermission) allows(role string) bool {
+	for _, allowed := range p.roles {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyRoutePermissions fails when a registered route has no entry in the
+// permission matrix, so a new endpoint cannot ship without an explicit rule.
+func VerifyRoutePermissions(routes gin.RoutesInfo) error {
+	var missing []string
+	for _, route := range routes {
+		if _, ok := lookupPermission(route.Method, route.Path); !ok {
+			missing = append(missing, permissionKey(route.Method, route.Path))
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("routes without a permission entry: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"testing"
+)
+
+// A new or reset Admin has a temporary password and, with two-factor
+// authentication mandatory, no TOTP yet. Each step must stay reachable
+// while the other is still pending, whichever the admin does first.
+func TestNewAdminWithMandatoryTwoFactorCanFinishSetup(t *testing.T) {
+	twoFactor := subservices.NewTwoFactorServiceInstance(nil, subservices.TwoFactorConfig{RequireForAdmin: true})
+
+	setupRoutes := []string{
+		"PATCH /me/password",
+		"GET /me/2fa",
+		"POST /me/2fa/setup",
+		"POST /me/2fa/confirm",
+	}
+
+	states := []struct {
+		name               string
+		mustChangePassword bool
+		totpEnabled        bool
+	}{
+		{"new account", true, false},
+		{"password changed", false, false},
+		{"two-factor enrolled", true, true},
+	}
+
+	for _, state := range states {
+		setupRequired := twoFactor.SetupRequired(RoleAdmin, state.totpEnabled)
+		for _, key := range setupRoutes {
+			permission, ok := routePermissions[key]
+			if !ok {
+				t.Fatalf("%s has no permission entry", key)
+			}
+			if !permission.allows(RoleAdmin) {
+				t.Fatalf("%s does not allow admins", key)
+			}
+			if blocked := setupGate(permission, state.mustChangePassword, setupRequired); blocked != nil {
+				t.Errorf("%s: %s is blocked: %v", state.name, key, blocked["error"])
+			}
+		}
+	}
+}
+
+func TestPendingSetupBlocksOtherRoutes(t *testing.T) {
+	twoFactor := subservices.NewTwoFactorServiceInstance(nil, subservices.TwoFactorConfig{RequireForAdmin: true})
+	permission := routePermissions["GET /admin/books"]
+
+	if setupGate(permission, true, false) == nil {
+		t.Error("route is reachable before the password change")
+	}
+	if setupGate(permission, false, twoFactor.SetupRequired(RoleAdmin, false)) == nil {
+		t.Error("route is reachable before two-factor enrolment")
+	}
+	if blocked := setupGate(permission, false, twoFactor.SetupRequired(RoleAdmin, true)); blocked != nil {
+		t.Errorf("route is blocked after setup: %v", blocked["error"])
+	}
+}
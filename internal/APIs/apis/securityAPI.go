@@ -0,0 +1,73 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SecurityHandler struct {
+	throttleService *subservices.LoginThrottleService
+}
+
+func NewSecurityHandler(service *subservices.LoginThrottleService) *SecurityHandler {
+	return &SecurityHandler{throttleService: service}
+}
+
+func InitSecurityAPI(router *gin.Engine, throttleService *subservices.LoginThrottleService) {
+	handler := NewSecurityHandler(throttleService)
+	adminRoutes := router.Group("/admin")
+	{
+		adminRoutes.GET("/locked-accounts", handler.ListLockedAccounts)
+		adminRoutes.POST("/unlock-account", handler.UnlockAccount)
+	}
+}
+
+func (h *SecurityHandler) ListLockedAccounts(c *gin.Context) {
+	accounts, err := h.throttleService.ListLockedAccounts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locked accounts"})
+		return
+	}
+
+	addresses, err := h.throttleService.ListLockedAddresses()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locked addresses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"locked_accounts": accounts, "locked_addresses": addresses})
+}
+
+// UnlockAccount lifts the lockout of a username, or of a client IP when
+// ip_address is given instead.
+func (h *SecurityHandler) UnlockAccount(c *gin.Context) {
+	var reqData struct {
+		Username  string `form:"username" binding:"required_without=IPAddress"`
+		IPAddress string `form:"ip_address" binding:"omitempty,ip"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	var err error
+	if reqData.Username != "" {
+		err = h.throttleService.UnlockAccount(actorFromContext(c), reqData.Username)
+	} else {
+		err = h.throttleService.UnlockAddress(actorFromContext(c), reqData.IPAddress)
+	}
+	if errors.Is(err, subservices.ErrNotLocked) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to unlock account", "details": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked successfully"})
+}
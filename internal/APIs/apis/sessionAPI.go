@@ -0,0 +1,111 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionHandler struct {
+	authService *subservices.AuthService
+}
+
+func NewSessionHandler(service *subservices.AuthService) *SessionHandler {
+	return &SessionHandler{authService: service}
+}
+
+func InitSessionAPI(router *gin.Engine, authService *subservices.AuthService) {
+	handler := NewSessionHandler(authService)
+	sessionRoutes := router.Group("/me/sessions")
+	{
+		sessionRoutes.GET("", handler.ListMySessions)
+		sessionRoutes.DELETE("/:session_id", handler.RevokeMySession)
+		sessionRoutes.POST("/revoke-others", handler.RevokeOtherSessions)
+	}
+
+	adminRoutes := router.Group("/admin/users")
+	{
+		adminRoutes.GET("/:user_id/sessions", handler.ListUserSessions)
+		adminRoutes.POST("/:user_id/force-logout", handler.ForceLogout)
+	}
+}
+
+func (h *SessionHandler) ListMySessions(c *gin.Context) {
+	sessions, err := h.authService.ListSessions(actorFromContext(c).UserID, c.GetString(contextSessionID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (h *SessionHandler) RevokeMySession(c *gin.Context) {
+	err := h.authService.RevokeSession(actorFromContext(c).UserID, c.Param("session_id"))
+	if err != nil {
+		if errors.Is(err, subservices.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+func (h *SessionHandler) RevokeOtherSessions(c *gin.Context) {
+	revoked, err := h.authService.RevokeOtherSessions(actorFromContext(c).UserID, c.GetString(contextSessionID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked successfully", "revoked": revoked})
+}
+
+func (h *SessionHandler) ListUserSessions(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(userID, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (h *SessionHandler) ForceLogout(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+
+	err := h.authService.ForceLogout(actorFromContext(c), userID)
+	if err != nil {
+		if errors.Is(err, subservices.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign out user", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions of the user were revoked"})
+}
+
+func sessionUserID(c *gin.Context) (int, bool) {
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	return userID, true
+}
@@ -0,0 +1,220 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StaffHandler struct {
+	staffService *subservices.StaffService
+}
+
+func NewStaffHandler(service *subservices.StaffService) *StaffHandler {
+	return &StaffHandler{staffService: service}
+}
+
+func InitStaffAPI(router *gin.Engine, staffService *subservices.StaffService) {
+	handler := NewStaffHandler(staffService)
+	staffRoutes := router.Group("/admin/staff")
+	{
+		staffRoutes.GET("", handler.ListStaff)
+		staffRoutes.POST("", handler.CreateStaff)
+		staffRoutes.PATCH("/:user_id", handler.UpdateStaff)
+		staffRoutes.PATCH("/:user_id/role", handler.ChangeRole)
+		staffRoutes.PATCH("/:user_id/branch", handler.SetBranch)
+		staffRoutes.POST("/:user_id/disable", handler.DisableStaff)
+		staffRoutes.POST("/:user_id/enable", handler.EnableStaff)
+		staffRoutes.POST("/:user_id/reset-password", handler.ResetPassword)
+		staffRoutes.DELETE("/:user_id", handler.DeleteStaff)
+	}
+}
+
+func (h *StaffHandler) ListStaff(c *gin.Context) {
+	accounts, err := h.staffService.ListStaff()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch staff accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"staff": accounts})
+}
+
+func (h *StaffHandler) CreateStaff(c *gin.Context) {
+	var reqData struct {
+		Username string `form:"username" binding:"required"`
+		Email    string `form:"email" binding:"omitempty,email"`
+		Role     string `form:"role" binding:"required"`
+		BranchID *int   `form:"branch_id"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	account, err := h.staffService.CreateStaff(actorFromContext(c), reqData.Username, reqData.Email, reqData.Role, reqData.BranchID)
+	if err != nil {
+		respondStaffError(c, "Failed to create staff account", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Staff account created successfully", "account": account})
+}
+
+func (h *StaffHandler) UpdateStaff(c *gin.Context) {
+	userID, ok := staffUserID(c)
+	if !ok {
+		return
+	}
+
+	var reqData struct {
+		Username string `form:"username"`
+		Email    string `form:"email" binding:"omitempty,email"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	err := h.staffService.UpdateStaff(actorFromContext(c), userID, reqData.Username, reqData.Email)
+	if err != nil {
+		respondStaffError(c, "Failed to update staff account", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Staff account updated successfully"})
+}
+
+func (h *StaffHandler) ChangeRole(c *gin.Context) {
+	userID, ok := staffUserID(c)
+	if !ok {
+		return
+	}
+
+	var reqData struct {
+		Role string `form:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	err := h.staffService.ChangeStaffRole(actorFromContext(c), userID, reqData.Role)
+	if err != nil {
+		respondStaffError(c, "Failed to change role", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role changed successfully"})
+}
+
+// SetBranch assigns the branch an account works at; leaving branch_id out
+// clears it.
+func (h *StaffHandler) SetBranch(c *gin.Context) {
+	userID, ok := staffUserID(c)
+	if !ok {
+		return
+	}
+
+	var reqData struct {
+		BranchID *int `form:"branch_id"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	err := h.staffService.SetStaffBranch(actorFromContext(c), userID, reqData.BranchID)
+	if err != nil {
+		respondStaffError(c, "Failed to set branch", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Branch set successfully"})
+}
+
+func (h *StaffHandler) DisableStaff(c *gin.Context) {
+	h.setActive(c, false)
+}
+
+func (h *StaffHandler) EnableStaff(c *gin.Context) {
+	h.setActive(c, true)
+}
+
+func (h *StaffHandler) setActive(c *gin.Context, active bool) {
+	userID, ok := staffUserID(c)
+	if !ok {
+		return
+	}
+
+	err := h.staffService.SetStaffActive(actorFromContext(c), userID, active)
+	if err != nil {
+		respondStaffError(c, "Failed to update staff account", err)
+		return
+	}
+
+	if active {
+		c.JSON(http.StatusOK, gin.H{"message": "Staff account enabled"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Staff account disabled"})
+}
+
+func (h *StaffHandler) ResetPassword(c *gin.Context) {
+	userID, ok := staffUserID(c)
+	if !ok {
+		return
+	}
+
+	account, err := h.staffService.ResetStaffPassword(actorFromContext(c), userID)
+	if err != nil {
+		respondStaffError(c, "Failed to reset password", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully", "account": account})
+}
+
+func (h *StaffHandler) DeleteStaff(c *gin.Context) {
+	userID, ok := staffUserID(c)
+	if !ok {
+		return
+	}
+
+	err := h.staffService.DeleteStaff(actorFromContext(c), userID)
+	if err != nil {
+		respondStaffError(c, "Failed to delete staff account", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Staff account deleted successfully"})
+}
+
+func staffUserID(c *gin.Context) (int, bool) {
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	return userID, true
+}
+
+func respondStaffError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, subservices.ErrStaffNotFound), errors.Is(err, subservices.ErrBranchNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, subservices.ErrLastAdmin), errors.Is(err, subservices.ErrSelfAction):
+		status = http.StatusConflict
+	case errors.Is(err, subservices.ErrInvalidRole):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": message, "details": err.Error()})
+}
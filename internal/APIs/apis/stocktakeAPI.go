@@ -0,0 +1,165 @@
+package apis
+
+import (
+	"bufio"
+	"db_project2/internal/services/subservices"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stocktakeMaxUploadSize bounds one batch of scans; 5000 barcodes of up to
+// 50 characters fit with room to spare.
+const stocktakeMaxUploadSize = 1 << 20
+
+type StocktakeHandler struct {
+	libraryAgentService *subservices.LibraryAgentService
+}
+
+func NewStocktakeHandler(service *subservices.LibraryAgentService) *StocktakeHandler {
+	return &StocktakeHandler{libraryAgentService: service}
+}
+
+func InitStocktakeAPI(router *gin.Engine, agentService *subservices.LibraryAgentService) {
+	handler := NewStocktakeHandler(agentService)
+	stocktakeRoutes := router.Group("/library-agent/stocktakes")
+	{
+		stocktakeRoutes.POST("", handler.OpenStocktake)
+		stocktakeRoutes.GET("/:session_id", handler.GetStocktake)
+		stocktakeRoutes.POST("/:session_id/scans", handler.RecordScans)
+		stocktakeRoutes.POST("/:session_id/close", handler.CloseStocktake)
+	}
+}
+
+func (h *StocktakeHandler) OpenStocktake(c *gin.Context) {
+	var reqData struct {
+		LocationID int `form:"location_id" json:"location_id" binding:"required"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	session, err := h.libraryAgentService.OpenStocktake(actorFromContext(c), reqData.LocationID)
+	if err != nil {
+		respondStocktakeError(c, "Failed to open stocktake", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Stocktake opened successfully", "session": session})
+}
+
+func (h *StocktakeHandler) GetStocktake(c *gin.Context) {
+	sessionID, ok := stocktakeSessionID(c)
+	if !ok {
+		return
+	}
+
+	reconciliation, err := h.libraryAgentService.GetStocktake(sessionID)
+	if err != nil {
+		respondStocktakeError(c, "Failed to fetch stocktake", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, reconciliation)
+}
+
+// RecordScans takes barcodes as JSON {"barcodes": [...]}, as repeated
+// barcode form values, or as text/plain with one barcode per line, which is
+// what most handheld scanners upload.
+func (h *StocktakeHandler) RecordScans(c *gin.Context) {
+	sessionID, ok := stocktakeSessionID(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, stocktakeMaxUploadSize)
+
+	var barcodes []string
+	if c.ContentType() == "text/plain" {
+		scanner := bufio.NewScanner(c.Request.Body)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				barcodes = append(barcodes, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+			return
+		}
+	} else {
+		var reqData struct {
+			Barcodes []string `form:"barcode" json:"barcodes"`
+		}
+		if err := c.ShouldBind(&reqData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+			return
+		}
+		barcodes = reqData.Barcodes
+	}
+	if len(barcodes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": "at least one barcode is required"})
+		return
+	}
+
+	results, err := h.libraryAgentService.RecordStocktakeScans(sessionID, barcodes)
+	if err != nil {
+		respondStocktakeError(c, "Failed to record scans", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"scans": results})
+}
+
+// CloseStocktake ends the session; with mark_missing=true, copies expected
+// in the location but not scanned are set to missing.
+func (h *StocktakeHandler) CloseStocktake(c *gin.Context) {
+	sessionID, ok := stocktakeSessionID(c)
+	if !ok {
+		return
+	}
+
+	var reqData struct {
+		MarkMissing bool `form:"mark_missing" json:"mark_missing"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	reconciliation, err := h.libraryAgentService.CloseStocktake(actorFromContext(c), sessionID, reqData.MarkMissing)
+	if err != nil {
+		respondStocktakeError(c, "Failed to close stocktake", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, reconciliation)
+}
+
+func stocktakeSessionID(c *gin.Context) (int, bool) {
+	sessionID, err := strconv.Atoi(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stocktake session ID"})
+		return 0, false
+	}
+	return sessionID, true
+}
+
+func respondStocktakeError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, subservices.ErrStocktakeNotFound), errors.Is(err, subservices.ErrLocationNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, subservices.ErrStocktakeClosed), errors.Is(err, subservices.ErrStocktakeLocationBusy),
+		errors.Is(err, subservices.ErrInvalidCopyTransition):
+		status = http.StatusConflict
+	case errors.Is(err, subservices.ErrInvalidStocktake):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": message, "details": err.Error()})
+}
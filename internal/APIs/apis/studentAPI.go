@@ -2,28 +2,28 @@ package apis
 
 import (
 	"db_project2/internal/services/subservices"
-	"log"
 	"net/http"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
 type StudentHandler struct {
 	studentService *subservices.StudentService
+	authService    *subservices.AuthService
 }
 
-func NewStudentHandler(service *subservices.StudentService) *StudentHandler {
-	return &StudentHandler{studentService: service}
+func NewStudentHandler(service *subservices.StudentService, authService *subservices.AuthService) *StudentHandler {
+	return &StudentHandler{studentService: service, authService: authService}
 }
 
-func InitStudentAPI(router *gin.Engine, studentService *subservices.StudentService) {
-	handler := NewStudentHandler(studentService)
+func InitStudentAPI(router *gin.Engine, studentService *subservices.StudentService, authService *subservices.AuthService) {
+	handler := NewStudentHandler(studentService, authService)
 	studentRoutes := router.Group("/student")
 	{
 		studentRoutes.GET("/resources", handler.ListAvailableResources)
-		studentRoutes.POST("/loans", handler.ListLoans)
-		studentRoutes.PATCH("/update-password", handler.UpdatePassword)
+		studentRoutes.GET("/me/loans", handler.ListLoans)
+		studentRoutes.GET("/me/profile", handler.ViewProfile)
+		studentRoutes.PATCH("/me/password", handler.UpdatePassword)
 	}
 }
 
@@ -38,32 +38,43 @@ func (h *StudentHandler) ListAvailableResources(c *gin.Context) {
 }
 
 func (h *StudentHandler) ListLoans(c *gin.Context) {
-	studentIDStr := c.PostForm("student_id")
-	if studentIDStr == "" {
-		c.JSON(400, gin.H{"error": "student_id is required"})
+	studentID, ok := studentIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No student record is linked to this account"})
 		return
 	}
 
-	studentID, err := strconv.Atoi(studentIDStr)
+	loans, err := h.studentService.GetLoansByStudentID(studentID)
 	if err != nil {
-		c.JSON(400, gin.H{"error": "Invalid student_id"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch loans"})
 		return
 	}
 
-	loans, err := h.studentService.GetLoansByStudentID(studentID)
+	c.JSON(http.StatusOK, gin.H{"loans": loans})
+}
+
+func (h *StudentHandler) ViewProfile(c *gin.Context) {
+	studentID, ok := studentIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No student record is linked to this account"})
+		return
+	}
+
+	profile, err := h.studentService.ViewStudentProfile(studentID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch loans"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile", "details": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"loans": loans})
+	c.JSON(http.StatusOK, gin.H{"profile": profile})
 }
 
+// UpdatePassword is the student dashboard's route to the same password
+// change as PATCH /me/password.
 func (h *StudentHandler) UpdatePassword(c *gin.Context) {
 	var reqData struct {
 		OldPassword string `form:"old_password" binding:"required"`
 		NewPassword string `form:"new_password" binding:"required"`
-		StudentID   string `form:"student_id" binding:"required"`
 	}
 
 	if err := c.ShouldBind(&reqData); err != nil {
@@ -71,13 +82,13 @@ func (h *StudentHandler) UpdatePassword(c *gin.Context) {
 		return
 	}
 
-	studentIDInt, _ := strconv.Atoi(reqData.StudentID)
-
-	log.Println(reqData)
-
-	err := h.studentService.ChangePassword(studentIDInt, reqData.OldPassword, reqData.NewPassword)
+	err := h.authService.ChangePassword(actorFromContext(c).UserID, reqData.OldPassword, reqData.NewPassword)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		status := http.StatusInternalServerError
+		if subservices.IsPasswordPolicyError(err) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
 			"error":   "Failed to update password",
 			"details": err.Error(),
 		})
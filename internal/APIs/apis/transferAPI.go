@@ -0,0 +1,115 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TransferHandler struct {
+	libraryAgentService *subservices.LibraryAgentService
+}
+
+func NewTransferHandler(service *subservices.LibraryAgentService) *TransferHandler {
+	return &TransferHandler{libraryAgentService: service}
+}
+
+func InitTransferAPI(router *gin.Engine, agentService *subservices.LibraryAgentService) {
+	handler := NewTransferHandler(agentService)
+	transferRoutes := router.Group("/library-agent/transfers")
+	{
+		transferRoutes.GET("", handler.ListTransfers)
+		transferRoutes.POST("", handler.SendTransfer)
+		transferRoutes.POST("/:transfer_id/receive", handler.ReceiveTransfer)
+	}
+}
+
+// ListTransfers shows what is in transit to or from the staff member's
+// branch; branch_id=0 covers every branch and status=all includes
+// finished transfers.
+func (h *TransferHandler) ListTransfers(c *gin.Context) {
+	var reqData struct {
+		BranchID *int   `form:"branch_id"`
+		Status   string `form:"status"`
+	}
+
+	if err := c.ShouldBindQuery(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	transfers, err := h.libraryAgentService.ListTransfers(actorFromContext(c), reqData.BranchID, reqData.Status)
+	if err != nil {
+		respondTransferError(c, "Failed to list transfers", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"transfers": transfers})
+}
+
+// SendTransfer ships the copies given as repeated copy_id values to
+// to_branch_id.
+func (h *TransferHandler) SendTransfer(c *gin.Context) {
+	var reqData struct {
+		CopyIDs    []int  `form:"copy_id" json:"copy_ids" binding:"required"`
+		ToBranchID int    `form:"to_branch_id" json:"to_branch_id" binding:"required"`
+		Reason     string `form:"reason" json:"reason"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	transfers, err := h.libraryAgentService.SendTransfer(actorFromContext(c), reqData.CopyIDs, reqData.ToBranchID, reqData.Reason)
+	if err != nil {
+		respondTransferError(c, "Failed to send transfer", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Copies sent successfully", "transfers": transfers})
+}
+
+// ReceiveTransfer books a copy in; location_id is where it gets shelved.
+func (h *TransferHandler) ReceiveTransfer(c *gin.Context) {
+	transferID, err := strconv.Atoi(c.Param("transfer_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transfer ID"})
+		return
+	}
+
+	var reqData struct {
+		LocationID *int `form:"location_id" json:"location_id"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	transfer, err := h.libraryAgentService.ReceiveTransfer(actorFromContext(c), transferID, reqData.LocationID)
+	if err != nil {
+		respondTransferError(c, "Failed to receive transfer", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer received successfully", "transfer": transfer})
+}
+
+func respondTransferError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, subservices.ErrTransferNotFound), errors.Is(err, subservices.ErrBranchNotFound),
+		errors.Is(err, subservices.ErrCopyNotFound), errors.Is(err, subservices.ErrLocationNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, subservices.ErrTransferNotOpen), errors.Is(err, subservices.ErrWrongBranch),
+		errors.Is(err, subservices.ErrCopyElsewhere), errors.Is(err, subservices.ErrInvalidCopyTransition):
+		status = http.StatusConflict
+	case errors.Is(err, subservices.ErrInvalidTransfer), errors.Is(err, subservices.ErrInvalidLocation):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": message, "details": err.Error()})
+}
@@ -0,0 +1,139 @@
+package apis
+
+import (
+	"db_project2/internal/services/subservices"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TwoFactorHandler struct {
+	twoFactorService *subservices.TwoFactorService
+}
+
+func NewTwoFactorHandler(service *subservices.TwoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{twoFactorService: service}
+}
+
+func InitTwoFactorAPI(router *gin.Engine, twoFactorService *subservices.TwoFactorService) {
+	handler := NewTwoFactorHandler(twoFactorService)
+	twoFactorRoutes := router.Group("/me/2fa")
+	{
+		twoFactorRoutes.GET("", handler.GetStatus)
+		twoFactorRoutes.POST("/setup", handler.BeginEnrollment)
+		twoFactorRoutes.POST("/confirm", handler.ConfirmEnrollment)
+		twoFactorRoutes.POST("/disable", handler.Disable)
+		twoFactorRoutes.POST("/recovery-codes", handler.RegenerateRecoveryCodes)
+	}
+	router.POST("/admin/staff/:user_id/reset-2fa", handler.ResetForUser)
+}
+
+func (h *TwoFactorHandler) GetStatus(c *gin.Context) {
+	status, err := h.twoFactorService.GetStatus(actorFromContext(c))
+	if err != nil {
+		respondTwoFactorError(c, "Failed to fetch two-factor status", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// BeginEnrollment returns the secret and the otpauth:// URI; clients render
+// the URI as a QR code for the authenticator app to scan.
+func (h *TwoFactorHandler) BeginEnrollment(c *gin.Context) {
+	enrollment, err := h.twoFactorService.BeginEnrollment(actorFromContext(c))
+	if err != nil {
+		respondTwoFactorError(c, "Failed to start two-factor setup", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+func (h *TwoFactorHandler) ConfirmEnrollment(c *gin.Context) {
+	code, ok := twoFactorCode(c)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := h.twoFactorService.ConfirmEnrollment(actorFromContext(c), code)
+	if err != nil {
+		respondTwoFactorError(c, "Failed to enable two-factor authentication", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication enabled", "recovery_codes": recoveryCodes})
+}
+
+func (h *TwoFactorHandler) Disable(c *gin.Context) {
+	code, ok := twoFactorCode(c)
+	if !ok {
+		return
+	}
+
+	err := h.twoFactorService.Disable(actorFromContext(c), code)
+	if err != nil {
+		respondTwoFactorError(c, "Failed to disable two-factor authentication", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	code, ok := twoFactorCode(c)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := h.twoFactorService.RegenerateRecoveryCodes(actorFromContext(c), code)
+	if err != nil {
+		respondTwoFactorError(c, "Failed to regenerate recovery codes", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recovery codes regenerated", "recovery_codes": recoveryCodes})
+}
+
+func (h *TwoFactorHandler) ResetForUser(c *gin.Context) {
+	userID, ok := staffUserID(c)
+	if !ok {
+		return
+	}
+
+	err := h.twoFactorService.ResetForUser(actorFromContext(c), userID)
+	if err != nil {
+		respondTwoFactorError(c, "Failed to reset two-factor authentication", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset successfully"})
+}
+
+func twoFactorCode(c *gin.Context) (string, bool) {
+	var reqData struct {
+		Code string `form:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBind(&reqData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return "", false
+	}
+	return reqData.Code, true
+}
+
+func respondTwoFactorError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, subservices.ErrStaffNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, subservices.ErrInvalidTwoFactorCode):
+		status = http.StatusUnauthorized
+	case errors.Is(err, subservices.ErrTwoFactorStaffOnly), errors.Is(err, subservices.ErrTwoFactorRequired):
+		status = http.StatusForbidden
+	case errors.Is(err, subservices.ErrTwoFactorAlreadyEnabled), errors.Is(err, subservices.ErrTwoFactorNotEnrolled):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{"error": message, "details": err.Error()})
+}
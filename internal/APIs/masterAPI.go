@@ -3,12 +3,36 @@ package API
 import (
 	apis "db_project2/internal/APIs/apis"
 	services "db_project2/internal/services"
+	"log"
+
 	"github.com/gin-gonic/gin"
 )
 
 func InitAPI(router *gin.Engine) {
+	registerRoutes(router)
+
+	if err := apis.VerifyRoutePermissions(router.Routes()); err != nil {
+		log.Fatalf("Permission matrix is incomplete: %v", err)
+	}
+}
+
+func registerRoutes(router *gin.Engine) {
+	apis.InitHomeAPI(router, services.AuthServiceInstance, services.LoginThrottleServiceInstance, services.TwoFactorServiceInstance, services.APIKeyServiceInstance, services.OIDCServiceInstance.Enabled())
 	apis.InitAdministratorAPI(router, services.AdministratorServiceInstance)
+	apis.InitCardAPI(router, services.AdministratorServiceInstance)
+	apis.InitCopyAPI(router, services.AdministratorServiceInstance)
+	apis.InitLocationAPI(router, services.AdministratorServiceInstance)
+	apis.InitBranchAPI(router, services.AdministratorServiceInstance)
+	apis.InitCatalogAPI(router, services.CatalogServiceInstance)
 	apis.InitLibraryAgentAPI(router, services.LibraryAgentServiceInstance)
-	apis.InitStudentAPI(router, services.StudentServiceInstance)
-	apis.InitHomeAPI(router, services.AuthServiceInstance)
-}
\ No newline at end of file
+	apis.InitStocktakeAPI(router, services.LibraryAgentServiceInstance)
+	apis.InitTransferAPI(router, services.LibraryAgentServiceInstance)
+	apis.InitStudentAPI(router, services.StudentServiceInstance, services.AuthServiceInstance)
+	apis.InitSecurityAPI(router, services.LoginThrottleServiceInstance)
+	apis.InitPasswordResetAPI(router, services.PasswordResetServiceInstance)
+	apis.InitStaffAPI(router, services.StaffServiceInstance)
+	apis.InitTwoFactorAPI(router, services.TwoFactorServiceInstance)
+	apis.InitAPIKeyAPI(router, services.APIKeyServiceInstance)
+	apis.InitSessionAPI(router, services.AuthServiceInstance)
+	apis.InitOIDCAPI(router, services.OIDCServiceInstance, services.AuthServiceInstance, services.TwoFactorServiceInstance)
+}
@@ -0,0 +1,66 @@
+package API
+
+import (
+	apis "db_project2/internal/APIs/apis"
+	services "db_project2/internal/services"
+	"db_project2/internal/services/subservices"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRouter registers every route against nil services, which is
+// enough to inspect the routing table. Templates are loaded relative to the
+// repository root.
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("../.."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if services.OIDCServiceInstance == nil {
+		services.OIDCServiceInstance = subservices.NewOIDCServiceInstance(nil, subservices.OIDCConfig{})
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	registerRoutes(router)
+	return router
+}
+
+func TestEveryRouteHasPermissionEntry(t *testing.T) {
+	router := newTestRouter(t)
+
+	if err := apis.VerifyRoutePermissions(router.Routes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRouteWithoutPermissionEntryIsRejected(t *testing.T) {
+	router := newTestRouter(t)
+	router.GET("/admin/unlisted", func(c *gin.Context) {})
+
+	err := apis.VerifyRoutePermissions(router.Routes())
+	if err == nil {
+		t.Fatal("expected an error for a route missing from the permission matrix")
+	}
+	if !strings.Contains(err.Error(), "GET /admin/unlisted") {
+		t.Fatalf("error does not name the route: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/unlisted", nil))
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("AuthMiddleware returned %d for a route without an entry, want %d", recorder.Code, http.StatusForbidden)
+	}
+}
@@ -2,7 +2,9 @@ package services
 
 import (
 	subservices "db_project2/internal/services/subservices"
+	"db_project2/pkg/mailer"
 
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -11,11 +13,39 @@ var (
     LibraryAgentServiceInstance *subservices.LibraryAgentService
     AdministratorServiceInstance *subservices.AdministratorService
 	AuthServiceInstance *subservices.AuthService
+	LoginThrottleServiceInstance *subservices.LoginThrottleService
+	PasswordResetServiceInstance *subservices.PasswordResetService
+	StaffServiceInstance *subservices.StaffService
+	TwoFactorServiceInstance *subservices.TwoFactorService
+	APIKeyServiceInstance *subservices.APIKeyService
+	OIDCServiceInstance *subservices.OIDCService
+	CatalogServiceInstance *subservices.CatalogService
 )
 
-func InitServices(db *gorm.DB) {
+type Config struct {
+	Auth           subservices.AuthConfig
+	Lockout        subservices.LockoutConfig
+	PasswordPolicy subservices.PasswordPolicyConfig
+	PasswordReset  subservices.PasswordResetConfig
+	TwoFactor      subservices.TwoFactorConfig
+	OIDC           subservices.OIDCConfig
+	Cards          subservices.CardConfig
+	Mailer         mailer.Mailer
+}
+
+func InitServices(db *gorm.DB, config Config) {
+	hasher := subservices.NewBcryptHasher(bcrypt.DefaultCost)
+	policy := subservices.NewPasswordPolicy(config.PasswordPolicy, hasher)
+
 	StudentServiceInstance = subservices.NewStudentServiceInstance(db)
 	LibraryAgentServiceInstance = subservices.NewLibraryAgentServiceInstance(db)
-	AdministratorServiceInstance = subservices.NewAdministratorServiceInstance(db)
-	AuthServiceInstance = subservices.NewAuthServiceInstance(db)
+	AdministratorServiceInstance = subservices.NewAdministratorServiceInstance(db, policy, config.Cards)
+	AuthServiceInstance = subservices.NewAuthServiceInstance(db, hasher, policy, config.Auth)
+	LoginThrottleServiceInstance = subservices.NewLoginThrottleServiceInstance(db, config.Lockout)
+	PasswordResetServiceInstance = subservices.NewPasswordResetServiceInstance(db, policy, config.Mailer, config.PasswordReset)
+	StaffServiceInstance = subservices.NewStaffServiceInstance(db, policy)
+	TwoFactorServiceInstance = subservices.NewTwoFactorServiceInstance(db, config.TwoFactor)
+	APIKeyServiceInstance = subservices.NewAPIKeyServiceInstance(db)
+	OIDCServiceInstance = subservices.NewOIDCServiceInstance(db, config.OIDC)
+	CatalogServiceInstance = subservices.NewCatalogServiceInstance(db)
 } 
\ No newline at end of file
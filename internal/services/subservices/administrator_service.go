@@ -2,107 +2,179 @@ package subservices
 
 import (
 	"fmt"
-	"log"
-	"time"
+	"strings"
 
 	"gorm.io/gorm"
 )
 
 type AdministratorService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	policy *PasswordPolicy
+	cards  CardConfig
 }
 
-func NewAdministratorServiceInstance(db *gorm.DB) *AdministratorService {
-	return &AdministratorService{db: db}
+func NewAdministratorServiceInstance(db *gorm.DB, policy *PasswordPolicy, cards CardConfig) *AdministratorService {
+	return &AdministratorService{db: db, policy: policy, cards: cards}
 }
 
-func (a *AdministratorService) AddResource(bookCode, rack, barcode string, price float64, purchaseDate string) error {
+// NewAccount is returned when staff create a login on someone's behalf. The
+// temporary password is shown once and must be changed at first login.
+type NewAccount struct {
+	Username          string `json:"username"`
+	TemporaryPassword string `json:"temporary_password"`
+}
+
+func (a *AdministratorService) AddResource(actor Actor, bookCode string, locationID int, barcode string, price float64, purchaseDate string) error {
 	if price < 0 {
 		return fmt.Errorf("price cannot be negative")
 	}
+	bookCode = lookupBookCode(bookCode)
+
+	var exists bool
+	err := a.db.Table("book").Select("COUNT(*) > 0").Where("book_code = ?", bookCode).Find(&exists).Error
+	if err != nil {
+		return fmt.Errorf("failed to check book_code: %w", err)
+	}
+	if !exists {
+		if _, err := NormalizeBookCode(bookCode); err != nil {
+			return err
+		}
+		return ErrBookNotFound
+	}
+
+	tx := a.db.Begin()
+
+	// The copy belongs to the branch it is shelved in.
+	location, err := lookupLocation(tx, locationID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 
-	err := a.db.Table("book_copy").Create(map[string]interface{}{
-		"book_code":     bookCode,
-		"rack_number":   rack,
-		"barcode":       barcode,
-		"price":         price,
-		"purchase_date": purchaseDate,
-		"is_available":  true,
-	}).Error
+	var copyID int
+	err = tx.Raw(`
+		INSERT INTO book_copy (book_code, branch_id, location_id, barcode, price, purchase_date, status, status_changed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NOW())
+		RETURNING copy_id
+	`, bookCode, location.BranchID, locationID, barcode, price, purchaseDate, CopyAvailable).Scan(&copyID).Error
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("failed to add resource: %w", err)
 	}
 
-	return nil
+	if err := recordCopyStatus(tx, actor, copyID, nil, CopyAvailable, "added to stock"); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordCopyLocation(tx, actor, copyID, nil, locationID, "added to stock"); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
 }
 
-func (a *AdministratorService) ActivateCard(studentID int) error {
-	result := a.db.Exec("CALL toggle_card_status(?)", studentID)
-	if result.Error != nil {
-		return fmt.Errorf("failed to toggle card status for student_id %d: %w", studentID, result.Error)
+func (a *AdministratorService) CreateStudentWithCard(actor Actor, firstname, lastname, email, phone, postalAddress string) (*NewAccount, error) {
+	tx := a.db.Begin()
+
+	account, _, err := a.createStudentWithCard(tx, actor, StudentInput{
+		FirstName:     firstname,
+		LastName:      lastname,
+		Email:         email,
+		Phone:         phone,
+		PostalAddress: postalAddress,
+	}, true)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
 	}
 
-	log.Printf("Successfully toggled library card status for student_id %d", studentID)
-	return nil
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return account, nil
 }
 
-func (a *AdministratorService) CreateStudentWithCard(firstname, lastname, email, phone, postalAddress string) error {
-	tx := a.db.Begin()
+type StudentInput struct {
+	FirstName     string
+	LastName      string
+	Email         string
+	Phone         string
+	PostalAddress string
+}
 
+// createStudentWithCard creates the student, their library card and a
+// "User" login with a temporary password inside the caller's transaction.
+func (a *AdministratorService) createStudentWithCard(tx *gorm.DB, actor Actor, input StudentInput, cardActive bool) (*NewAccount, int, error) {
 	var studentID int
-	err := tx.Table("student").Create(map[string]interface{}{
-		"first_name":     firstname,
-		"last_name":      lastname,
-		"email":          email,
-		"phone":          phone,
-		"postal_address": postalAddress,
-	}).Error
+	err := tx.Raw(`
+		INSERT INTO student (first_name, last_name, email, phone, postal_address)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING student_id
+	`, input.FirstName, input.LastName, input.Email, input.Phone, input.PostalAddress).Scan(&studentID).Error
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to create student: %w", err)
+		return nil, 0, fmt.Errorf("failed to create student: %w", err)
 	}
 
-	err = tx.Table("student").Select("student_id").Where("email = ?", email).Scan(&studentID).Error
-	if err != nil || studentID == 0 {
-		tx.Rollback()
-		return fmt.Errorf("failed to fetch student_id: %w", err)
+	cardStatus := CardActive
+	if !cardActive {
+		cardStatus = CardSuspended
+	}
+	if _, err := a.issueCard(tx, actor, studentID, cardStatus, "issued at enrollment"); err != nil {
+		return nil, 0, err
 	}
 
+	username, err := uniqueUsername(tx, fmt.Sprintf("%s.%s", input.FirstName, input.LastName))
+	if err != nil {
+		return nil, 0, err
+	}
 
-	var resourceID int
-	err = tx.Table("resource").Select("resource_id").Where("resource_type = ?", "Book").Scan(&resourceID).Error
+	temporaryPassword, err := a.policy.GenerateTemporaryPassword()
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to fetch resource ID for 'Book': %w", err)
+		return nil, 0, fmt.Errorf("failed to generate temporary password: %w", err)
 	}
 
-	err = tx.Table("librarycard").Create(map[string]interface{}{
-		"student_id":      studentID,
-		"activation_date": time.Now(),
-		"status":          true,
-		"resource_id":     resourceID, 
-	}).Error
+	var userID int
+	err = tx.Raw(`
+		INSERT INTO "User" (username, password, user_role, student_id, must_change_password)
+		VALUES (?, '', 'Student', ?, TRUE)
+		RETURNING user_id
+	`, username, studentID).Scan(&userID).Error
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to create library card: %w", err)
+		return nil, 0, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	if err := a.policy.SetPassword(tx, userID, temporaryPassword, true); err != nil {
+		return nil, 0, err
+	}
+
+	if err := recordAudit(tx, actor, studentID, "create_student", username); err != nil {
+		return nil, 0, err
 	}
 
-	username := fmt.Sprintf("%s.%s", firstname, lastname)
-	password := "default_password"
-	err = tx.Table("User").Create(map[string]interface{}{
-		"username":   username,
-		"password":   password,
-		"user_role":  "Student",
-		"student_id": studentID,
-	}).Error
+	return &NewAccount{Username: username, TemporaryPassword: temporaryPassword}, studentID, nil
+}
+
+// uniqueUsername returns base, or base with the lowest free numeric suffix
+// when two students share a name.
+func uniqueUsername(tx *gorm.DB, base string) (string, error) {
+	var taken []string
+	err := tx.Table("User").
+		Where("LOWER(username) LIKE ?", strings.ToLower(base)+"%").
+		Pluck("LOWER(username)", &taken).Error
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to create user: %w", err)
+		return "", fmt.Errorf("failed to check username: %w", err)
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	used := map[string]bool{}
+	for _, name := range taken {
+		used[name] = true
 	}
 
-	return nil
+	username := base
+	for i := 2; used[strings.ToLower(username)]; i++ {
+		username = fmt.Sprintf("%s%d", base, i)
+	}
+	return username, nil
 }
@@ -0,0 +1,338 @@
+package subservices
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// API key scopes. Each scoped route in the permission matrix names one of
+// these; a key can only call routes whose scope it was granted.
+const (
+	ScopeAssignResource     = "assign-resource"
+	ScopeReturnResource     = "return-resource"
+	ScopeViewLoans          = "view-loans"
+	ScopeViewBooks          = "view-books"
+	ScopeViewStudentProfile = "view-student-profile"
+	ScopeCreateStudent      = "create-student"
+	ScopeAddResource        = "add-resource"
+	ScopeStocktake          = "stocktake"
+)
+
+var APIKeyScopes = []string{
+	ScopeAssignResource,
+	ScopeReturnResource,
+	ScopeViewLoans,
+	ScopeViewBooks,
+	ScopeViewStudentProfile,
+	ScopeCreateStudent,
+	ScopeAddResource,
+	ScopeStocktake,
+}
+
+const apiKeyPrefix = "lk_"
+
+var (
+	ErrAPIKeyNotFound  = errors.New("api key not found")
+	ErrInvalidScope    = errors.New("unknown api key scope")
+	ErrInvalidIPFilter = errors.New("allowed IPs must be IP addresses or CIDR ranges")
+	ErrInvalidExpiry   = errors.New("expiry must be in the future")
+)
+
+type APIKey struct {
+	KeyID      int        `json:"key_id"`
+	Name       string     `json:"name"`
+	KeyPrefix  string     `json:"key_prefix"`
+	Scopes     []string   `json:"scopes" gorm:"-"`
+	AllowedIPs []string   `json:"allowed_ips" gorm:"-"`
+	CreatedBy  *int       `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RotatedAt  *time.Time `json:"rotated_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP *string    `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+
+	ScopeList     string `json:"-" gorm:"column:scopes"`
+	AllowedIPList string `json:"-" gorm:"column:allowed_ips"`
+}
+
+// NewAPIKey carries the plaintext key. It is returned once on creation or
+// rotation and never stored.
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *APIKey) allowsIP(ipAddress string) bool {
+	if len(k.AllowedIPs) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return false
+	}
+	for _, allowed := range k.AllowedIPs {
+		if _, network, err := net.ParseCIDR(allowed); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyService manages keys for kiosks and integrations. Only the SHA-256
+// digest of a key is stored; key_prefix is kept so admins can tell keys apart.
+type APIKeyService struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyServiceInstance(db *gorm.DB) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+func (a *APIKeyService) ListKeys() ([]APIKey, error) {
+	var keys []APIKey
+	err := a.db.Table("api_key").Order("key_id").Scan(&keys).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+
+	for i := range keys {
+		keys[i].splitLists()
+	}
+	return keys, nil
+}
+
+func (a *APIKeyService) CreateKey(actor Actor, name string, scopes []string, expiresAt *time.Time, allowedIPs []string) (*NewAPIKey, error) {
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+	allowedIPs, err = normalizeAllowedIPs(allowedIPs)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := a.db.Begin()
+
+	var created APIKey
+	err = tx.Raw(`
+		INSERT INTO api_key (name, key_hash, key_prefix, scopes, allowed_ips, created_by, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING *
+	`, strings.TrimSpace(name), hashSessionToken(key), apiKeyDisplayPrefix(key),
+		strings.Join(scopes, ","), strings.Join(allowedIPs, ","), actor.UserID, expiresAt).Scan(&created).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	details := fmt.Sprintf("key_id %d (%s) scopes %s", created.KeyID, created.Name, strings.Join(scopes, ","))
+	if err := recordAudit(tx, actor, 0, "create_api_key", details); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	created.splitLists()
+	return &NewAPIKey{APIKey: created, Key: key}, nil
+}
+
+// RotateKey replaces the secret of a key and keeps its ID, scopes and
+// limits, so audit history stays attached to the same key. The old secret
+// stops working immediately.
+func (a *APIKeyService) RotateKey(actor Actor, keyID int) (*NewAPIKey, error) {
+	key, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := a.db.Begin()
+
+	var rotated APIKey
+	err = tx.Raw(`
+		UPDATE api_key
+		SET key_hash = ?, key_prefix = ?, rotated_at = NOW()
+		WHERE key_id = ? AND revoked_at IS NULL
+		RETURNING *
+	`, hashSessionToken(key), apiKeyDisplayPrefix(key), keyID).Scan(&rotated).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to rotate api key: %w", err)
+	}
+	if rotated.KeyID == 0 {
+		tx.Rollback()
+		return nil, ErrAPIKeyNotFound
+	}
+
+	if err := recordAudit(tx, actor, 0, "rotate_api_key", fmt.Sprintf("key_id %d", keyID)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	rotated.splitLists()
+	return &NewAPIKey{APIKey: rotated, Key: key}, nil
+}
+
+func (a *APIKeyService) RevokeKey(actor Actor, keyID int) error {
+	tx := a.db.Begin()
+
+	result := tx.Table("api_key").
+		Where("key_id = ? AND revoked_at IS NULL", keyID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to revoke api key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return ErrAPIKeyNotFound
+	}
+
+	if err := recordAudit(tx, actor, 0, "revoke_api_key", fmt.Sprintf("key_id %d", keyID)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Authenticate resolves a presented key. Revoked and expired keys, and
+// requests from outside the key's IP allow-list, are all reported as missing.
+func (a *APIKeyService) Authenticate(key, ipAddress string) (*APIKey, bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, false
+	}
+
+	var stored APIKey
+	err := a.db.Table("api_key").
+		Where("key_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())", hashSessionToken(key)).
+		Scan(&stored).Error
+	if err != nil {
+		log.Printf("Failed to look up api key: %v", err)
+		return nil, false
+	}
+	if stored.KeyID == 0 {
+		return nil, false
+	}
+
+	stored.splitLists()
+	if !stored.allowsIP(ipAddress) {
+		log.Printf("API key %d used from disallowed address %s", stored.KeyID, ipAddress)
+		return nil, false
+	}
+
+	err = a.db.Table("api_key").Where("key_id = ?", stored.KeyID).Updates(map[string]interface{}{
+		"last_used_at": time.Now(),
+		"last_used_ip": ipAddress,
+	}).Error
+	if err != nil {
+		log.Printf("Failed to record api key usage: %v", err)
+	}
+
+	return &stored, true
+}
+
+func (k *APIKey) splitLists() {
+	k.Scopes = splitList(k.ScopeList)
+	k.AllowedIPs = splitList(k.AllowedIPList)
+}
+
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func normalizeScopes(scopes []string) ([]string, error) {
+	seen := map[string]bool{}
+	var normalized []string
+	for _, scope := range scopes {
+		for _, item := range splitList(scope) {
+			valid := false
+			for _, known := range APIKeyScopes {
+				if item == known {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidScope, item)
+			}
+			if !seen[item] {
+				seen[item] = true
+				normalized = append(normalized, item)
+			}
+		}
+	}
+
+	if len(normalized) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	return normalized, nil
+}
+
+func normalizeAllowedIPs(allowedIPs []string) ([]string, error) {
+	var normalized []string
+	for _, entry := range allowedIPs {
+		for _, item := range splitList(entry) {
+			if _, _, err := net.ParseCIDR(item); err != nil && net.ParseIP(item) == nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidIPFilter, item)
+			}
+			normalized = append(normalized, item)
+		}
+	}
+	return normalized, nil
+}
+
+func generateAPIKey() (string, error) {
+	token, err := generateToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	return apiKeyPrefix + token, nil
+}
+
+func apiKeyDisplayPrefix(key string) string {
+	return key[:len(apiKeyPrefix)+8]
+}
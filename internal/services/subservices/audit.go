@@ -0,0 +1,38 @@
+package subservices
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Actor identifies who performed an action, as resolved by the auth layer.
+// Requests made with an API key carry the key ID and no user.
+type Actor struct {
+	UserID   int
+	APIKeyID int
+}
+
+// recordAudit stores who acted on which student. It takes the caller's
+// transaction so the audit row commits or rolls back with the change itself.
+func recordAudit(db *gorm.DB, actor Actor, studentID int, action, details string) error {
+	entry := map[string]interface{}{
+		"action":  action,
+		"details": details,
+	}
+	if actor.UserID != 0 {
+		entry["actor_user_id"] = actor.UserID
+	}
+	if actor.APIKeyID != 0 {
+		entry["api_key_id"] = actor.APIKeyID
+	}
+	if studentID != 0 {
+		entry["target_student_id"] = studentID
+	}
+
+	err := db.Table("audit_log").Create(entry).Error
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
@@ -1,57 +1,255 @@
 package subservices
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
-	"sync"
+	"fmt"
+	"log"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+const (
+	AuthModeSession = "session"
+	AuthModeJWT     = "jwt"
+	AuthModeBoth    = "both"
+)
+
+type AuthConfig struct {
+	Mode               string
+	SessionAbsoluteTTL time.Duration
+	SessionIdleTimeout time.Duration
+	JWTSecret          []byte
+	JWTIssuer          string
+	AccessTokenTTL     time.Duration
+	RefreshTokenTTL    time.Duration
+}
+
 type AuthService struct {
-	sessions sync.Map
-	db       *gorm.DB
+	db     *gorm.DB
+	hasher PasswordHasher
+	policy *PasswordPolicy
+	config AuthConfig
 }
 
-func NewAuthServiceInstance(database *gorm.DB) *AuthService {
-	return &AuthService{db: database, sessions: sync.Map{}}
+func NewAuthServiceInstance(database *gorm.DB, hasher PasswordHasher, policy *PasswordPolicy, config AuthConfig) *AuthService {
+	return &AuthService{db: database, hasher: hasher, policy: policy, config: config}
 }
 
 type User struct {
-	UserID    int    `gorm:"primaryKey"`
-	Username  string `gorm:"unique"`
-	Password  string
-	UserRole  string `gorm:"check:user_role IN ('Admin', 'LibraryAgent', 'Student')"`
-	StudentID int   `gorm:"foreignKey:StudentID"`
+	UserID             int    `gorm:"primaryKey"`
+	Username           string `gorm:"unique"`
+	Password           string
+	UserRole           string `gorm:"check:user_role IN ('Admin', 'LibraryAgent', 'Student')"`
+	StudentID          int    `gorm:"foreignKey:StudentID"`
+	MustChangePassword bool
+	IsActive           bool
+	TOTPEnabled        bool `gorm:"column:totp_enabled"`
 }
 
-func (a *AuthService) ValidateCredentials(username, password string) (string, int, error) {
+// legacyDefaultPassword is the shared password accounts used to be given.
+const legacyDefaultPassword = "default_password"
+
+var (
+	ErrAccountDisabled    = errors.New("account is disabled")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+func (a *AuthService) ValidateCredentials(username, password string) (*User, error) {
 	var user User
-	err := a.db.Table("User").Where("username = ? AND password = ?", username, password).First(&user).Error
+	err := a.db.Table("User").Where("username = ?", username).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", 0, errors.New("invalid credentials")
+			return nil, ErrInvalidCredentials
 		}
-		return "",0, errors.New("database error: " + err.Error())
+		return nil, errors.New("database error: " + err.Error())
+	}
+
+	ok, err := a.hasher.Verify(user.Password, password)
+	if err != nil {
+		return nil, errors.New("database error: " + err.Error())
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	if !user.IsActive {
+		return nil, ErrAccountDisabled
+	}
+
+	if a.hasher.NeedsRehash(user.Password) {
+		a.upgradePasswordHash(user.UserID, password)
+	}
+
+	// Migration 07 could only flag accounts that still stored the shared
+	// default in plaintext; those already rehashed are caught here.
+	if password == legacyDefaultPassword && !user.MustChangePassword {
+		a.requirePasswordChange(user.UserID)
+		user.MustChangePassword = true
+	}
+
+	return &user, nil
+}
+
+// ChangePassword lets any authenticated user replace their own password.
+// It is the one endpoint still reachable while must_change_password is set.
+func (a *AuthService) ChangePassword(userID int, oldPassword, newPassword string) error {
+	var storedPassword string
+	err := a.db.Table("User").Select("password").Where("user_id = ?", userID).Scan(&storedPassword).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch stored password: %w", err)
+	}
+
+	ok, err := a.hasher.Verify(storedPassword, oldPassword)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("old password does not match")
+	}
+
+	tx := a.db.Begin()
+	if err := a.policy.SetPassword(tx, userID, newPassword, false); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// upgradePasswordHash rewrites legacy plaintext (or outdated) hashes after a
+// successful login. Failures are logged only, the login itself already succeeded.
+func (a *AuthService) upgradePasswordHash(userID int, password string) {
+	hash, err := a.hasher.Hash(password)
+	if err != nil {
+		log.Printf("Failed to rehash password for user_id %d: %v", userID, err)
+		return
 	}
-	return user.UserRole, user.StudentID, nil
+
+	err = a.db.Table("User").Where("user_id = ?", userID).Update("password", hash).Error
+	if err != nil {
+		log.Printf("Failed to store rehashed password for user_id %d: %v", userID, err)
+		return
+	}
+
+	log.Printf("Upgraded password hash for user_id %d", userID)
+}
+
+func (a *AuthService) requirePasswordChange(userID int) {
+	err := a.db.Table("User").Where("user_id = ?", userID).Update("must_change_password", true).Error
+	if err != nil {
+		log.Printf("Failed to flag default password for user_id %d: %v", userID, err)
+		return
+	}
+
+	log.Printf("Flagged user_id %d for a password change: still on the default password", userID)
 }
 
+// CreateSession issues a random opaque token. Only its SHA-256 digest is
+// persisted, so a leaked session table cannot be replayed.
+func (a *AuthService) CreateSession(userID int, role, ipAddress, userAgent string) (string, error) {
+	token, err := generateToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate session token: %w", err)
+	}
+
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	now := time.Now()
+	err = a.db.Table("session").Create(map[string]interface{}{
+		"token_hash":   hashSessionToken(token),
+		"user_id":      userID,
+		"user_role":    role,
+		"ip_address":   ipAddress,
+		"user_agent":   userAgent,
+		"created_at":   now,
+		"last_used_at": now,
+		"expires_at":   now.Add(a.config.SessionAbsoluteTTL),
+	}).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	a.purgeExpiredSessions()
 
-func (a *AuthService) CreateSession(username, role string) string {
-	token := username + "_token"
-	a.sessions.Store(token, role)
-	return token
+	return token, nil
 }
 
 func (a *AuthService) InvalidateSession(token string) {
-	a.sessions.Delete(token)
+	err := a.db.Table("session").
+		Where("token_hash = ? AND revoked_at IS NULL", hashSessionToken(token)).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		log.Printf("Failed to invalidate session: %v", err)
+	}
 }
 
+type Session struct {
+	SessionID          int
+	UserID             int
+	UserRole           string
+	StudentID          int
+	MustChangePassword bool
+	TOTPEnabled        bool `gorm:"column:totp_enabled"`
+	// FamilyID is set for JWT logins instead of SessionID.
+	FamilyID string `gorm:"-"`
+}
+
+// GetSession resolves a token to its owner and slides the idle window
+// forward. Revoked, expired and idle sessions are all reported as missing.
+func (a *AuthService) GetSession(token string) (*Session, bool) {
+	var session Session
+	err := a.db.Raw(`
+		UPDATE session s
+		SET last_used_at = NOW()
+		FROM "User" u
+		WHERE u.user_id = s.user_id
+			AND u.is_active = TRUE
+			AND s.token_hash = ?
+			AND s.revoked_at IS NULL
+			AND s.expires_at > NOW()
+			AND s.last_used_at > NOW() - (? * INTERVAL '1 second')
+		RETURNING s.session_id, s.user_id, u.user_role, u.student_id, u.must_change_password, u.totp_enabled
+	`, hashSessionToken(token), int64(a.config.SessionIdleTimeout.Seconds())).Scan(&session).Error
+	if err != nil {
+		log.Printf("Failed to look up session: %v", err)
+		return nil, false
+	}
+	if session.SessionID == 0 {
+		return nil, false
+	}
+	return &session, true
+}
 
 func (a *AuthService) GetSessionRole(token string) (string, bool) {
-	role, ok := a.sessions.Load(token)
+	session, ok := a.GetSession(token)
 	if !ok {
 		return "", false
 	}
-	return role.(string), true
+	return session.UserRole, true
+}
+
+func (a *AuthService) purgeExpiredSessions() {
+	err := a.db.Exec("DELETE FROM session WHERE expires_at < NOW()").Error
+	if err != nil {
+		log.Printf("Failed to purge expired sessions: %v", err)
+	}
+}
+
+func generateToken(size int) (string, error) {
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
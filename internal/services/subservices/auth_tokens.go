@@ -0,0 +1,270 @@
+package subservices
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+}
+
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+func (a *AuthService) UsesSessions() bool {
+	return a.config.Mode != AuthModeJWT
+}
+
+func (a *AuthService) UsesJWT() bool {
+	return a.config.Mode == AuthModeJWT || a.config.Mode == AuthModeBoth
+}
+
+// Authenticate resolves a bearer credential according to the configured
+// auth mode. In "both" mode JWTs are recognised by their shape.
+func (a *AuthService) Authenticate(token string) (*Session, bool) {
+	switch a.config.Mode {
+	case AuthModeJWT:
+		return a.ValidateAccessToken(token)
+	case AuthModeBoth:
+		if looksLikeJWT(token) {
+			return a.ValidateAccessToken(token)
+		}
+		return a.GetSession(token)
+	default:
+		return a.GetSession(token)
+	}
+}
+
+// IssueTokenPair starts a new refresh-token family for user. Every refresh
+// rotates within the family; replaying a rotated token revokes all of it.
+func (a *AuthService) IssueTokenPair(user *User, ipAddress, userAgent string) (*TokenPair, error) {
+	familyID, err := generateToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token family: %w", err)
+	}
+
+	pair, err := a.issueTokenPair(a.db, user, familyID, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	a.purgeExpiredTokens()
+	return pair, nil
+}
+
+func (a *AuthService) issueTokenPair(db *gorm.DB, user *User, familyID, ipAddress, userAgent string) (*TokenPair, error) {
+	refreshToken, err := generateToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	now := time.Now()
+	err = db.Table("refresh_token").Create(map[string]interface{}{
+		"token_hash": hashSessionToken(refreshToken),
+		"family_id":  familyID,
+		"user_id":    user.UserID,
+		"ip_address": ipAddress,
+		"user_agent": userAgent,
+		"created_at": now,
+		"expires_at": now.Add(a.config.RefreshTokenTTL),
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	jti, err := generateToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token id: %w", err)
+	}
+
+	accessToken, err := signJWT(a.config.JWTSecret, AccessClaims{
+		Issuer:    a.config.JWTIssuer,
+		Subject:   strconv.Itoa(user.UserID),
+		ID:        jti,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(a.config.AccessTokenTTL).Unix(),
+		UserID:    user.UserID,
+		Role:      user.UserRole,
+		StudentID: user.StudentID,
+		FamilyID:  familyID,
+
+		MustChangePassword: user.MustChangePassword,
+		TOTPEnabled:        user.TOTPEnabled,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(a.config.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+func (a *AuthService) RefreshTokens(refreshToken, ipAddress, userAgent string) (*TokenPair, error) {
+	tx := a.db.Begin()
+
+	var stored struct {
+		TokenID   int
+		FamilyID  string
+		UserID    int
+		ExpiresAt time.Time
+		UsedAt    sql.NullTime
+		RevokedAt sql.NullTime
+	}
+	err := tx.Raw(`
+		SELECT token_id, family_id, user_id, expires_at, used_at, revoked_at
+		FROM refresh_token
+		WHERE token_hash = ?
+		FOR UPDATE
+	`, hashSessionToken(refreshToken)).Scan(&stored).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to look up refresh token: %w", err)
+	}
+	if stored.TokenID == 0 {
+		tx.Rollback()
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if stored.UsedAt.Valid || stored.RevokedAt.Valid {
+		tx.Rollback()
+		log.Printf("Refresh token reuse detected for user_id %d, revoking family", stored.UserID)
+		a.revokeTokenFamily(stored.FamilyID)
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		tx.Rollback()
+		return nil, ErrInvalidRefreshToken
+	}
+
+	err = tx.Table("refresh_token").Where("token_id = ?", stored.TokenID).Update("used_at", time.Now()).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	var user User
+	err = tx.Table("User").Where("user_id = ?", stored.UserID).First(&user).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to load user for refresh token: %w", err)
+	}
+	if !user.IsActive {
+		tx.Rollback()
+		a.revokeTokenFamily(stored.FamilyID)
+		return nil, ErrInvalidRefreshToken
+	}
+
+	pair, err := a.issueTokenPair(tx, &user, stored.FamilyID, ipAddress, userAgent)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return pair, nil
+}
+
+// RevokeTokens ends a JWT login: the access token's jti is denylisted until
+// it would have expired anyway, and the refresh family is revoked.
+func (a *AuthService) RevokeTokens(accessToken, refreshToken string) {
+	if accessToken != "" {
+		claims, err := parseJWT(a.config.JWTSecret, a.config.JWTIssuer, accessToken)
+		if err == nil {
+			err = a.db.Exec(`
+				INSERT INTO revoked_access_token (jti, expires_at)
+				VALUES (?, ?)
+				ON CONFLICT DO NOTHING
+			`, claims.ID, time.Unix(claims.ExpiresAt, 0)).Error
+			if err != nil {
+				log.Printf("Failed to revoke access token: %v", err)
+			}
+			a.revokeTokenFamily(claims.FamilyID)
+		}
+	}
+
+	if refreshToken != "" {
+		var familyID string
+		err := a.db.Table("refresh_token").
+			Select("family_id").
+			Where("token_hash = ?", hashSessionToken(refreshToken)).
+			Scan(&familyID).Error
+		if err != nil {
+			log.Printf("Failed to look up refresh token: %v", err)
+			return
+		}
+		if familyID != "" {
+			a.revokeTokenFamily(familyID)
+		}
+	}
+}
+
+func (a *AuthService) ValidateAccessToken(token string) (*Session, bool) {
+	claims, err := parseJWT(a.config.JWTSecret, a.config.JWTIssuer, token)
+	if err != nil {
+		return nil, false
+	}
+
+	// Revoking the refresh family (logout elsewhere, forced logout) also
+	// ends its access tokens without waiting for them to expire.
+	var revoked bool
+	err = a.db.Raw(`
+		SELECT EXISTS (SELECT 1 FROM revoked_access_token WHERE jti = ?)
+			OR EXISTS (SELECT 1 FROM refresh_token WHERE family_id = ? AND revoked_at IS NOT NULL)
+	`, claims.ID, claims.FamilyID).Scan(&revoked).Error
+	if err != nil {
+		log.Printf("Failed to check access token revocation: %v", err)
+		return nil, false
+	}
+	if revoked {
+		return nil, false
+	}
+
+	return &Session{
+		UserID:             claims.UserID,
+		UserRole:           claims.Role,
+		StudentID:          claims.StudentID,
+		MustChangePassword: claims.MustChangePassword,
+		TOTPEnabled:        claims.TOTPEnabled,
+		FamilyID:           claims.FamilyID,
+	}, true
+}
+
+func (a *AuthService) revokeTokenFamily(familyID string) {
+	err := a.db.Table("refresh_token").
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		log.Printf("Failed to revoke refresh token family: %v", err)
+	}
+}
+
+func (a *AuthService) purgeExpiredTokens() {
+	err := a.db.Exec("DELETE FROM refresh_token WHERE expires_at < NOW()").Error
+	if err != nil {
+		log.Printf("Failed to purge expired refresh tokens: %v", err)
+	}
+
+	err = a.db.Exec("DELETE FROM revoked_access_token WHERE expires_at < NOW()").Error
+	if err != nil {
+		log.Printf("Failed to purge revoked access tokens: %v", err)
+	}
+}
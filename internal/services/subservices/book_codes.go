@@ -0,0 +1,49 @@
+package subservices
+
+import (
+	"errors"
+	"strings"
+
+	"db_project2/pkg/isbn"
+)
+
+// LocalBookCodePrefix marks book codes that are not ISBNs, e.g. for theses
+// or in-house material.
+const LocalBookCodePrefix = "LOC-"
+
+var ErrInvalidBookCode = errors.New("book_code must be a valid ISBN-10, ISBN-13 or a LOC- local identifier")
+
+// NormalizeBookCode returns the canonical book_code: the bare ISBN-13 for an
+// ISBN-10 or ISBN-13 with a valid check digit, or LOC- followed by up to 13
+// letters, digits, dots, dashes or underscores.
+func NormalizeBookCode(code string) (string, error) {
+	code = strings.TrimSpace(code)
+	if strings.HasPrefix(strings.ToUpper(code), LocalBookCodePrefix) {
+		local := code[len(LocalBookCodePrefix):]
+		if local == "" || len(local) > 17-len(LocalBookCodePrefix) {
+			return "", ErrInvalidBookCode
+		}
+		for _, r := range local {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune(".-_", r)) {
+				return "", ErrInvalidBookCode
+			}
+		}
+		return LocalBookCodePrefix + local, nil
+	}
+
+	normalized, err := isbn.Normalize(code)
+	if err != nil {
+		return "", ErrInvalidBookCode
+	}
+	return normalized, nil
+}
+
+// lookupBookCode maps user input to the stored book_code, so either ISBN
+// form finds the title. Input that does not normalize is used as typed, which
+// keeps codes stored before ISBN validation reachable.
+func lookupBookCode(code string) string {
+	if normalized, err := NormalizeBookCode(code); err == nil {
+		return normalized
+	}
+	return strings.TrimSpace(code)
+}
@@ -0,0 +1,297 @@
+package subservices
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBranchNotFound = errors.New("branch not found")
+	ErrBranchExists   = errors.New("a branch with this name already exists")
+	ErrInvalidBranch  = errors.New("invalid branch")
+)
+
+type Branch struct {
+	BranchID int           `json:"branch_id"`
+	Name     string        `json:"name"`
+	Address  *string       `json:"address"`
+	Hours    []BranchHours `json:"hours" gorm:"-"`
+}
+
+// BranchHours is the opening time of one weekday, 0 being Sunday, with
+// times as HH:MM. Days without an entry are closed.
+type BranchHours struct {
+	Weekday  int    `json:"weekday"`
+	OpensAt  string `json:"opens_at"`
+	ClosesAt string `json:"closes_at"`
+}
+
+func (a *AdministratorService) ListBranches() ([]Branch, error) {
+	branches := []Branch{}
+	if err := a.db.Table("branch").Select("branch_id, name, address").Order("name").Scan(&branches).Error; err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+
+	var hours []struct {
+		BranchID int
+		BranchHours
+	}
+	err := a.db.Table("branch_hours").
+		Select("branch_id, weekday, TO_CHAR(opens_at, 'HH24:MI') AS opens_at, TO_CHAR(closes_at, 'HH24:MI') AS closes_at").
+		Order("branch_id, weekday").
+		Scan(&hours).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch opening hours: %w", err)
+	}
+
+	byID := make(map[int]*Branch, len(branches))
+	for i := range branches {
+		branches[i].Hours = []BranchHours{}
+		byID[branches[i].BranchID] = &branches[i]
+	}
+	for _, entry := range hours {
+		if branch, ok := byID[entry.BranchID]; ok {
+			branch.Hours = append(branch.Hours, entry.BranchHours)
+		}
+	}
+	return branches, nil
+}
+
+// GetBranch returns a branch with its opening hours.
+func (a *AdministratorService) GetBranch(branchID int) (*Branch, error) {
+	return lookupBranch(a.db, branchID)
+}
+
+func (a *AdministratorService) CreateBranch(actor Actor, name, address string) (*Branch, error) {
+	name, address, err := normalizeBranch(name, address)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := a.db.Begin()
+
+	if err := checkBranchName(tx, name, 0); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var branchID int
+	err = tx.Raw(`
+		INSERT INTO branch (name, address)
+		VALUES (?, NULLIF(?, ''))
+		RETURNING branch_id
+	`, name, address).Scan(&branchID).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create branch: %w", err)
+	}
+
+	if err := recordAudit(tx, actor, 0, "create_branch", fmt.Sprintf("branch_id %d: %s", branchID, name)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	branch, err := lookupBranch(tx, branchID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return branch, nil
+}
+
+// UpdateBranch changes the name and address; blank values are kept.
+func (a *AdministratorService) UpdateBranch(actor Actor, branchID int, name, address string) (*Branch, error) {
+	updates := map[string]interface{}{}
+	if name = strings.Join(strings.Fields(name), " "); name != "" {
+		if utf8.RuneCountInString(name) > 100 {
+			return nil, fmt.Errorf("%w: name is longer than 100 characters", ErrInvalidBranch)
+		}
+		updates["name"] = name
+	}
+	if address = strings.TrimSpace(address); address != "" {
+		if utf8.RuneCountInString(address) > 255 {
+			return nil, fmt.Errorf("%w: address is longer than 255 characters", ErrInvalidBranch)
+		}
+		updates["address"] = address
+	}
+	if len(updates) == 0 {
+		return nil, fmt.Errorf("%w: nothing to update", ErrInvalidBranch)
+	}
+
+	tx := a.db.Begin()
+
+	if _, err := lookupBranch(tx, branchID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if name != "" {
+		if err := checkBranchName(tx, name, branchID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Table("branch").Where("branch_id = ?", branchID).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update branch: %w", err)
+	}
+
+	if err := recordAudit(tx, actor, 0, "update_branch", fmt.Sprintf("branch_id %d", branchID)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	branch, err := lookupBranch(tx, branchID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return branch, nil
+}
+
+// SetBranchHours replaces the whole opening week of a branch.
+func (a *AdministratorService) SetBranchHours(actor Actor, branchID int, hours []BranchHours) (*Branch, error) {
+	seen := map[int]bool{}
+	for _, day := range hours {
+		if day.Weekday < 0 || day.Weekday > 6 {
+			return nil, fmt.Errorf("%w: weekday must be 0 (Sunday) to 6", ErrInvalidBranch)
+		}
+		if seen[day.Weekday] {
+			return nil, fmt.Errorf("%w: weekday %d is given twice", ErrInvalidBranch, day.Weekday)
+		}
+		seen[day.Weekday] = true
+
+		opens, err := time.Parse("15:04", day.OpensAt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: opens_at must be HH:MM", ErrInvalidBranch)
+		}
+		closes, err := time.Parse("15:04", day.ClosesAt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: closes_at must be HH:MM", ErrInvalidBranch)
+		}
+		if !closes.After(opens) {
+			return nil, fmt.Errorf("%w: weekday %d closes before it opens", ErrInvalidBranch, day.Weekday)
+		}
+	}
+
+	tx := a.db.Begin()
+
+	if _, err := lookupBranch(tx, branchID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Exec("DELETE FROM branch_hours WHERE branch_id = ?", branchID).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to clear opening hours: %w", err)
+	}
+	for _, day := range hours {
+		err := tx.Exec("INSERT INTO branch_hours (branch_id, weekday, opens_at, closes_at) VALUES (?, ?, ?, ?)",
+			branchID, day.Weekday, day.OpensAt, day.ClosesAt).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to set opening hours: %w", err)
+		}
+	}
+
+	if err := recordAudit(tx, actor, 0, "set_branch_hours", fmt.Sprintf("branch_id %d: %d days open", branchID, len(hours))); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	branch, err := lookupBranch(tx, branchID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return branch, nil
+}
+
+func lookupBranch(db *gorm.DB, branchID int) (*Branch, error) {
+	var branch Branch
+	if err := db.Table("branch").Select("branch_id, name, address").Where("branch_id = ?", branchID).Scan(&branch).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch branch: %w", err)
+	}
+	if branch.BranchID == 0 {
+		return nil, ErrBranchNotFound
+	}
+
+	branch.Hours = []BranchHours{}
+	err := db.Table("branch_hours").
+		Select("weekday, TO_CHAR(opens_at, 'HH24:MI') AS opens_at, TO_CHAR(closes_at, 'HH24:MI') AS closes_at").
+		Where("branch_id = ?", branchID).
+		Order("weekday").
+		Scan(&branch.Hours).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch opening hours: %w", err)
+	}
+	return &branch, nil
+}
+
+// resolveBranch picks the branch a desk operation happens at: the one given,
+// or else the branch of the staff member. Zero means all branches, which is
+// also what API keys and staff without a branch get by default.
+func resolveBranch(db *gorm.DB, actor Actor, branchID *int) (int, error) {
+	if branchID != nil {
+		if *branchID == 0 {
+			return 0, nil
+		}
+		if _, err := lookupBranch(db, *branchID); err != nil {
+			return 0, err
+		}
+		return *branchID, nil
+	}
+	if actor.UserID == 0 {
+		return 0, nil
+	}
+
+	var staffBranch sql.NullInt64
+	if err := db.Table("User").Select("branch_id").Where("user_id = ?", actor.UserID).Scan(&staffBranch).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch staff branch: %w", err)
+	}
+	return int(staffBranch.Int64), nil
+}
+
+func checkBranchName(tx *gorm.DB, name string, exceptID int) error {
+	var exists bool
+	err := tx.Table("branch").Select("COUNT(*) > 0").Where("LOWER(name) = LOWER(?) AND branch_id <> ?", name, exceptID).Find(&exists).Error
+	if err != nil {
+		return fmt.Errorf("failed to check branch name: %w", err)
+	}
+	if exists {
+		return ErrBranchExists
+	}
+	return nil
+}
+
+func normalizeBranch(name, address string) (string, string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	address = strings.TrimSpace(address)
+	switch {
+	case name == "":
+		return "", "", fmt.Errorf("%w: name is required", ErrInvalidBranch)
+	case utf8.RuneCountInString(name) > 100:
+		return "", "", fmt.Errorf("%w: name is longer than 100 characters", ErrInvalidBranch)
+	case utf8.RuneCountInString(address) > 255:
+		return "", "", fmt.Errorf("%w: address is longer than 255 characters", ErrInvalidBranch)
+	}
+	return name, address, nil
+}
@@ -0,0 +1,108 @@
+package subservices
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"db_project2/pkg/cardnumber"
+)
+
+type CardLookup struct {
+	Card    LibraryCard   `json:"card"`
+	Student StudentRecord `json:"student"`
+	// CurrentCard is set when the scanned card has been replaced.
+	CurrentCard *LibraryCard `json:"current_card,omitempty"`
+}
+
+// LookupCard finds the patron behind a scanned or typed card number. Old
+// numbers of lost cards still resolve, so the desk can see the replacement.
+func (l *LibraryAgentService) LookupCard(actor Actor, number string) (*CardLookup, error) {
+	number = cardnumber.Normalize(number)
+	if !cardnumber.Valid(number) {
+		return nil, ErrInvalidCardNumber
+	}
+
+	var lookup CardLookup
+	err := l.db.Table("librarycard").Select(libraryCardColumns).Where("card_number = ?", number).Scan(&lookup.Card).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up card number: %w", err)
+	}
+	if lookup.Card.CardID == 0 {
+		return nil, ErrCardNotFound
+	}
+
+	err = l.db.Table("student").
+		Select(studentRecordColumns).
+		Where("student_id = ?", lookup.Card.StudentID).
+		Scan(&lookup.Student).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch student: %w", err)
+	}
+
+	var current LibraryCard
+	err = l.db.Table("librarycard").
+		Select(libraryCardColumns).
+		Where("student_id = ?", lookup.Card.StudentID).
+		Order("card_id DESC").
+		Limit(1).
+		Scan(&current).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch current card: %w", err)
+	}
+	if current.CardID != lookup.Card.CardID {
+		lookup.CurrentCard = &current
+	}
+
+	if err := recordAudit(l.db, actor, lookup.Card.StudentID, "lookup_card", number); err != nil {
+		log.Printf("Failed to audit card lookup of student_id %d: %v", lookup.Card.StudentID, err)
+	}
+
+	return &lookup, nil
+}
+
+// ReplaceLostCard marks the card lost, which invalidates its number, and
+// issues a new card with the same status and expiry date. The new card's
+// replaces_card_id links the two. Blocked cards cannot be replaced.
+func (a *AdministratorService) ReplaceLostCard(actor Actor, cardID int, reason string) (*LibraryCard, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		reason = "reported lost"
+	}
+
+	tx := a.db.Begin()
+
+	lost, err := lockCard(tx, "card_id = ?", cardID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	status := lost.Status
+
+	if err := setCardStatus(tx, actor, lost, CardLost, reason); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	replacement := &LibraryCard{
+		StudentID:      lost.StudentID,
+		Status:         status,
+		ExpiryDate:     lost.ExpiryDate,
+		ReplacesCardID: &lost.CardID,
+	}
+	if err := insertCard(tx, actor, replacement, "replaces lost card "+lost.CardNumber); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	details := fmt.Sprintf("card_id %d (%s) -> card_id %d (%s)", lost.CardID, lost.CardNumber, replacement.CardID, replacement.CardNumber)
+	if err := recordAudit(tx, actor, lost.StudentID, "replace_card", details); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return replacement, nil
+}
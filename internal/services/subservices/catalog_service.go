@@ -0,0 +1,492 @@
+package subservices
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"db_project2/pkg/isbn"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBookNotFound   = errors.New("book not found")
+	ErrBookExists     = errors.New("a book with this book_code already exists")
+	ErrBookHasCopies  = errors.New("book still has copies")
+	ErrAuthorNotFound = errors.New("author not found")
+	ErrInvalidBook    = errors.New("invalid book")
+)
+
+type Author struct {
+	AuthorID  int    `json:"author_id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+type Book struct {
+	BookCode        string   `json:"book_code"`
+	ISBN10          string   `json:"isbn_10,omitempty" gorm:"-"`
+	Title           string   `json:"title"`
+	Pages           *int     `json:"pages"`
+	CallNumber      *string  `json:"call_number"`
+	Authors         []Author `json:"authors" gorm:"-"`
+	Publishers      []string `json:"publishers" gorm:"-"`
+	Subjects        []string `json:"subjects" gorm:"-"`
+	Languages       []string `json:"languages" gorm:"-"`
+	Copies          int      `json:"copies"`
+	AvailableCopies int      `json:"available_copies"`
+	Locations       []string `json:"locations" gorm:"-"`
+}
+
+type BookSummary struct {
+	BookCode        string  `json:"book_code"`
+	Title           string  `json:"title"`
+	Pages           *int    `json:"pages"`
+	Authors         *string `json:"authors"`
+	Copies          int     `json:"copies"`
+	AvailableCopies int     `json:"available_copies"`
+}
+
+// BookInput describes a title with all of its relations. Authors are given
+// as existing AuthorIDs or as "First Last" or "Last, First" names, which
+// are matched case-insensitively and created when missing; publishers and
+// subjects work the same way by name.
+type BookInput struct {
+	BookCode   string
+	Title      string
+	Pages      *int
+	CallNumber string
+	AuthorIDs  []int
+	Authors    []string
+	Publishers []string
+	Subjects   []string
+	Languages  []string
+}
+
+// CatalogService manages Book rows together with their Author, Publisher,
+// "Subject" and Book_Language links. Every write replaces the links inside
+// the same transaction as the book itself.
+type CatalogService struct {
+	db *gorm.DB
+}
+
+func NewCatalogServiceInstance(db *gorm.DB) *CatalogService {
+	return &CatalogService{db: db}
+}
+
+func (s *CatalogService) ListBooks(search string) ([]BookSummary, error) {
+	var books []BookSummary
+	query := s.db.Table("book b").
+		Select(`b.book_code, b.title, b.pages,
+			(SELECT STRING_AGG(a.first_name || ' ' || a.last_name, ', ' ORDER BY a.last_name)
+				FROM book_author ba JOIN author a ON a.author_id = ba.author_id
+				WHERE ba.book_code = b.book_code) AS authors,
+			(SELECT COUNT(*) FROM book_copy bc WHERE bc.book_code = b.book_code) AS copies,
+			(SELECT COUNT(*) FROM book_copy bc WHERE bc.book_code = b.book_code AND bc.status = 'available') AS available_copies`).
+		Order("b.title")
+	if search = strings.TrimSpace(search); search != "" {
+		query = query.Where("b.title ILIKE ? OR b.book_code = ?", "%"+search+"%", lookupBookCode(search))
+	}
+
+	if err := query.Scan(&books).Error; err != nil {
+		return nil, fmt.Errorf("failed to list books: %w", err)
+	}
+	return books, nil
+}
+
+// GetBook finds a title by its book_code, accepting either ISBN form.
+func (s *CatalogService) GetBook(bookCode string) (*Book, error) {
+	return loadBook(s.db, lookupBookCode(bookCode))
+}
+
+func (s *CatalogService) CreateBook(actor Actor, input BookInput) (*Book, error) {
+	bookCode, err := NormalizeBookCode(input.BookCode)
+	if err != nil {
+		return nil, err
+	}
+	input.BookCode = bookCode
+	if err := input.normalize(); err != nil {
+		return nil, err
+	}
+
+	tx := s.db.Begin()
+
+	var exists bool
+	err = tx.Table("book").Select("COUNT(*) > 0").Where("book_code = ?", input.BookCode).Find(&exists).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to check book_code: %w", err)
+	}
+	if exists {
+		tx.Rollback()
+		return nil, ErrBookExists
+	}
+
+	err = tx.Exec("INSERT INTO book (book_code, title, pages, call_number) VALUES (?, ?, ?, NULLIF(?, ''))", input.BookCode, input.Title, input.Pages, input.CallNumber).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create book: %w", err)
+	}
+
+	if err := replaceBookLinks(tx, input); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := recordAudit(tx, actor, 0, "create_book", input.BookCode); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	book, err := loadBook(tx, input.BookCode)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return book, nil
+}
+
+// UpdateBook replaces the title, pages and every relation of an existing
+// book. The book_code itself cannot change because copies refer to it.
+func (s *CatalogService) UpdateBook(actor Actor, bookCode string, input BookInput) (*Book, error) {
+	input.BookCode = lookupBookCode(bookCode)
+	if err := input.normalize(); err != nil {
+		return nil, err
+	}
+
+	tx := s.db.Begin()
+
+	result := tx.Exec("UPDATE book SET title = ?, pages = ?, call_number = NULLIF(?, '') WHERE book_code = ?", input.Title, input.Pages, input.CallNumber, input.BookCode)
+	if result.Error != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update book: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil, ErrBookNotFound
+	}
+
+	if err := replaceBookLinks(tx, input); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := recordAudit(tx, actor, 0, "update_book", input.BookCode); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	book, err := loadBook(tx, input.BookCode)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return book, nil
+}
+
+// DeleteBook removes a title and its links. It is refused while copies
+// exist, since deleting them would cascade into the loan history.
+func (s *CatalogService) DeleteBook(actor Actor, bookCode string) error {
+	bookCode = lookupBookCode(bookCode)
+
+	tx := s.db.Begin()
+
+	var title string
+	err := tx.Raw("SELECT title FROM book WHERE book_code = ? FOR UPDATE", bookCode).Scan(&title).Error
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to fetch book: %w", err)
+	}
+	if title == "" {
+		tx.Rollback()
+		return ErrBookNotFound
+	}
+
+	var copies int64
+	if err := tx.Table("book_copy").Where("book_code = ?", bookCode).Count(&copies).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to count copies: %w", err)
+	}
+	if copies > 0 {
+		tx.Rollback()
+		return fmt.Errorf("%w (%d)", ErrBookHasCopies, copies)
+	}
+
+	if err := tx.Exec("DELETE FROM book WHERE book_code = ?", bookCode).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete book: %w", err)
+	}
+
+	if err := recordAudit(tx, actor, 0, "delete_book", fmt.Sprintf("%s (%s)", bookCode, title)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// normalize trims every field except the book_code, checks the column limits and rejects entries
+// listed twice, so the join tables never receive duplicate links.
+func (i *BookInput) normalize() error {
+	i.Title = strings.TrimSpace(i.Title)
+
+	if i.Title == "" || utf8.RuneCountInString(i.Title) > 255 {
+		return fmt.Errorf("%w: title must be 1 to 255 characters", ErrInvalidBook)
+	}
+	if i.Pages != nil && *i.Pages <= 0 {
+		return fmt.Errorf("%w: pages must be positive", ErrInvalidBook)
+	}
+	i.CallNumber = strings.TrimSpace(i.CallNumber)
+	if utf8.RuneCountInString(i.CallNumber) > 50 {
+		return fmt.Errorf("%w: call_number is limited to 50 characters", ErrInvalidBook)
+	}
+
+	seenIDs := map[int]bool{}
+	for _, id := range i.AuthorIDs {
+		if seenIDs[id] {
+			return fmt.Errorf("%w: author_id %d is listed twice", ErrInvalidBook, id)
+		}
+		seenIDs[id] = true
+	}
+
+	var err error
+	if i.Authors, err = uniqueNames("author", i.Authors, 101); err != nil {
+		return err
+	}
+	for _, name := range i.Authors {
+		first, last := splitAuthorName(name)
+		if first == "" {
+			return fmt.Errorf("%w: author %q needs a first and a last name", ErrInvalidBook, name)
+		}
+		if utf8.RuneCountInString(first) > 50 || utf8.RuneCountInString(last) > 50 {
+			return fmt.Errorf("%w: author names are limited to 50 characters each", ErrInvalidBook)
+		}
+	}
+	if i.Publishers, err = uniqueNames("publisher", i.Publishers, 255); err != nil {
+		return err
+	}
+	if i.Subjects, err = uniqueNames("subject", i.Subjects, 100); err != nil {
+		return err
+	}
+	if i.Languages, err = uniqueNames("language", i.Languages, 50); err != nil {
+		return err
+	}
+	return nil
+}
+
+func uniqueNames(kind string, names []string, max int) ([]string, error) {
+	var result []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.Join(strings.Fields(name), " ")
+		if name == "" {
+			continue
+		}
+		if utf8.RuneCountInString(name) > max {
+			return nil, fmt.Errorf("%w: %s %q is longer than %d characters", ErrInvalidBook, kind, name, max)
+		}
+		key := strings.ToLower(name)
+		if seen[key] {
+			return nil, fmt.Errorf("%w: %s %q is listed twice", ErrInvalidBook, kind, name)
+		}
+		seen[key] = true
+		result = append(result, name)
+	}
+	return result, nil
+}
+
+// splitAuthorName reads "Last, First" as catalog records write it, and
+// otherwise treats the last word as the last name.
+func splitAuthorName(name string) (string, string) {
+	if last, first, ok := strings.Cut(name, ","); ok {
+		return strings.TrimSpace(first), strings.TrimSpace(last)
+	}
+	index := strings.LastIndex(name, " ")
+	if index < 0 {
+		return "", name
+	}
+	return name[:index], name[index+1:]
+}
+
+// replaceBookLinks swaps the book's links for the ones in input, resolving
+// names to rows and creating missing authors, publishers and subjects.
+func replaceBookLinks(tx *gorm.DB, input BookInput) error {
+	for _, table := range []string{"book_author", "book_publisher", "book_subject", "book_language"} {
+		if err := tx.Exec("DELETE FROM "+table+" WHERE book_code = ?", input.BookCode).Error; err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+
+	authorIDs := map[int]bool{}
+	for _, id := range input.AuthorIDs {
+		var exists bool
+		if err := tx.Table("author").Select("COUNT(*) > 0").Where("author_id = ?", id).Find(&exists).Error; err != nil {
+			return fmt.Errorf("failed to check author: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("%w: author_id %d", ErrAuthorNotFound, id)
+		}
+		authorIDs[id] = true
+	}
+	for _, name := range input.Authors {
+		id, err := findOrCreateAuthor(tx, name)
+		if err != nil {
+			return err
+		}
+		authorIDs[id] = true
+	}
+	for id := range authorIDs {
+		if err := tx.Table("book_author").Create(map[string]interface{}{"book_code": input.BookCode, "author_id": id}).Error; err != nil {
+			return fmt.Errorf("failed to link author: %w", err)
+		}
+	}
+
+	for _, name := range input.Publishers {
+		id, err := findOrCreateNamed(tx, "publisher", "publisher_id", name)
+		if err != nil {
+			return err
+		}
+		if err := tx.Table("book_publisher").Create(map[string]interface{}{"book_code": input.BookCode, "publisher_id": id}).Error; err != nil {
+			return fmt.Errorf("failed to link publisher: %w", err)
+		}
+	}
+
+	for _, name := range input.Subjects {
+		id, err := findOrCreateNamed(tx, `"Subject"`, "subject_id", name)
+		if err != nil {
+			return err
+		}
+		if err := tx.Table("book_subject").Create(map[string]interface{}{"book_code": input.BookCode, "subject_id": id}).Error; err != nil {
+			return fmt.Errorf("failed to link subject: %w", err)
+		}
+	}
+
+	for _, language := range input.Languages {
+		if err := tx.Table("book_language").Create(map[string]interface{}{"book_code": input.BookCode, "language": language}).Error; err != nil {
+			return fmt.Errorf("failed to link language: %w", err)
+		}
+	}
+	return nil
+}
+
+func findOrCreateAuthor(tx *gorm.DB, name string) (int, error) {
+	first, last := splitAuthorName(name)
+
+	var id int
+	err := tx.Table("author").
+		Select("author_id").
+		Where("LOWER(first_name) = LOWER(?) AND LOWER(last_name) = LOWER(?)", first, last).
+		Order("author_id").
+		Limit(1).
+		Scan(&id).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up author: %w", err)
+	}
+	if id != 0 {
+		return id, nil
+	}
+
+	err = tx.Raw("INSERT INTO author (first_name, last_name) VALUES (?, ?) RETURNING author_id", first, last).Scan(&id).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to create author: %w", err)
+	}
+	return id, nil
+}
+
+// findOrCreateNamed resolves a Publisher or "Subject" by its unique name.
+func findOrCreateNamed(tx *gorm.DB, table, idColumn, name string) (int, error) {
+	var id int
+	err := tx.Raw("SELECT "+idColumn+" FROM "+table+" WHERE LOWER(name) = LOWER(?)", name).Scan(&id).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up %s: %w", table, err)
+	}
+	if id != 0 {
+		return id, nil
+	}
+
+	err = tx.Raw("INSERT INTO "+table+" (name) VALUES (?) RETURNING "+idColumn, name).Scan(&id).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", table, err)
+	}
+	return id, nil
+}
+
+func loadBook(db *gorm.DB, bookCode string) (*Book, error) {
+	var book Book
+	err := db.Raw(`
+		SELECT b.book_code, b.title, b.pages, b.call_number,
+			(SELECT COUNT(*) FROM book_copy bc WHERE bc.book_code = b.book_code) AS copies,
+			(SELECT COUNT(*) FROM book_copy bc WHERE bc.book_code = b.book_code AND bc.status = 'available') AS available_copies
+		FROM book b
+		WHERE b.book_code = ?
+	`, bookCode).Scan(&book).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch book: %w", err)
+	}
+	if book.BookCode == "" {
+		return nil, ErrBookNotFound
+	}
+	book.ISBN10, _ = isbn.To10(book.BookCode)
+
+	book.Authors = []Author{}
+	err = db.Table("book_author ba").
+		Select("a.author_id, a.first_name, a.last_name").
+		Joins("JOIN author a ON a.author_id = ba.author_id").
+		Where("ba.book_code = ?", bookCode).
+		Order("a.last_name, a.first_name").
+		Scan(&book.Authors).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch authors: %w", err)
+	}
+
+	book.Publishers, book.Subjects, book.Languages = []string{}, []string{}, []string{}
+	err = db.Table("book_publisher bp").
+		Joins("JOIN publisher p ON p.publisher_id = bp.publisher_id").
+		Where("bp.book_code = ?", bookCode).
+		Order("p.name").
+		Pluck("p.name", &book.Publishers).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch publishers: %w", err)
+	}
+
+	err = db.Table("book_subject bs").
+		Joins(`JOIN "Subject" s ON s.subject_id = bs.subject_id`).
+		Where("bs.book_code = ?", bookCode).
+		Order("s.name").
+		Pluck("s.name", &book.Subjects).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch subjects: %w", err)
+	}
+
+	err = db.Table("book_language").
+		Where("book_code = ?", bookCode).
+		Order("language").
+		Pluck("language", &book.Languages).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch languages: %w", err)
+	}
+
+	// Where the available copies are shelved.
+	book.Locations = []string{}
+	err = db.Table("book_copy bc").
+		Distinct("lp.display_label").
+		Joins("JOIN location_path lp ON lp.location_id = bc.location_id").
+		Where("bc.book_code = ? AND bc.status = ?", bookCode, CopyAvailable).
+		Order("lp.display_label").
+		Pluck("lp.display_label", &book.Locations).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch locations: %w", err)
+	}
+
+	return &book, nil
+}
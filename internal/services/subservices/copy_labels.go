@@ -0,0 +1,102 @@
+package subservices
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"db_project2/pkg/labels"
+)
+
+// copyLabelsMax bounds one print run, about 35 sheets of 30 labels.
+const copyLabelsMax = 1000
+
+var ErrInvalidLabelSelection = errors.New("invalid label selection")
+
+// LabelSelection picks copies either by ID, printed in the order given, or
+// by the day they were added, From and To inclusive.
+type LabelSelection struct {
+	CopyIDs []int
+	From    *time.Time
+	To      *time.Time
+}
+
+type copyLabelRow struct {
+	CopyID     int
+	Barcode    string
+	Title      string
+	CallNumber *string
+	ShelfLabel *string
+}
+
+// CopyLabels loads the label text for the selected copies. Withdrawn copies
+// are left out of date ranges but can still be printed by ID.
+func (a *AdministratorService) CopyLabels(selection LabelSelection) ([]labels.Label, error) {
+	query := a.db.Table("book_copy bc").
+		Select("bc.copy_id, bc.barcode, b.title, b.call_number, lp.shelf_label").
+		Joins("JOIN book b ON b.book_code = bc.book_code").
+		Joins("LEFT JOIN location_path lp ON lp.location_id = bc.location_id")
+
+	switch {
+	case len(selection.CopyIDs) > 0 && (selection.From != nil || selection.To != nil):
+		return nil, fmt.Errorf("%w: give copy IDs or a date range, not both", ErrInvalidLabelSelection)
+	case len(selection.CopyIDs) > copyLabelsMax:
+		return nil, fmt.Errorf("%w: at most %d labels per request", ErrInvalidLabelSelection, copyLabelsMax)
+	case len(selection.CopyIDs) > 0:
+		query = query.Where("bc.copy_id IN ?", selection.CopyIDs)
+	case selection.From != nil && selection.To != nil:
+		if selection.To.Before(*selection.From) {
+			return nil, fmt.Errorf("%w: the range ends before it starts", ErrInvalidLabelSelection)
+		}
+		query = query.
+			Where("bc.created_at >= ? AND bc.created_at < ?", *selection.From, selection.To.AddDate(0, 0, 1)).
+			Where("bc.status <> ?", CopyWithdrawn).
+			Order("bc.created_at, bc.copy_id").
+			Limit(copyLabelsMax + 1)
+	default:
+		return nil, fmt.Errorf("%w: give copy IDs or both ends of a date range", ErrInvalidLabelSelection)
+	}
+
+	var rows []copyLabelRow
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch copies: %w", err)
+	}
+	if len(rows) > copyLabelsMax {
+		return nil, fmt.Errorf("%w: the range holds more than %d copies", ErrInvalidLabelSelection, copyLabelsMax)
+	}
+
+	if len(selection.CopyIDs) > 0 {
+		byID := make(map[int]copyLabelRow, len(rows))
+		for _, row := range rows {
+			byID[row.CopyID] = row
+		}
+		rows = rows[:0]
+		var missing []string
+		for _, id := range selection.CopyIDs {
+			row, ok := byID[id]
+			if !ok {
+				missing = append(missing, strconv.Itoa(id))
+				continue
+			}
+			rows = append(rows, row)
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("%w: copy_id %s", ErrCopyNotFound, strings.Join(missing, ", "))
+		}
+	}
+
+	result := make([]labels.Label, 0, len(rows))
+	for _, row := range rows {
+		label := labels.Label{Barcode: row.Barcode, Title: row.Title}
+		if row.CallNumber != nil {
+			label.CallNumber = *row.CallNumber
+		}
+		if row.ShelfLabel != nil {
+			label.Shelf = *row.ShelfLabel
+		}
+		result = append(result, label)
+	}
+	return result, nil
+}
@@ -0,0 +1,242 @@
+package subservices
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	CopyProcessing  = "processing"
+	CopyAvailable   = "available"
+	CopyOnLoan      = "on_loan"
+	CopyOnHoldShelf = "on_hold_shelf"
+	CopyInTransit   = "in_transit"
+	CopyInRepair    = "in_repair"
+	CopyDamaged     = "damaged"
+	CopyMissing     = "missing"
+	CopyLost        = "lost"
+	CopyWithdrawn   = "withdrawn"
+)
+
+const bookCopyColumns = "copy_id, book_code, barcode, branch_id, location_id, price, purchase_date, status, status_reason, status_changed_at"
+
+var (
+	ErrCopyNotFound          = errors.New("book copy not found")
+	ErrInvalidCopyTransition = errors.New("copy status change not allowed")
+	ErrCopyReasonRequired    = errors.New("a reason is required")
+)
+
+// copyTransitions lists, for each target status, the statuses a copy may
+// move from. Copies go on and off loan only through checkout and return,
+// in and out of transit only through returns and transfers between
+// branches, a stocktake marks unscanned copies missing, and a withdrawn
+// copy is final. A copy on loan can be reported lost or damaged; its loan
+// stays open until the return closes it.
+var copyTransitions = map[string][]string{
+	CopyAvailable:   {CopyProcessing, CopyOnHoldShelf, CopyInTransit, CopyInRepair, CopyDamaged, CopyMissing, CopyLost},
+	CopyOnLoan:      {CopyAvailable, CopyOnHoldShelf},
+	CopyOnHoldShelf: {CopyAvailable},
+	CopyInTransit:   {CopyAvailable, CopyOnLoan},
+	CopyInRepair:    {CopyAvailable, CopyDamaged},
+	CopyDamaged:     {CopyAvailable, CopyOnLoan, CopyInRepair},
+	CopyMissing:     {CopyAvailable},
+	CopyLost:        {CopyAvailable, CopyOnLoan, CopyOnHoldShelf, CopyInTransit, CopyInRepair, CopyDamaged, CopyMissing},
+	CopyWithdrawn:   {CopyProcessing, CopyAvailable, CopyInRepair, CopyDamaged, CopyMissing, CopyLost},
+}
+
+type BookCopy struct {
+	CopyID          int        `json:"copy_id"`
+	BookCode        string     `json:"book_code"`
+	Barcode         string     `json:"barcode"`
+	BranchID        int        `json:"branch_id"`
+	LocationID      *int       `json:"location_id"`
+	Location        *string    `json:"location" gorm:"-"`
+	Price           *float64   `json:"price"`
+	PurchaseDate    *time.Time `json:"purchase_date"`
+	Status          string     `json:"status"`
+	StatusReason    *string    `json:"status_reason"`
+	StatusChangedAt *time.Time `json:"status_changed_at"`
+}
+
+type CopyStatusChange struct {
+	OldStatus *string   `json:"old_status"`
+	NewStatus string    `json:"new_status"`
+	Reason    string    `json:"reason"`
+	ChangedBy *int      `json:"changed_by"`
+	APIKeyID  *int      `json:"api_key_id"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// GetCopy returns the copy with where it is shelved and its status history,
+// newest first.
+func (a *AdministratorService) GetCopy(copyID int) (*BookCopy, []CopyStatusChange, error) {
+	var bookCopy BookCopy
+	err := a.db.Table("book_copy").
+		Select(bookCopyColumns).
+		Where("copy_id = ?", copyID).
+		Scan(&bookCopy).Error
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch book copy: %w", err)
+	}
+	if bookCopy.CopyID == 0 {
+		return nil, nil, ErrCopyNotFound
+	}
+	if bookCopy.LocationID != nil {
+		location, err := lookupLocation(a.db, *bookCopy.LocationID)
+		if err != nil {
+			return nil, nil, err
+		}
+		bookCopy.Location = &location.DisplayLabel
+	}
+
+	var history []CopyStatusChange
+	err = a.db.Table("copy_status_history").
+		Select("old_status, new_status, reason, changed_by, api_key_id, changed_at").
+		Where("copy_id = ?", copyID).
+		Order("changed_at DESC, history_id DESC").
+		Scan(&history).Error
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch copy history: %w", err)
+	}
+
+	return &bookCopy, history, nil
+}
+
+// ChangeCopyStatus moves a copy to status along one of copyTransitions, e.g.
+// to withdraw a weeded copy or send a damaged one to repair.
+func (a *AdministratorService) ChangeCopyStatus(actor Actor, copyID int, status, reason string) (*BookCopy, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrCopyReasonRequired
+	}
+	if status == CopyOnLoan {
+		return nil, fmt.Errorf("%w: copies go on loan through checkout", ErrInvalidCopyTransition)
+	}
+	if status == CopyInTransit {
+		return nil, fmt.Errorf("%w: copies go in transit through returns and transfers", ErrInvalidCopyTransition)
+	}
+
+	tx := a.db.Begin()
+
+	bookCopy, err := lockCopy(tx, copyID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// A copy in transit becomes available when its branch receives it; it
+	// can only be given up as lost on the way, which ends the transfer.
+	if bookCopy.Status == CopyInTransit {
+		if status != CopyLost {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: copies in transit are made available by receiving the transfer", ErrInvalidCopyTransition)
+		}
+		if err := cancelOpenTransfer(tx, copyID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	// The patron still has the copy, so it can be reported lost or damaged
+	// but nothing else until the loan is returned.
+	if status != CopyLost && status != CopyDamaged {
+		var onLoan bool
+		err := tx.Table("loan").Select("COUNT(*) > 0").Where("copy_id = ? AND return_date IS NULL", copyID).Find(&onLoan).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to check open loans: %w", err)
+		}
+		if onLoan {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: the copy has an open loan; return it first", ErrInvalidCopyTransition)
+		}
+	}
+
+	if err := setCopyStatus(tx, actor, bookCopy, status, reason); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	details := fmt.Sprintf("copy_id %d (%s): %s", bookCopy.CopyID, bookCopy.Barcode, status)
+	if err := recordAudit(tx, actor, 0, "change_copy_status", details); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return bookCopy, nil
+}
+
+func lockCopy(tx *gorm.DB, copyID int) (*BookCopy, error) {
+	var bookCopy BookCopy
+	err := tx.Raw(`
+		SELECT `+bookCopyColumns+`
+		FROM book_copy
+		WHERE copy_id = ?
+		FOR UPDATE
+	`, copyID).Scan(&bookCopy).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch book copy: %w", err)
+	}
+	if bookCopy.CopyID == 0 {
+		return nil, ErrCopyNotFound
+	}
+	return &bookCopy, nil
+}
+
+// setCopyStatus checks the transition, updates the copy and records it in
+// the history. Callers audit the action that caused the change.
+func setCopyStatus(tx *gorm.DB, actor Actor, bookCopy *BookCopy, status, reason string) error {
+	allowed := false
+	for _, from := range copyTransitions[status] {
+		if from == bookCopy.Status {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidCopyTransition, bookCopy.Status, status)
+	}
+
+	now := time.Now()
+	err := tx.Table("book_copy").Where("copy_id = ?", bookCopy.CopyID).Updates(map[string]interface{}{
+		"status":            status,
+		"status_reason":     reason,
+		"status_changed_at": now,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update copy status: %w", err)
+	}
+
+	oldStatus := bookCopy.Status
+	bookCopy.Status = status
+	bookCopy.StatusReason = &reason
+	bookCopy.StatusChangedAt = &now
+
+	return recordCopyStatus(tx, actor, bookCopy.CopyID, &oldStatus, status, reason)
+}
+
+func recordCopyStatus(tx *gorm.DB, actor Actor, copyID int, oldStatus *string, status, reason string) error {
+	entry := map[string]interface{}{
+		"copy_id":    copyID,
+		"old_status": oldStatus,
+		"new_status": status,
+		"reason":     reason,
+	}
+	if actor.UserID != 0 {
+		entry["changed_by"] = actor.UserID
+	}
+	if actor.APIKeyID != 0 {
+		entry["api_key_id"] = actor.APIKeyID
+	}
+
+	if err := tx.Table("copy_status_history").Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to record copy status change: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package subservices
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// AccessClaims is the payload of the HS256 access tokens issued in JWT mode.
+type AccessClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	ID        string `json:"jti"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	UserID    int    `json:"uid"`
+	Role      string `json:"role"`
+	StudentID int    `json:"student_id,omitempty"`
+	FamilyID  string `json:"fam"`
+	// MustChangePassword is refreshed on every token rotation, so clients
+	// refresh after changing their password to drop the restriction.
+	MustChangePassword bool `json:"mcp,omitempty"`
+	TOTPEnabled        bool `json:"tfa,omitempty"`
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func signJWT(secret []byte, claims AccessClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + jwtSignature(secret, signingInput), nil
+}
+
+// parseJWT verifies the signature, algorithm, issuer and expiry of token.
+func parseJWT(secret []byte, issuer, token string) (*AccessClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	expected := jwtSignature(secret, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, errors.New("invalid token signature")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed token header")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Alg != "HS256" {
+		return nil, errors.New("unsupported token algorithm")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed token payload")
+	}
+	var claims AccessClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("malformed token payload")
+	}
+
+	if claims.Issuer != issuer {
+		return nil, errors.New("unexpected token issuer")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errors.New("token expired")
+	}
+
+	return &claims, nil
+}
+
+func jwtSignature(secret []byte, signingInput string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
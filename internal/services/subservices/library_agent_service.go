@@ -2,7 +2,6 @@ package subservices
 
 import (
 	"database/sql"
-	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -18,25 +17,35 @@ func NewLibraryAgentServiceInstance(db *gorm.DB) *LibraryAgentService {
 	return &LibraryAgentService{db: db}
 }
 
-func (l *LibraryAgentService) GetOverdueLoans() ([]map[string]interface{}, error) {
+// GetOverdueLoans lists the overdue loans checked out at a branch, by
+// default the staff member's own; branch 0 covers every branch.
+func (l *LibraryAgentService) GetOverdueLoans(actor Actor, branchID *int) ([]map[string]interface{}, error) {
 	var overdueLoans []map[string]interface{}
 
+	branch, err := resolveBranch(l.db, actor, branchID)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
         SELECT
             l.loan_id,
             l.due_date,
             CONCAT(s.first_name, ' ', s.last_name) AS student_name,
             b.title AS book_title,
-            bc.barcode
+            bc.barcode,
+            br.name AS branch
         FROM loan l
         JOIN student s ON l.student_id = s.student_id
         JOIN book_copy bc ON l.copy_id = bc.copy_id
         JOIN book b ON bc.book_code = b.book_code
+        JOIN branch br ON l.branch_id = br.branch_id
         WHERE l.due_date < CURRENT_DATE AND return_date IS NULL
+            AND (? = 0 OR l.branch_id = ?)
     `
 
 	
-	err := l.db.Raw(query).Scan(&overdueLoans).Error
+	err = l.db.Raw(query, branch, branch).Scan(&overdueLoans).Error
 	if err != nil {
 		return nil, err
 	}
@@ -44,24 +53,34 @@ func (l *LibraryAgentService) GetOverdueLoans() ([]map[string]interface{}, error
 	return overdueLoans, nil
 }
 
-func (l *LibraryAgentService) GetAllLoans() ([]map[string]interface{}, error) {
+// GetAllLoans lists the open loans checked out at a branch, chosen as in
+// GetOverdueLoans.
+func (l *LibraryAgentService) GetAllLoans(actor Actor, branchID *int) ([]map[string]interface{}, error) {
 	var loans []map[string]interface{}
 
+	branch, err := resolveBranch(l.db, actor, branchID)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
         SELECT
             l.loan_id,
             l.due_date,
             CONCAT(s.first_name, ' ', s.last_name) AS student_name,
             b.title AS book_title,
-            bc.barcode
+            bc.barcode,
+            br.name AS branch
         FROM loan l
         JOIN student s ON l.student_id = s.student_id
         JOIN book_copy bc ON l.copy_id = bc.copy_id
         JOIN book b ON bc.book_code = b.book_code
+        JOIN branch br ON l.branch_id = br.branch_id
 		WHERE l.return_date is NULL
+			AND (? = 0 OR l.branch_id = ?)
     `
 
-	err := l.db.Raw(query).Scan(&loans).Error
+	err = l.db.Raw(query, branch, branch).Scan(&loans).Error
 	if err != nil {
 		return nil, err
 	}
@@ -69,57 +88,66 @@ func (l *LibraryAgentService) GetAllLoans() ([]map[string]interface{}, error) {
 	return loans, nil
 }
 
-func (l *LibraryAgentService) AssignResource(studentID int, bookCode string) error {
+// AssignResource checks out a copy held by the branch of the desk, by
+// default the staff member's own; without a branch any copy will do.
+func (l *LibraryAgentService) AssignResource(actor Actor, studentID int, bookCode string, branchID *int) error {
+	bookCode = lookupBookCode(bookCode)
 	loanDate := time.Now()
 	dueDate := loanDate.AddDate(0, 0, 15)
 
-	var cardStatus struct {
-		Status *bool 
-	}
-
 	tx := l.db.Begin()
 
-	err := tx.Table("librarycard").
-		Select("status").
-		Where("student_id = ?", studentID).
-		Scan(&cardStatus).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	branch, err := resolveBranch(tx, actor, branchID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var studentStatus string
+	err = tx.Table("student").Select("status").Where("student_id = ?", studentID).Scan(&studentStatus).Error
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to check student status: %w", err)
+	}
+	if studentStatus != StudentActive {
 		tx.Rollback()
-		log.Printf("Failed to check library card status for student_id %d: %v\n", studentID, err)
-		return fmt.Errorf("failed to check library card status: %w", err)
+		log.Printf("Student_id %d is not active (status %q)\n", studentID, studentStatus)
+		return fmt.Errorf("student_id %d is not active", studentID)
 	}
 
-	if cardStatus.Status != nil && !*cardStatus.Status {
+	if err := cardCheckoutError(tx, studentID); err != nil {
 		tx.Rollback()
-		log.Printf("Library card for student_id %d is not activated\n", studentID)
-		return fmt.Errorf("library card for student_id %d is not activated", studentID)
+		log.Printf("Refusing checkout for student_id %d: %v\n", studentID, err)
+		return err
 	}
 
-	var availableCopies []int
-	err = tx.Table("book_copy").
-		Select("copy_id").
-		Where("book_code = ? AND is_available = ?", bookCode, true).
-		Scan(&availableCopies).Error
+	// SKIP LOCKED lets concurrent checkouts of the same title take
+	// different copies instead of waiting on each other.
+	var bookCopy BookCopy
+	err = tx.Raw(`
+		SELECT `+bookCopyColumns+`
+		FROM book_copy
+		WHERE book_code = ? AND status = ? AND (? = 0 OR branch_id = ?)
+		ORDER BY copy_id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`, bookCode, CopyAvailable, branch, branch).Scan(&bookCopy).Error
 	if err != nil {
 		tx.Rollback()
 		log.Printf("Failed to fetch available copies for book_code %s: %v\n", bookCode, err)
 		return err
 	}
-
-	var copyID int
-	err = tx.Table("book_copy").
-		Select("copy_id").
-		Where("book_code = ? AND is_available = ?", bookCode, true).
-		Limit(1).Scan(&copyID).Error
-	if err != nil || copyID == 0 {
+	if bookCopy.CopyID == 0 {
 		tx.Rollback()
 		log.Printf("No available copy found for book_code %s\n", bookCode)
 		return fmt.Errorf("no available copy for book_code: %s", bookCode)
 	}
+	copyID := bookCopy.CopyID
 
 	err = tx.Table("loan").Create(map[string]interface{}{
 		"student_id": studentID,
 		"copy_id":    copyID,
+		"branch_id":  bookCopy.BranchID,
 		"loan_date":  loanDate,
 		"due_date":   dueDate,
 	}).Error
@@ -129,10 +157,16 @@ func (l *LibraryAgentService) AssignResource(studentID int, bookCode string) err
 		return err
 	}
 
-	err = tx.Table("book_copy").Where("copy_id = ?", copyID).Update("is_available", false).Error
+	err = setCopyStatus(tx, actor, &bookCopy, CopyOnLoan, fmt.Sprintf("checked out to student_id %d", studentID))
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Failed to mark copy_id %d as on loan: %v\n", copyID, err)
+		return err
+	}
+
+	err = recordAudit(tx, actor, studentID, "assign_resource", fmt.Sprintf("copy_id %d of book_code %s", copyID, bookCode))
 	if err != nil {
 		tx.Rollback()
-		log.Printf("Failed to mark copy_id %d as unavailable: %v\n", copyID, err)
 		return err
 	}
 
@@ -145,12 +179,21 @@ func (l *LibraryAgentService) AssignResource(studentID int, bookCode string) err
 	return nil
 }
 
-func (l *LibraryAgentService) MarkResourceReturned(loanID int) error {
+// MarkResourceReturned closes a loan at the branch of the desk, by default
+// the staff member's own. A copy returned away from its home branch goes
+// in transit back to it.
+func (l *LibraryAgentService) MarkResourceReturned(actor Actor, loanID int, branchID *int) error {
 
 	tx := l.db.Begin()
 
+	returnBranch, err := resolveBranch(tx, actor, branchID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	var exists bool
-	err := tx.Table("loan").Select("COUNT(*) > 0").Where("loan_id = ?", loanID).Find(&exists).Error
+	err = tx.Table("loan").Select("COUNT(*) > 0").Where("loan_id = ?", loanID).Find(&exists).Error
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed to check loan existence: %w", err)
@@ -178,14 +221,39 @@ func (l *LibraryAgentService) MarkResourceReturned(loanID int) error {
 		return err
 	}
 
-	var copyID int
-	err = tx.Table("loan").Select("copy_id").Where("loan_id = ?", loanID).Scan(&copyID).Error
+	var loan struct {
+		CopyID    int
+		StudentID int
+	}
+	err = tx.Table("loan").Select("copy_id, student_id").Where("loan_id = ?", loanID).Scan(&loan).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	bookCopy, err := lockCopy(tx, loan.CopyID)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	err = tx.Table("book_copy").Where("copy_id = ?", copyID).Update("is_available", true).Error
+	// A copy marked lost or damaged while out keeps that status on return.
+	switch {
+	case bookCopy.Status != CopyOnLoan:
+	case returnBranch != 0 && returnBranch != bookCopy.BranchID:
+		reason := fmt.Sprintf("returned from loan_id %d at branch_id %d", loanID, returnBranch)
+		if _, err := startTransfer(tx, actor, bookCopy, returnBranch, bookCopy.BranchID, TransferReturn, reason); err != nil {
+			tx.Rollback()
+			return err
+		}
+	default:
+		if err := setCopyStatus(tx, actor, bookCopy, CopyAvailable, fmt.Sprintf("returned from loan_id %d", loanID)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = recordAudit(tx, actor, loan.StudentID, "return_resource", fmt.Sprintf("loan_id %d", loanID))
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -194,7 +262,7 @@ func (l *LibraryAgentService) MarkResourceReturned(loanID int) error {
 	return tx.Commit().Error
 }
 
-func (l *LibraryAgentService) GetStudentProfile(studentID int) (map[string]interface{}, error) {
+func (l *LibraryAgentService) GetStudentProfile(actor Actor, studentID int) (map[string]interface{}, error) {
 	var profile map[string]interface{}
 	var exists bool
 
@@ -213,12 +281,13 @@ func (l *LibraryAgentService) GetStudentProfile(studentID int) (map[string]inter
     s.email, 
     s.phone, 
     s.postal_address, 
+    s.status, 
     COUNT(l.loan_id) AS total_loans, 
     COUNT(CASE WHEN l.loan_id IS NOT NULL AND l.return_date IS NULL THEN 1 END) AS active_loans
 FROM Student s
 LEFT JOIN Loan l ON s.student_id = l.student_id 
 WHERE s.student_id = ?
-GROUP BY s.first_name, s.last_name, s.email, s.phone, s.postal_address;
+GROUP BY s.first_name, s.last_name, s.email, s.phone, s.postal_address, s.status;
     `
 
 	err = l.db.Raw(query, studentID).Scan(&profile).Error
@@ -226,6 +295,10 @@ GROUP BY s.first_name, s.last_name, s.email, s.phone, s.postal_address;
 		return nil, err
 	}
 
+	if err := recordAudit(l.db, actor, studentID, "view_student_profile", ""); err != nil {
+		log.Printf("Failed to audit profile view of student_id %d: %v", studentID, err)
+	}
+
 	return profile, nil
 }
 
@@ -239,9 +312,11 @@ func (l *LibraryAgentService) GetAllAvailableBooks() ([]map[string]interface{},
     COUNT(DISTINCT bc.copy_id) AS available_copies,
     STRING_AGG(DISTINCT CONCAT(a.first_name, ' ', a.last_name), ', ') AS authors,
     STRING_AGG(DISTINCT s.name, ', ') AS subjects,
-    STRING_AGG(DISTINCT bl.language, ', ') AS languages
+    STRING_AGG(DISTINCT bl.language, ', ') AS languages,
+    STRING_AGG(DISTINCT lp.display_label, '; ') AS locations
 FROM book b
-LEFT JOIN book_copy bc ON b.book_code = bc.book_code AND bc.is_available = TRUE
+LEFT JOIN book_copy bc ON b.book_code = bc.book_code AND bc.status = 'available'
+LEFT JOIN location_path lp ON bc.location_id = lp.location_id
 LEFT JOIN book_author ba ON b.book_code = ba.book_code
 LEFT JOIN author a ON ba.author_id = a.author_id
 LEFT JOIN book_subject bs ON b.book_code = bs.book_code
@@ -0,0 +1,390 @@
+package subservices
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type CardConfig struct {
+	// ValidityMonths is how long a new or renewed card stays valid.
+	ValidityMonths int
+}
+
+const (
+	CardActive    = "active"
+	CardSuspended = "suspended"
+	CardBlocked   = "blocked"
+	CardExpired   = "expired"
+	CardLost      = "lost"
+)
+
+const libraryCardColumns = "card_id, card_number, student_id, status, status_reason, status_changed_at, activation_date, expiry_date, replaces_card_id"
+
+var (
+	ErrCardNotFound          = errors.New("library card not found")
+	ErrInvalidCardTransition = errors.New("card status change not allowed")
+	ErrCardReasonRequired    = errors.New("a reason is required")
+	ErrCardNotActive         = errors.New("library card is not active")
+	ErrInvalidCardNumber     = errors.New("invalid card number")
+)
+
+// cardTransitions lists, for each target status, the statuses a card may
+// move from. Expired cards come back through RenewCard, not activation, and
+// a lost card is final: ReplaceLostCard issues its successor.
+var cardTransitions = map[string][]string{
+	CardActive:    {CardSuspended, CardBlocked},
+	CardSuspended: {CardActive},
+	CardBlocked:   {CardActive, CardSuspended, CardExpired},
+	CardExpired:   {CardActive, CardSuspended},
+	CardLost:      {CardActive, CardSuspended, CardExpired},
+}
+
+type LibraryCard struct {
+	CardID          int        `json:"card_id"`
+	CardNumber      string     `json:"card_number"`
+	StudentID       int        `json:"student_id"`
+	Status          string     `json:"status"`
+	StatusReason    *string    `json:"status_reason"`
+	StatusChangedAt *time.Time `json:"status_changed_at"`
+	ActivationDate  time.Time  `json:"activation_date"`
+	ExpiryDate      time.Time  `json:"expiry_date"`
+	ReplacesCardID  *int       `json:"replaces_card_id"`
+}
+
+type CardStatusChange struct {
+	OldStatus  *string   `json:"old_status"`
+	NewStatus  string    `json:"new_status"`
+	ExpiryDate time.Time `json:"expiry_date"`
+	Reason     string    `json:"reason"`
+	ChangedBy  *int      `json:"changed_by"`
+	APIKeyID   *int      `json:"api_key_id"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// Expired reports whether the card's expiry date has passed, whatever its
+// stored status says.
+func (c *LibraryCard) Expired(now time.Time) bool {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return c.ExpiryDate.Before(today)
+}
+
+// GetCard returns the card and its status history, newest first.
+func (a *AdministratorService) GetCard(cardID int) (*LibraryCard, []CardStatusChange, error) {
+	var card LibraryCard
+	err := a.db.Table("librarycard").
+		Select(libraryCardColumns).
+		Where("card_id = ?", cardID).
+		Scan(&card).Error
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch library card: %w", err)
+	}
+	if card.CardID == 0 {
+		return nil, nil, ErrCardNotFound
+	}
+
+	var history []CardStatusChange
+	err = a.db.Table("card_status_history").
+		Select("old_status, new_status, expiry_date, reason, changed_by, api_key_id, changed_at").
+		Where("card_id = ?", cardID).
+		Order("changed_at DESC, history_id DESC").
+		Scan(&history).Error
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch card history: %w", err)
+	}
+
+	return &card, history, nil
+}
+
+// ChangeCardStatus moves a card to status along one of cardTransitions.
+// Suspending or blocking a card also signs the student out everywhere.
+func (a *AdministratorService) ChangeCardStatus(actor Actor, cardID int, status, reason string) (*LibraryCard, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrCardReasonRequired
+	}
+
+	tx := a.db.Begin()
+
+	card, err := lockCard(tx, "card_id = ?", cardID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := setCardStatus(tx, actor, card, status, reason); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return card, nil
+}
+
+// ActivateCard activates the student's current card. It replaces the old
+// toggle: activating a card that is already active is an error.
+func (a *AdministratorService) ActivateCard(actor Actor, studentID int, reason string) (*LibraryCard, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrCardReasonRequired
+	}
+
+	tx := a.db.Begin()
+
+	card, err := lockCard(tx, "student_id = ?", studentID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := setCardStatus(tx, actor, card, CardActive, reason); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return card, nil
+}
+
+// RenewCard extends the expiry date by the configured validity, counted from
+// today for cards that already expired. An expired card becomes active again;
+// suspended cards stay suspended and blocked or lost cards cannot be renewed.
+func (a *AdministratorService) RenewCard(actor Actor, cardID int, reason string) (*LibraryCard, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		reason = "renewed"
+	}
+
+	tx := a.db.Begin()
+
+	card, err := lockCard(tx, "card_id = ?", cardID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if card.Status == CardBlocked || card.Status == CardLost {
+		tx.Rollback()
+		return nil, fmt.Errorf("%w: %s cards cannot be renewed", ErrInvalidCardTransition, card.Status)
+	}
+
+	now := time.Now()
+	from := card.ExpiryDate
+	if card.Expired(now) {
+		from = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	card.ExpiryDate = from.AddDate(0, a.cards.ValidityMonths, 0)
+
+	oldStatus := card.Status
+	if card.Status == CardExpired {
+		card.Status = CardActive
+	}
+	card.StatusReason = &reason
+	card.StatusChangedAt = &now
+
+	err = tx.Table("librarycard").Where("card_id = ?", card.CardID).Updates(map[string]interface{}{
+		"status":            card.Status,
+		"status_reason":     reason,
+		"status_changed_at": now,
+		"expiry_date":       card.ExpiryDate,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to renew library card: %w", err)
+	}
+
+	if err := recordCardStatus(tx, actor, card, &oldStatus, reason); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := recordAudit(tx, actor, card.StudentID, "renew_card", fmt.Sprintf("card_id %d until %s", card.CardID, card.ExpiryDate.Format("2006-01-02"))); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return card, nil
+}
+
+// issueCard creates a card for studentID inside the caller's transaction.
+func (a *AdministratorService) issueCard(tx *gorm.DB, actor Actor, studentID int, status, reason string) (*LibraryCard, error) {
+	card := &LibraryCard{
+		StudentID:  studentID,
+		Status:     status,
+		ExpiryDate: time.Now().AddDate(0, a.cards.ValidityMonths, 0),
+	}
+	if err := insertCard(tx, actor, card, reason); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// insertCard stores card and fills in its ID and number, which the
+// library_card_number_trigger derives from the ID.
+func insertCard(tx *gorm.DB, actor Actor, card *LibraryCard, reason string) error {
+	var resourceID int
+	err := tx.Table("resource").Select("resource_id").Where("resource_type = ?", "Book").Scan(&resourceID).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch resource ID for 'Book': %w", err)
+	}
+
+	now := time.Now()
+	card.StatusReason = &reason
+	card.StatusChangedAt = &now
+	card.ActivationDate = now
+
+	var inserted struct {
+		CardID     int
+		CardNumber string
+	}
+	err = tx.Raw(`
+		INSERT INTO librarycard (student_id, activation_date, expiry_date, status, status_reason, status_changed_at, replaces_card_id, resource_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING card_id, card_number
+	`, card.StudentID, card.ActivationDate, card.ExpiryDate, card.Status, reason, now, card.ReplacesCardID, resourceID).Scan(&inserted).Error
+	if err != nil {
+		return fmt.Errorf("failed to create library card: %w", err)
+	}
+	card.CardID, card.CardNumber = inserted.CardID, inserted.CardNumber
+
+	return recordCardStatus(tx, actor, card, nil, reason)
+}
+
+// suspendStudentCards suspends every active card of studentID, e.g. when
+// the student record is archived.
+func suspendStudentCards(tx *gorm.DB, actor Actor, studentID int, reason string) error {
+	var cards []LibraryCard
+	err := tx.Raw(`
+		SELECT `+libraryCardColumns+`
+		FROM librarycard
+		WHERE student_id = ? AND status = ?
+		FOR UPDATE
+	`, studentID, CardActive).Scan(&cards).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch library cards: %w", err)
+	}
+
+	for i := range cards {
+		if err := setCardStatus(tx, actor, &cards[i], CardSuspended, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cardCheckoutError explains why studentID's card does not allow checkout,
+// or returns nil. Students without a card fall under the loan limit for
+// unregistered students instead.
+func cardCheckoutError(tx *gorm.DB, studentID int) error {
+	card, err := lockCard(tx, "student_id = ?", studentID)
+	if errors.Is(err, ErrCardNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if card.Status != CardActive {
+		reason := ""
+		if card.StatusReason != nil && *card.StatusReason != "" {
+			reason = ": " + *card.StatusReason
+		}
+		return fmt.Errorf("%w: card %d is %s%s", ErrCardNotActive, card.CardID, card.Status, reason)
+	}
+	if card.Expired(time.Now()) {
+		return fmt.Errorf("%w: card %d expired on %s", ErrCardNotActive, card.CardID, card.ExpiryDate.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// lockCard fetches one card FOR UPDATE. Looked up by student, it returns the
+// student's newest card.
+func lockCard(tx *gorm.DB, where string, arg interface{}) (*LibraryCard, error) {
+	var card LibraryCard
+	err := tx.Raw(`
+		SELECT `+libraryCardColumns+`
+		FROM librarycard
+		WHERE `+where+`
+		ORDER BY card_id DESC
+		LIMIT 1
+		FOR UPDATE
+	`, arg).Scan(&card).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch library card: %w", err)
+	}
+	if card.CardID == 0 {
+		return nil, ErrCardNotFound
+	}
+	return &card, nil
+}
+
+func setCardStatus(tx *gorm.DB, actor Actor, card *LibraryCard, status, reason string) error {
+	allowed := false
+	for _, from := range cardTransitions[status] {
+		if from == card.Status {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidCardTransition, card.Status, status)
+	}
+
+	now := time.Now()
+	err := tx.Table("librarycard").Where("card_id = ?", card.CardID).Updates(map[string]interface{}{
+		"status":            status,
+		"status_reason":     reason,
+		"status_changed_at": now,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update card status: %w", err)
+	}
+
+	oldStatus := card.Status
+	card.Status = status
+	card.StatusReason = &reason
+	card.StatusChangedAt = &now
+
+	if err := recordCardStatus(tx, actor, card, &oldStatus, reason); err != nil {
+		return err
+	}
+
+	// A suspended or blocked card signs the student out everywhere.
+	if status == CardSuspended || status == CardBlocked {
+		if err := revokeStudentSessions(tx, card.StudentID); err != nil {
+			return err
+		}
+	}
+
+	details := fmt.Sprintf("card_id %d: %s -> %s (%s)", card.CardID, oldStatus, status, reason)
+	return recordAudit(tx, actor, card.StudentID, "change_card_status", details)
+}
+
+func recordCardStatus(tx *gorm.DB, actor Actor, card *LibraryCard, oldStatus *string, reason string) error {
+	entry := map[string]interface{}{
+		"card_id":     card.CardID,
+		"old_status":  oldStatus,
+		"new_status":  card.Status,
+		"expiry_date": card.ExpiryDate,
+		"reason":      reason,
+	}
+	if actor.UserID != 0 {
+		entry["changed_by"] = actor.UserID
+	}
+	if actor.APIKeyID != 0 {
+		entry["api_key_id"] = actor.APIKeyID
+	}
+
+	if err := tx.Table("card_status_history").Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to record card status change: %w", err)
+	}
+	return nil
+}
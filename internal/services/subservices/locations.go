@@ -0,0 +1,442 @@
+package subservices
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// Location kinds from the outside in. A location may skip levels, e.g. a
+// rack directly in a building, but never sits inside a smaller kind.
+const (
+	LocationBuilding = "building"
+	LocationFloor    = "floor"
+	LocationRoom     = "room"
+	LocationRack     = "rack"
+	LocationShelf    = "shelf"
+)
+
+var locationKinds = []string{LocationBuilding, LocationFloor, LocationRoom, LocationRack, LocationShelf}
+
+// copyMoveMax bounds one move, about a full bay of shelves.
+const copyMoveMax = 500
+
+const locationColumns = "location_id, parent_id, branch_id, kind, label, display_label, shelf_label"
+
+var (
+	ErrLocationNotFound = errors.New("location not found")
+	ErrLocationExists   = errors.New("a location with this label already exists here")
+	ErrLocationInUse    = errors.New("location still holds copies, locations or stocktakes")
+	ErrInvalidLocation  = errors.New("invalid location")
+)
+
+// Location is a node of the shelving tree. DisplayLabel is the full path,
+// e.g. "Main library, Floor 2, Rack 3"; ShelfLabel is the rack and shelf
+// part printed on spine labels.
+type Location struct {
+	LocationID   int    `json:"location_id"`
+	ParentID     *int   `json:"parent_id"`
+	BranchID     int    `json:"branch_id"`
+	Kind         string `json:"kind"`
+	Label        string `json:"label"`
+	DisplayLabel string `json:"display_label"`
+	ShelfLabel   string `json:"shelf_label"`
+	Copies       int    `json:"copies"`
+}
+
+type LocationCopy struct {
+	CopyID   int    `json:"copy_id"`
+	Barcode  string `json:"barcode"`
+	BookCode string `json:"book_code"`
+	Title    string `json:"title"`
+	Status   string `json:"status"`
+}
+
+type CopyLocationChange struct {
+	OldLocationID *int      `json:"old_location_id"`
+	OldLocation   *string   `json:"old_location"`
+	NewLocationID *int      `json:"new_location_id"`
+	NewLocation   *string   `json:"new_location"`
+	Reason        *string   `json:"reason"`
+	MovedBy       *int      `json:"moved_by"`
+	APIKeyID      *int      `json:"api_key_id"`
+	MovedAt       time.Time `json:"moved_at"`
+}
+
+// ListLocations returns the tree in display order, each location with the
+// number of copies shelved directly in it. branchID 0 lists every branch.
+func (a *AdministratorService) ListLocations(branchID int) ([]Location, error) {
+	locations := []Location{}
+	query := a.db.Table("location_path lp").
+		Select(locationColumns + `,
+			(SELECT COUNT(*) FROM book_copy bc WHERE bc.location_id = lp.location_id) AS copies`).
+		Order("display_label")
+	if branchID != 0 {
+		query = query.Where("branch_id = ?", branchID)
+	}
+	if err := query.Scan(&locations).Error; err != nil {
+		return nil, fmt.Errorf("failed to list locations: %w", err)
+	}
+	return locations, nil
+}
+
+// GetLocation returns a location with its direct children and the copies
+// shelved directly in it.
+func (a *AdministratorService) GetLocation(locationID int) (*Location, []Location, []LocationCopy, error) {
+	location, err := lookupLocation(a.db, locationID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	children := []Location{}
+	err = a.db.Table("location_path lp").
+		Select(locationColumns+`,
+			(SELECT COUNT(*) FROM book_copy bc WHERE bc.location_id = lp.location_id) AS copies`).
+		Where("parent_id = ?", locationID).
+		Order("label").
+		Scan(&children).Error
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to fetch child locations: %w", err)
+	}
+
+	copies := []LocationCopy{}
+	err = a.db.Table("book_copy bc").
+		Select("bc.copy_id, bc.barcode, bc.book_code, b.title, bc.status").
+		Joins("JOIN book b ON b.book_code = bc.book_code").
+		Where("bc.location_id = ?", locationID).
+		Order("b.title, bc.barcode").
+		Scan(&copies).Error
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to fetch copies: %w", err)
+	}
+	location.Copies = len(copies)
+
+	return location, children, copies, nil
+}
+
+// CreateLocation adds a location under parentID, in the same branch, or a
+// top-level one of branchID when parentID is nil.
+func (a *AdministratorService) CreateLocation(actor Actor, parentID, branchID *int, kind, label string) (*Location, error) {
+	label, err := normalizeLocationLabel(label)
+	if err != nil {
+		return nil, err
+	}
+	rank := locationRank(kind)
+	if rank < 0 {
+		return nil, fmt.Errorf("%w: kind must be one of %s", ErrInvalidLocation, strings.Join(locationKinds, ", "))
+	}
+
+	tx := a.db.Begin()
+
+	if parentID != nil {
+		parent, err := lookupLocation(tx, *parentID)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if locationRank(parent.Kind) >= rank {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: a %s cannot be inside a %s", ErrInvalidLocation, kind, parent.Kind)
+		}
+		if branchID != nil && *branchID != parent.BranchID {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: the parent location belongs to another branch", ErrInvalidLocation)
+		}
+		branchID = &parent.BranchID
+	} else {
+		if branchID == nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: branch_id is required for a top-level location", ErrInvalidLocation)
+		}
+		if _, err := lookupBranch(tx, *branchID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := checkLocationLabel(tx, parentID, *branchID, label, 0); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var locationID int
+	err = tx.Raw(`
+		INSERT INTO location (parent_id, branch_id, kind, label)
+		VALUES (?, ?, ?, ?)
+		RETURNING location_id
+	`, parentID, *branchID, kind, label).Scan(&locationID).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create location: %w", err)
+	}
+
+	location, err := lookupLocation(tx, locationID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := recordAudit(tx, actor, 0, "create_location", fmt.Sprintf("location_id %d: %s", locationID, location.DisplayLabel)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return location, nil
+}
+
+// RenameLocation changes the label of a location, which also changes the
+// display label of everything below it.
+func (a *AdministratorService) RenameLocation(actor Actor, locationID int, label string) (*Location, error) {
+	label, err := normalizeLocationLabel(label)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := a.db.Begin()
+
+	location, err := lookupLocation(tx, locationID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := checkLocationLabel(tx, location.ParentID, location.BranchID, label, locationID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Table("location").Where("location_id = ?", locationID).Update("label", label).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to rename location: %w", err)
+	}
+
+	details := fmt.Sprintf("location_id %d: %s -> %s", locationID, location.Label, label)
+	if err := recordAudit(tx, actor, 0, "rename_location", details); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	location, err = lookupLocation(tx, locationID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return location, nil
+}
+
+// DeleteLocation removes an empty location. Copies and child locations have
+// to be moved first, and locations that were counted in a stocktake are
+// kept for its record.
+func (a *AdministratorService) DeleteLocation(actor Actor, locationID int) error {
+	tx := a.db.Begin()
+
+	location, err := lookupLocation(tx, locationID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var inUse bool
+	err = tx.Raw(`
+		SELECT EXISTS (SELECT 1 FROM location WHERE parent_id = ?)
+			OR EXISTS (SELECT 1 FROM book_copy WHERE location_id = ?)
+			OR EXISTS (SELECT 1 FROM stocktake_session WHERE location_id = ?)
+	`, locationID, locationID, locationID).Scan(&inUse).Error
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to check location: %w", err)
+	}
+	if inUse {
+		tx.Rollback()
+		return ErrLocationInUse
+	}
+
+	if err := tx.Exec("DELETE FROM location WHERE location_id = ?", locationID).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete location: %w", err)
+	}
+
+	if err := recordAudit(tx, actor, 0, "delete_location", fmt.Sprintf("location_id %d: %s", locationID, location.DisplayLabel)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// MoveCopies shelves the given copies at locationID and records each move in
+// the location history. Copies already there are left alone; copies of
+// another branch have to be transferred first.
+func (a *AdministratorService) MoveCopies(actor Actor, copyIDs []int, locationID int, reason string) ([]BookCopy, error) {
+	if len(copyIDs) == 0 {
+		return nil, fmt.Errorf("%w: no copies given", ErrInvalidLocation)
+	}
+	if len(copyIDs) > copyMoveMax {
+		return nil, fmt.Errorf("%w: at most %d copies per move", ErrInvalidLocation, copyMoveMax)
+	}
+	reason = strings.TrimSpace(reason)
+
+	tx := a.db.Begin()
+
+	location, err := lookupLocation(tx, locationID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	moved := make([]BookCopy, 0, len(copyIDs))
+	seen := make(map[int]bool, len(copyIDs))
+	for _, copyID := range copyIDs {
+		if seen[copyID] {
+			continue
+		}
+		seen[copyID] = true
+
+		bookCopy, err := lockCopy(tx, copyID)
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("copy_id %d: %w", copyID, err)
+		}
+		if bookCopy.LocationID != nil && *bookCopy.LocationID == locationID {
+			continue
+		}
+		if bookCopy.Status == CopyWithdrawn {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: copy_id %d is withdrawn", ErrInvalidCopyTransition, copyID)
+		}
+		if bookCopy.BranchID != location.BranchID {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: copy_id %d belongs to another branch", ErrInvalidLocation, copyID)
+		}
+
+		if err := tx.Table("book_copy").Where("copy_id = ?", copyID).Update("location_id", locationID).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to move copy: %w", err)
+		}
+		if err := recordCopyLocation(tx, actor, copyID, bookCopy.LocationID, locationID, reason); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		bookCopy.LocationID = &location.LocationID
+		bookCopy.Location = &location.DisplayLabel
+		moved = append(moved, *bookCopy)
+	}
+
+	details := fmt.Sprintf("%d copies to location_id %d (%s)", len(moved), locationID, location.DisplayLabel)
+	if err := recordAudit(tx, actor, 0, "move_copies", details); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return moved, nil
+}
+
+// CopyLocationHistory returns where a copy has been shelved, newest first.
+func (a *AdministratorService) CopyLocationHistory(copyID int) ([]CopyLocationChange, error) {
+	history := []CopyLocationChange{}
+	err := a.db.Table("copy_location_history h").
+		Select(`h.old_location_id, old_lp.display_label AS old_location,
+			h.new_location_id, new_lp.display_label AS new_location,
+			h.reason, h.moved_by, h.api_key_id, h.moved_at`).
+		Joins("LEFT JOIN location_path old_lp ON old_lp.location_id = h.old_location_id").
+		Joins("LEFT JOIN location_path new_lp ON new_lp.location_id = h.new_location_id").
+		Where("h.copy_id = ?", copyID).
+		Order("h.moved_at DESC, h.history_id DESC").
+		Scan(&history).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch copy location history: %w", err)
+	}
+	return history, nil
+}
+
+func lookupLocation(db *gorm.DB, locationID int) (*Location, error) {
+	var location Location
+	err := db.Table("location_path").Select(locationColumns).Where("location_id = ?", locationID).Scan(&location).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch location: %w", err)
+	}
+	if location.LocationID == 0 {
+		return nil, ErrLocationNotFound
+	}
+	return &location, nil
+}
+
+// checkLocationLabel reports ErrLocationExists when a sibling other than
+// exceptID already uses label, ignoring case. Top-level locations are
+// siblings within their branch.
+func checkLocationLabel(tx *gorm.DB, parentID *int, branchID int, label string, exceptID int) error {
+	query := tx.Table("location").Select("COUNT(*) > 0").Where("LOWER(label) = LOWER(?) AND location_id <> ?", label, exceptID)
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL AND branch_id = ?", branchID)
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+
+	var exists bool
+	if err := query.Find(&exists).Error; err != nil {
+		return fmt.Errorf("failed to check location label: %w", err)
+	}
+	if exists {
+		return ErrLocationExists
+	}
+	return nil
+}
+
+func recordCopyLocation(tx *gorm.DB, actor Actor, copyID int, oldLocationID *int, locationID int, reason string) error {
+	entry := map[string]interface{}{
+		"copy_id":         copyID,
+		"old_location_id": oldLocationID,
+		"new_location_id": locationID,
+	}
+	if reason != "" {
+		entry["reason"] = reason
+	}
+	if actor.UserID != 0 {
+		entry["moved_by"] = actor.UserID
+	}
+	if actor.APIKeyID != 0 {
+		entry["api_key_id"] = actor.APIKeyID
+	}
+
+	if err := tx.Table("copy_location_history").Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to record copy location: %w", err)
+	}
+	return nil
+}
+
+func normalizeLocationLabel(label string) (string, error) {
+	label = strings.Join(strings.Fields(label), " ")
+	if label == "" {
+		return "", fmt.Errorf("%w: label is required", ErrInvalidLocation)
+	}
+	if utf8.RuneCountInString(label) > 100 {
+		return "", fmt.Errorf("%w: label is longer than 100 characters", ErrInvalidLocation)
+	}
+	return label, nil
+}
+
+// locationRank orders the kinds from building (0) to shelf; unknown kinds
+// are -1.
+func locationRank(kind string) int {
+	for i, known := range locationKinds {
+		if kind == known {
+			return i
+		}
+	}
+	return -1
+}
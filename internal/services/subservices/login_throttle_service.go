@@ -0,0 +1,302 @@
+package subservices
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	throttleScopeUser = "user"
+	throttleScopeIP   = "ip"
+)
+
+var ErrNotLocked = errors.New("not locked")
+
+type LockoutConfig struct {
+	MaxFailures     int
+	IPMaxFailures   int
+	LockoutDuration time.Duration
+	BackoffBase     time.Duration
+	BackoffMax      time.Duration
+	FailureWindow   time.Duration
+}
+
+// ThrottledError is returned while a username or client IP is backing off
+// or locked out. RetryAfter is how long the caller has to wait.
+type ThrottledError struct {
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	if e.Locked {
+		return "account temporarily locked after too many failed login attempts"
+	}
+	return "too many failed login attempts, try again later"
+}
+
+type LockedAccount struct {
+	Username      string    `json:"username"`
+	FailureCount  int       `json:"failure_count"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until"`
+}
+
+type LockedAddress struct {
+	IPAddress     string    `json:"ip_address"`
+	FailureCount  int       `json:"failure_count"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until"`
+}
+
+// LoginThrottleService tracks failed logins per username and per client IP.
+// State is kept in the login_throttle table so it is shared by every app
+// instance and survives restarts.
+type LoginThrottleService struct {
+	db     *gorm.DB
+	config LockoutConfig
+}
+
+func NewLoginThrottleServiceInstance(db *gorm.DB, config LockoutConfig) *LoginThrottleService {
+	return &LoginThrottleService{db: db, config: config}
+}
+
+func (l *LoginThrottleService) CheckLoginAllowed(username, ipAddress string) error {
+	var rows []struct {
+		Scope        string
+		BlockedUntil *time.Time
+		LockedUntil  *time.Time
+	}
+	err := l.db.Table("login_throttle").
+		Select("scope, blocked_until, locked_until").
+		Where("(scope = ? AND key = ?) OR (scope = ? AND key = ?)",
+			throttleScopeUser, normalizeUsername(username), throttleScopeIP, ipAddress).
+		Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to check login throttle: %w", err)
+	}
+
+	now := time.Now()
+	var throttled *ThrottledError
+	for _, row := range rows {
+		if row.LockedUntil != nil && row.LockedUntil.After(now) {
+			wait := row.LockedUntil.Sub(now)
+			if throttled == nil || !throttled.Locked || wait > throttled.RetryAfter {
+				throttled = &ThrottledError{Locked: true, RetryAfter: wait}
+			}
+			continue
+		}
+		if row.BlockedUntil != nil && row.BlockedUntil.After(now) {
+			wait := row.BlockedUntil.Sub(now)
+			if throttled == nil || (!throttled.Locked && wait > throttled.RetryAfter) {
+				throttled = &ThrottledError{RetryAfter: wait}
+			}
+		}
+	}
+
+	if throttled != nil {
+		return throttled
+	}
+	return nil
+}
+
+// RecordLoginFailure counts a failed login. cause is stored as a short
+// reason code rather than its message, which may be arbitrarily long.
+func (l *LoginThrottleService) RecordLoginFailure(username, ipAddress string, cause error) {
+	tx := l.db.Begin()
+
+	if err := l.logAttempt(tx, username, ipAddress, false, loginFailureReason(cause)); err != nil {
+		tx.Rollback()
+		log.Printf("Failed to record login failure: %v", err)
+		return
+	}
+
+	userCount, err := l.registerFailure(tx, throttleScopeUser, normalizeUsername(username), l.config.MaxFailures)
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Failed to update login throttle for username: %v", err)
+		return
+	}
+
+	if _, err := l.registerFailure(tx, throttleScopeIP, ipAddress, l.config.IPMaxFailures); err != nil {
+		tx.Rollback()
+		log.Printf("Failed to update login throttle for ip: %v", err)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("Failed to commit login failure: %v", err)
+		return
+	}
+
+	if userCount >= l.config.MaxFailures {
+		log.Printf("Account %q locked after %d failed login attempts", username, userCount)
+	}
+}
+
+// RecordLoginSuccess clears the username and IP counters. Lockouts are only
+// lifted by time or an admin, never by a later correct guess.
+func (l *LoginThrottleService) RecordLoginSuccess(username, ipAddress string) {
+	tx := l.db.Begin()
+
+	if err := l.logAttempt(tx, username, ipAddress, true, ""); err != nil {
+		tx.Rollback()
+		log.Printf("Failed to record login success: %v", err)
+		return
+	}
+
+	err := tx.Exec(`
+		DELETE FROM login_throttle
+		WHERE ((scope = ? AND key = ?) OR (scope = ? AND key = ?))
+			AND (locked_until IS NULL OR locked_until < NOW())
+	`, throttleScopeUser, normalizeUsername(username), throttleScopeIP, ipAddress).Error
+	if err != nil {
+		tx.Rollback()
+		log.Printf("Failed to reset login throttle: %v", err)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("Failed to commit login success: %v", err)
+	}
+}
+
+func (l *LoginThrottleService) ListLockedAccounts() ([]LockedAccount, error) {
+	var accounts []LockedAccount
+	err := l.db.Table("login_throttle").
+		Select("key AS username, failure_count, last_failure_at, locked_until").
+		Where("scope = ? AND locked_until > NOW()", throttleScopeUser).
+		Order("locked_until DESC").
+		Scan(&accounts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list locked accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+// ListLockedAddresses returns the client IPs locked out after too many
+// failed logins across any usernames.
+func (l *LoginThrottleService) ListLockedAddresses() ([]LockedAddress, error) {
+	var addresses []LockedAddress
+	err := l.db.Table("login_throttle").
+		Select("key AS ip_address, failure_count, last_failure_at, locked_until").
+		Where("scope = ? AND locked_until > NOW()", throttleScopeIP).
+		Order("locked_until DESC").
+		Scan(&addresses).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list locked addresses: %w", err)
+	}
+	return addresses, nil
+}
+
+func (l *LoginThrottleService) UnlockAccount(actor Actor, username string) error {
+	return l.unlock(actor, throttleScopeUser, normalizeUsername(username), "unlock_account")
+}
+
+func (l *LoginThrottleService) UnlockAddress(actor Actor, ipAddress string) error {
+	return l.unlock(actor, throttleScopeIP, strings.TrimSpace(ipAddress), "unlock_address")
+}
+
+func (l *LoginThrottleService) unlock(actor Actor, scope, key, action string) error {
+	tx := l.db.Begin()
+
+	result := tx.Exec("DELETE FROM login_throttle WHERE scope = ? AND key = ?", scope, key)
+	if result.Error != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to unlock: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		if scope == throttleScopeIP {
+			return fmt.Errorf("address %q: %w", key, ErrNotLocked)
+		}
+		return fmt.Errorf("account %q: %w", key, ErrNotLocked)
+	}
+
+	if err := recordAudit(tx, actor, 0, action, key); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// registerFailure bumps the counter for one scope and recomputes its
+// exponential backoff. Counters older than FailureWindow start over.
+func (l *LoginThrottleService) registerFailure(tx *gorm.DB, scope, key string, maxFailures int) (int, error) {
+	var failureCount int
+	err := tx.Raw(`
+		INSERT INTO login_throttle (scope, key, failure_count, last_failure_at)
+		VALUES (?, ?, 1, NOW())
+		ON CONFLICT (scope, key) DO UPDATE SET
+			failure_count = CASE
+				WHEN login_throttle.last_failure_at < NOW() - (? * INTERVAL '1 second') THEN 1
+				ELSE login_throttle.failure_count + 1
+			END,
+			last_failure_at = NOW()
+		RETURNING failure_count
+	`, scope, key, int64(l.config.FailureWindow.Seconds())).Scan(&failureCount).Error
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"blocked_until": now.Add(l.backoff(failureCount)),
+	}
+	if maxFailures > 0 && failureCount >= maxFailures {
+		updates["locked_until"] = now.Add(l.config.LockoutDuration)
+	}
+
+	err = tx.Table("login_throttle").Where("scope = ? AND key = ?", scope, key).Updates(updates).Error
+	if err != nil {
+		return 0, err
+	}
+	return failureCount, nil
+}
+
+func (l *LoginThrottleService) backoff(failureCount int) time.Duration {
+	delay := l.config.BackoffBase
+	for i := 1; i < failureCount; i++ {
+		delay *= 2
+		if delay >= l.config.BackoffMax {
+			return l.config.BackoffMax
+		}
+	}
+	return delay
+}
+
+func (l *LoginThrottleService) logAttempt(tx *gorm.DB, username, ipAddress string, succeeded bool, reason string) error {
+	if len(username) > 50 {
+		username = username[:50]
+	}
+	return tx.Table("login_attempt").Create(map[string]interface{}{
+		"username":   username,
+		"ip_address": ipAddress,
+		"succeeded":  succeeded,
+		"reason":     reason,
+	}).Error
+}
+
+// loginFailureReason maps a login error to the code kept in
+// login_attempt.reason.
+func loginFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidCredentials):
+		return "invalid_credentials"
+	case errors.Is(err, ErrAccountDisabled):
+		return "account_disabled"
+	case errors.Is(err, ErrInvalidTwoFactorCode):
+		return "invalid_two_factor_code"
+	}
+	return "error"
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
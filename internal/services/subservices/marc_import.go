@@ -0,0 +1,402 @@
+package subservices
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"db_project2/pkg/marc"
+
+	"gorm.io/gorm"
+)
+
+const marcImportMaxRecords = 10000
+
+const (
+	MARCRecordCreated  = "created"
+	MARCRecordUpdated  = "updated"
+	MARCRecordRejected = "rejected"
+)
+
+var ErrInvalidMARCFile = errors.New("invalid MARC file")
+
+type MARCRecordResult struct {
+	Record   int      `json:"record"`
+	Status   string   `json:"status"`
+	BookCode string   `json:"book_code,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type MARCImportReport struct {
+	Total    int                `json:"total"`
+	Created  int                `json:"created"`
+	Updated  int                `json:"updated"`
+	Rejected int                `json:"rejected"`
+	Records  []MARCRecordResult `json:"records"`
+}
+
+type marcImportRecord struct {
+	result *MARCRecordResult
+	input  BookInput
+}
+
+// marcLanguages names the MARC language codes the catalog is likely to see,
+// so imported titles use the same language names as the rest of the
+// catalog. Unknown codes are kept as they are.
+var marcLanguages = map[string]string{
+	"ara": "Arabic",
+	"chi": "Chinese",
+	"cze": "Czech",
+	"dan": "Danish",
+	"dut": "Dutch",
+	"eng": "English",
+	"fin": "Finnish",
+	"fre": "French",
+	"ger": "German",
+	"gre": "Greek",
+	"heb": "Hebrew",
+	"hin": "Hindi",
+	"hun": "Hungarian",
+	"ita": "Italian",
+	"jpn": "Japanese",
+	"kor": "Korean",
+	"lat": "Latin",
+	"nor": "Norwegian",
+	"per": "Persian",
+	"pol": "Polish",
+	"por": "Portuguese",
+	"rum": "Romanian",
+	"rus": "Russian",
+	"spa": "Spanish",
+	"swe": "Swedish",
+	"tur": "Turkish",
+	"ukr": "Ukrainian",
+}
+
+var marcPagesPattern = regexp.MustCompile(`(\d+)\s*(?:p\b|pages?\b|S\.)`)
+
+// ImportMARC loads bibliographic records from binary MARC21 or MARCXML and
+// upserts them by book_code: a title whose ISBN is already in the catalog
+// has its title, authors, publishers, subjects and languages replaced by the
+// record, and pages and call number are kept when the record has none. Records are written
+// in batches with a savepoint each, so a rejected record does not undo the
+// others. If a batch cannot be written the import stops there and the
+// report, covering the batches already committed, is returned with the
+// error.
+func (s *CatalogService) ImportMARC(actor Actor, file io.Reader) (*MARCImportReport, error) {
+	records, err := marc.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMARCFile, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: no records found", ErrInvalidMARCFile)
+	}
+	if len(records) > marcImportMaxRecords {
+		return nil, fmt.Errorf("%w: more than %d records", ErrInvalidMARCFile, marcImportMaxRecords)
+	}
+
+	report := &MARCImportReport{Total: len(records), Records: make([]MARCRecordResult, 0, len(records))}
+	results := make([]*MARCRecordResult, len(records))
+	var valid []marcImportRecord
+	for i := range records {
+		result := &MARCRecordResult{Record: i + 1}
+		results[i] = result
+
+		input, err := mapMARCRecord(&records[i], result)
+		if err != nil {
+			result.Status = MARCRecordRejected
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		valid = append(valid, marcImportRecord{result: result, input: input})
+	}
+
+	var importErr error
+	for start := 0; start < len(valid); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(valid) {
+			end = len(valid)
+		}
+		if importErr = s.importMARCBatch(valid[start:end]); importErr != nil {
+			rejectMARCRecords(valid[start:end], "batch could not be committed")
+			rejectMARCRecords(valid[end:], "not imported after an earlier batch failed")
+			break
+		}
+	}
+
+	for _, result := range results {
+		switch result.Status {
+		case MARCRecordCreated:
+			report.Created++
+		case MARCRecordUpdated:
+			report.Updated++
+		default:
+			report.Rejected++
+		}
+		report.Records = append(report.Records, *result)
+	}
+
+	tx := s.db.Begin()
+	details := fmt.Sprintf("%d records, %d created, %d updated, %d rejected", report.Total, report.Created, report.Updated, report.Rejected)
+	if err := recordAudit(tx, actor, 0, "import_marc", details); err != nil {
+		tx.Rollback()
+		if importErr == nil {
+			importErr = err
+		}
+	} else if err := tx.Commit().Error; err != nil && importErr == nil {
+		importErr = fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return report, importErr
+}
+
+func (s *CatalogService) importMARCBatch(batch []marcImportRecord) error {
+	tx := s.db.Begin()
+
+	for i, record := range batch {
+		savepoint := fmt.Sprintf("marc_record_%d", i)
+		if err := tx.SavePoint(savepoint).Error; err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to create savepoint: %w", err)
+		}
+
+		created, err := upsertBook(tx, record.input)
+		if err != nil {
+			if rollbackErr := tx.RollbackTo(savepoint).Error; rollbackErr != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to roll back record %d: %w", record.result.Record, rollbackErr)
+			}
+			record.result.Status = MARCRecordRejected
+			record.result.Errors = append(record.result.Errors, err.Error())
+			continue
+		}
+
+		record.result.Status = MARCRecordUpdated
+		if created {
+			record.result.Status = MARCRecordCreated
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit import batch: %w", err)
+	}
+	return nil
+}
+
+// rejectMARCRecords marks records whose batch was rolled back, or never
+// written, as rejected.
+func rejectMARCRecords(records []marcImportRecord, reason string) {
+	for _, record := range records {
+		if record.result.Status == MARCRecordRejected {
+			continue
+		}
+		record.result.Status = MARCRecordRejected
+		record.result.Errors = append(record.result.Errors, reason)
+	}
+}
+
+// upsertBook updates the title with input's book_code, or creates it, and
+// replaces its links. It reports whether the book was created.
+func upsertBook(tx *gorm.DB, input BookInput) (bool, error) {
+	result := tx.Exec("UPDATE book SET title = ?, pages = COALESCE(?, pages), call_number = COALESCE(NULLIF(?, ''), call_number) WHERE book_code = ?",
+		input.Title, input.Pages, input.CallNumber, input.BookCode)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update book: %w", result.Error)
+	}
+
+	created := result.RowsAffected == 0
+	if created {
+		err := tx.Exec("INSERT INTO book (book_code, title, pages, call_number) VALUES (?, ?, ?, NULLIF(?, ''))", input.BookCode, input.Title, input.Pages, input.CallNumber).Error
+		if err != nil {
+			return false, fmt.Errorf("failed to create book: %w", err)
+		}
+	}
+
+	if err := replaceBookLinks(tx, input); err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+// mapMARCRecord builds a BookInput from the fields the catalog keeps:
+// 020 ISBN, 245 title, 300 extent, 050/082 call number, 100/700 personal
+// names, 264/260 publisher, 650 topical subjects and the 041 and 008
+// language codes.
+// Values that cannot be used are noted as warnings on result.
+func mapMARCRecord(record *marc.Record, result *MARCRecordResult) (BookInput, error) {
+	if record.Err != nil {
+		return BookInput{}, record.Err
+	}
+
+	var input BookInput
+	for _, field := range record.DataFields("020") {
+		for _, value := range field.SubfieldValues("a") {
+			// 020 $a may carry a qualifier, e.g. "0262134721 (hardcover)".
+			candidate := strings.Fields(value)
+			if len(candidate) == 0 {
+				continue
+			}
+			if bookCode, err := NormalizeBookCode(candidate[0]); err == nil {
+				input.BookCode = bookCode
+				break
+			}
+		}
+		if input.BookCode != "" {
+			break
+		}
+	}
+	if input.BookCode == "" {
+		return BookInput{}, errors.New("no valid ISBN in field 020")
+	}
+	result.BookCode = input.BookCode
+
+	for _, field := range record.DataFields("245") {
+		var parts []string
+		for _, subfield := range field.Subfields {
+			value := trimMARCPunctuation(subfield.Value)
+			if value == "" {
+				continue
+			}
+			switch {
+			case subfield.Code == "a":
+				parts = append(parts, value)
+			case subfield.Code == "b" && len(parts) > 0:
+				parts = append(parts, ": "+value)
+			case (subfield.Code == "n" || subfield.Code == "p") && len(parts) > 0:
+				parts = append(parts, ". "+value)
+			}
+		}
+		input.Title = strings.Join(parts, "")
+		break
+	}
+	result.Title = input.Title
+
+	for _, field := range record.DataFields("300") {
+		pages := 0
+		for _, match := range marcPagesPattern.FindAllStringSubmatch(field.Subfield("a"), -1) {
+			if n, err := strconv.Atoi(match[1]); err == nil && n > pages {
+				pages = n
+			}
+		}
+		if pages > 0 {
+			input.Pages = &pages
+			break
+		}
+	}
+
+	// The Library of Congress call number (050) is preferred over Dewey (082).
+	for _, tag := range []string{"050", "082"} {
+		for _, field := range record.DataFields(tag) {
+			parts := []string{strings.TrimSpace(field.Subfield("a"))}
+			if item := strings.TrimSpace(field.Subfield("b")); item != "" {
+				parts = append(parts, item)
+			}
+			input.CallNumber = strings.TrimSpace(strings.Join(parts, " "))
+			break
+		}
+		if input.CallNumber != "" {
+			break
+		}
+	}
+
+	for _, tag := range []string{"100", "700"} {
+		for _, field := range record.DataFields(tag) {
+			name := trimMARCPunctuation(field.Subfield("a"))
+			if name == "" {
+				continue
+			}
+			if first, _ := splitAuthorName(name); first == "" || !strings.Contains(name, ",") {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("skipped author %q: expected \"Last, First\"", name))
+				continue
+			}
+			input.Authors = appendUnique(input.Authors, name)
+		}
+	}
+
+	// 264 second indicator 1 marks the publisher; 260 is the older form.
+	for _, field := range record.DataFields("264") {
+		if field.Ind2 == "1" {
+			for _, name := range field.SubfieldValues("b") {
+				input.Publishers = appendUnique(input.Publishers, trimMARCPunctuation(name))
+			}
+		}
+	}
+	if len(input.Publishers) == 0 {
+		for _, field := range record.DataFields("260") {
+			for _, name := range field.SubfieldValues("b") {
+				input.Publishers = appendUnique(input.Publishers, trimMARCPunctuation(name))
+			}
+		}
+	}
+
+	for _, field := range record.DataFields("650") {
+		input.Subjects = appendUnique(input.Subjects, trimMARCPunctuation(field.Subfield("a")))
+	}
+
+	var codes []string
+	for _, field := range record.DataFields("041") {
+		for _, value := range field.SubfieldValues("a") {
+			// Older records run several codes together, e.g. "engfre".
+			value = strings.ToLower(strings.TrimSpace(value))
+			for len(value) >= 3 {
+				codes = append(codes, value[:3])
+				value = value[3:]
+			}
+		}
+	}
+	if fixed := record.Control("008"); len(fixed) >= 38 {
+		codes = append(codes, strings.ToLower(fixed[35:38]))
+	}
+	for _, code := range codes {
+		if strings.TrimSpace(code) == "" || code == "|||" || code == "und" || code == "mul" || code == "zxx" {
+			continue
+		}
+		language, ok := marcLanguages[code]
+		if !ok {
+			language = code
+		}
+		input.Languages = appendUnique(input.Languages, language)
+	}
+
+	if err := input.normalize(); err != nil {
+		return BookInput{}, err
+	}
+	return input, nil
+}
+
+// appendUnique adds value unless it is empty or already listed; the
+// catalog rejects names given twice, and MARC records often repeat them.
+func appendUnique(values []string, value string) []string {
+	value = strings.Join(strings.Fields(value), " ")
+	if value == "" {
+		return values
+	}
+	for _, existing := range values {
+		if strings.EqualFold(existing, value) {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// trimMARCPunctuation strips the ISBD punctuation that closes MARC
+// subfields (" /", " :", ",", "." ...). A final period is kept after an
+// initial such as "Stuart J.".
+func trimMARCPunctuation(value string) string {
+	value = strings.TrimRightFunc(strings.TrimSpace(value), func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune("/:;,=", r)
+	})
+	if strings.HasSuffix(value, ".") {
+		words := strings.Fields(value)
+		last := []rune(words[len(words)-1])
+		if !(len(last) == 2 && unicode.IsUpper(last[0])) {
+			value = strings.TrimRight(value, ".")
+		}
+	}
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,239 @@
+package subservices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"db_project2/pkg/oidc"
+
+	"gorm.io/gorm"
+)
+
+type OIDCConfig struct {
+	Enabled  bool
+	Provider oidc.Config
+	StateTTL time.Duration
+	// EmailClaim and GroupsClaim name the ID token claims used to find the
+	// local account and its role.
+	EmailClaim           string
+	GroupsClaim          string
+	RequireVerifiedEmail bool
+	// RoleGroups maps each user_role to the provider groups that grant it.
+	// The first role in oidcRolePriority with a matching group wins.
+	RoleGroups map[string][]string
+}
+
+var oidcRolePriority = []string{"Admin", "LibraryAgent", "Student"}
+
+var (
+	ErrOIDCDisabled        = errors.New("single sign-on is not enabled")
+	ErrInvalidOIDCState    = errors.New("invalid or expired single sign-on request")
+	ErrOIDCNoRole          = errors.New("your identity provider groups do not grant access to the library")
+	ErrOIDCNoAccount       = errors.New("no library account matches your identity")
+	ErrOIDCRoleMismatch    = errors.New("your identity provider role does not match your library account")
+	ErrOIDCEmailUnverified = errors.New("your identity provider has not verified your email address")
+)
+
+// OIDCService runs the authorization code + PKCE flow against the
+// university identity provider and links provider identities to existing
+// "User" rows. It never creates accounts: students are matched through
+// Student.email, staff through "User".email.
+type OIDCService struct {
+	db       *gorm.DB
+	provider *oidc.Provider
+	config   OIDCConfig
+}
+
+func NewOIDCServiceInstance(db *gorm.DB, config OIDCConfig) *OIDCService {
+	return &OIDCService{db: db, provider: oidc.NewProvider(config.Provider), config: config}
+}
+
+func (o *OIDCService) Enabled() bool {
+	return o.config.Enabled
+}
+
+// BeginLogin stores a fresh state, nonce and PKCE verifier and returns the
+// provider URL to send the browser to.
+func (o *OIDCService) BeginLogin(ctx context.Context) (string, error) {
+	if !o.config.Enabled {
+		return "", ErrOIDCDisabled
+	}
+
+	state, err := oidc.NewState()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	nonce, err := oidc.NewState()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+
+	authURL, err := o.provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", err
+	}
+
+	err = o.db.Table("oidc_login_state").Create(map[string]interface{}{
+		"state_hash":    hashSessionToken(state),
+		"code_verifier": verifier,
+		"nonce":         nonce,
+		"expires_at":    time.Now().Add(o.config.StateTTL),
+	}).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to store login state: %w", err)
+	}
+
+	err = o.db.Exec("DELETE FROM oidc_login_state WHERE expires_at < NOW()").Error
+	if err != nil {
+		log.Printf("Failed to purge expired login states: %v", err)
+	}
+
+	return authURL, nil
+}
+
+// CompleteLogin handles the provider callback and returns the local user.
+// The first login of an identity links it to the matching account.
+func (o *OIDCService) CompleteLogin(ctx context.Context, state, code string) (*User, error) {
+	if !o.config.Enabled {
+		return nil, ErrOIDCDisabled
+	}
+
+	var stored struct {
+		CodeVerifier string
+		Nonce        string
+	}
+	err := o.db.Raw(`
+		DELETE FROM oidc_login_state
+		WHERE state_hash = ? AND expires_at > NOW()
+		RETURNING code_verifier, nonce
+	`, hashSessionToken(state)).Scan(&stored).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up login state: %w", err)
+	}
+	if stored.CodeVerifier == "" {
+		return nil, ErrInvalidOIDCState
+	}
+
+	claims, err := o.provider.Exchange(ctx, code, stored.CodeVerifier, stored.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete single sign-on: %w", err)
+	}
+
+	issuer := claims.String("iss")
+	subject := claims.String("sub")
+	email := strings.TrimSpace(claims.String(o.config.EmailClaim))
+
+	role := o.mapRole(claims.Strings(o.config.GroupsClaim))
+	if role == "" {
+		log.Printf("SSO login for subject %s rejected: no mapped group in %v", subject, claims.Strings(o.config.GroupsClaim))
+		return nil, ErrOIDCNoRole
+	}
+
+	tx := o.db.Begin()
+
+	var user User
+	err = tx.Table(`"User" u`).
+		Select("u.*").
+		Joins("JOIN oidc_identity i ON i.user_id = u.user_id").
+		Where("i.issuer = ? AND i.subject = ?", issuer, subject).
+		Scan(&user).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to look up linked identity: %w", err)
+	}
+
+	if user.UserID == 0 {
+		if err := o.linkIdentity(tx, &user, claims, issuer, subject, email, role); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if user.UserRole != role {
+		tx.Rollback()
+		log.Printf("SSO login for user_id %d rejected: provider role %s, account role %s", user.UserID, role, user.UserRole)
+		return nil, ErrOIDCRoleMismatch
+	}
+	if !user.IsActive {
+		tx.Rollback()
+		return nil, ErrAccountDisabled
+	}
+
+	err = tx.Table("oidc_identity").
+		Where("issuer = ? AND subject = ?", issuer, subject).
+		Updates(map[string]interface{}{"last_login_at": time.Now(), "email": email}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update linked identity: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &user, nil
+}
+
+// linkIdentity finds the account for a first-time identity by email and
+// records the link. Only provider-verified addresses are trusted for this.
+func (o *OIDCService) linkIdentity(tx *gorm.DB, user *User, claims oidc.Claims, issuer, subject, email, role string) error {
+	if email == "" {
+		return ErrOIDCNoAccount
+	}
+	if o.config.RequireVerifiedEmail && claims["email_verified"] != true {
+		return ErrOIDCEmailUnverified
+	}
+
+	query := tx.Table(`"User" u`).Select("u.*").Where("u.user_role = ?", role)
+	if role == "Student" {
+		query = query.Joins("JOIN student s ON s.student_id = u.student_id").Where("LOWER(s.email) = LOWER(?)", email)
+	} else {
+		query = query.Where("LOWER(u.email) = LOWER(?)", email)
+	}
+	if err := query.Scan(user).Error; err != nil {
+		return fmt.Errorf("failed to look up account by email: %w", err)
+	}
+	if user.UserID == 0 {
+		log.Printf("SSO login for subject %s rejected: no %s account with a matching email", subject, role)
+		return ErrOIDCNoAccount
+	}
+
+	err := tx.Table("oidc_identity").Create(map[string]interface{}{
+		"issuer":  issuer,
+		"subject": subject,
+		"user_id": user.UserID,
+		"email":   email,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	var studentID int
+	if role == "Student" {
+		studentID = user.StudentID
+	}
+	return recordAudit(tx, Actor{UserID: user.UserID}, studentID, "link_sso_identity", fmt.Sprintf("%s subject %s", issuer, subject))
+}
+
+func (o *OIDCService) mapRole(groups []string) string {
+	member := map[string]bool{}
+	for _, group := range groups {
+		member[group] = true
+	}
+
+	for _, role := range oidcRolePriority {
+		for _, group := range o.config.RoleGroups[role] {
+			if member[group] {
+				return role
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package subservices
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(storedHash, password string) (bool, error)
+	NeedsRehash(storedHash string) bool
+}
+
+type BcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{cost: cost}
+}
+
+func (b *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// Verify accepts both bcrypt hashes and legacy plaintext rows, so accounts
+// created before hashing was introduced can still log in and be upgraded.
+func (b *BcryptHasher) Verify(storedHash, password string) (bool, error) {
+	if !isBcryptHash(storedHash) {
+		return subtle.ConstantTimeCompare([]byte(storedHash), []byte(password)) == 1, nil
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to verify password: %w", err)
+	}
+	return true, nil
+}
+
+func (b *BcryptHasher) NeedsRehash(storedHash string) bool {
+	if !isBcryptHash(storedHash) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(storedHash))
+	if err != nil {
+		return true
+	}
+	return cost != b.cost
+}
+
+func isBcryptHash(value string) bool {
+	return strings.HasPrefix(value, "$2a$") || strings.HasPrefix(value, "$2b$") || strings.HasPrefix(value, "$2y$")
+}
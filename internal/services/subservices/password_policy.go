@@ -0,0 +1,239 @@
+package subservices
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+type PasswordPolicyConfig struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	HistorySize   int
+	DenyList      map[string]bool
+}
+
+// PasswordPolicyError describes why a password was rejected. Handlers
+// report it as a client error rather than a server failure.
+type PasswordPolicyError struct {
+	Reason string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password rejected: " + e.Reason
+}
+
+func IsPasswordPolicyError(err error) bool {
+	var policyErr *PasswordPolicyError
+	return errors.As(err, &policyErr)
+}
+
+// PasswordPolicy is the only place that writes "User".password, so every
+// path that sets a password gets the same rules and history tracking.
+type PasswordPolicy struct {
+	config PasswordPolicyConfig
+	hasher PasswordHasher
+}
+
+func NewPasswordPolicy(config PasswordPolicyConfig, hasher PasswordHasher) *PasswordPolicy {
+	return &PasswordPolicy{config: config, hasher: hasher}
+}
+
+func (p *PasswordPolicy) Validate(username, password string) error {
+	if len([]rune(password)) < p.config.MinLength {
+		return &PasswordPolicyError{Reason: fmt.Sprintf("must be at least %d characters long", p.config.MinLength)}
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+
+	if p.config.RequireUpper && !hasUpper {
+		return &PasswordPolicyError{Reason: "must contain an uppercase letter"}
+	}
+	if p.config.RequireLower && !hasLower {
+		return &PasswordPolicyError{Reason: "must contain a lowercase letter"}
+	}
+	if p.config.RequireDigit && !hasDigit {
+		return &PasswordPolicyError{Reason: "must contain a digit"}
+	}
+	if p.config.RequireSymbol && !hasSymbol {
+		return &PasswordPolicyError{Reason: "must contain a symbol"}
+	}
+
+	lowered := strings.ToLower(password)
+	if p.config.DenyList[lowered] {
+		return &PasswordPolicyError{Reason: "is too common"}
+	}
+	if username != "" && strings.Contains(lowered, strings.ToLower(username)) {
+		return &PasswordPolicyError{Reason: "must not contain the username"}
+	}
+
+	return nil
+}
+
+// SetPassword validates newPassword, rejects reuse of the last HistorySize
+// passwords and stores the new hash. mustChange marks admin-assigned
+// passwords that the owner has to replace on next login.
+func (p *PasswordPolicy) SetPassword(tx *gorm.DB, userID int, newPassword string, mustChange bool) error {
+	var user User
+	err := tx.Table("User").Where("user_id = ?", userID).First(&user).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch user_id %d: %w", userID, err)
+	}
+
+	if !mustChange {
+		if err := p.Validate(user.Username, newPassword); err != nil {
+			return err
+		}
+		if err := p.checkReuse(tx, user, newPassword); err != nil {
+			return err
+		}
+	}
+
+	hash, err := p.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Table("User").Where("user_id = ?", userID).Updates(map[string]interface{}{
+		"password":             hash,
+		"must_change_password": mustChange,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	return p.recordHistory(tx, userID, hash)
+}
+
+func (p *PasswordPolicy) checkReuse(tx *gorm.DB, user User, newPassword string) error {
+	previous := []string{user.Password}
+
+	if p.config.HistorySize > 0 {
+		var history []string
+		err := tx.Table("password_history").
+			Select("password_hash").
+			Where("user_id = ?", user.UserID).
+			Order("created_at DESC").
+			Limit(p.config.HistorySize).
+			Scan(&history).Error
+		if err != nil {
+			return fmt.Errorf("failed to fetch password history: %w", err)
+		}
+		for _, hash := range history {
+			// The newest entry is normally the current password itself.
+			if hash != user.Password {
+				previous = append(previous, hash)
+			}
+		}
+	}
+
+	for _, hash := range previous {
+		reused, err := p.hasher.Verify(hash, newPassword)
+		if err != nil {
+			return err
+		}
+		if reused {
+			if len(previous) == 1 {
+				return &PasswordPolicyError{Reason: "must differ from your current password"}
+			}
+			return &PasswordPolicyError{Reason: fmt.Sprintf("must differ from your last %d passwords", len(previous))}
+		}
+	}
+	return nil
+}
+
+func (p *PasswordPolicy) recordHistory(tx *gorm.DB, userID int, hash string) error {
+	err := tx.Table("password_history").Create(map[string]interface{}{
+		"user_id":       userID,
+		"password_hash": hash,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to record password history: %w", err)
+	}
+
+	err = tx.Exec(`
+		DELETE FROM password_history
+		WHERE user_id = ? AND history_id NOT IN (
+			SELECT history_id FROM password_history
+			WHERE user_id = ?
+			ORDER BY created_at DESC, history_id DESC
+			LIMIT ?
+		)
+	`, userID, userID, p.config.HistorySize).Error
+	if err != nil {
+		return fmt.Errorf("failed to prune password history: %w", err)
+	}
+	return nil
+}
+
+const (
+	upperChars  = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	lowerChars  = "abcdefghijkmnopqrstuvwxyz"
+	digitChars  = "23456789"
+	symbolChars = "!@#$%^&*-_=+"
+)
+
+// GenerateTemporaryPassword returns a random password that satisfies every
+// character-class rule, for accounts created or reset by staff.
+func (p *PasswordPolicy) GenerateTemporaryPassword() (string, error) {
+	length := p.config.MinLength
+	if length < 16 {
+		length = 16
+	}
+
+	password := make([]byte, 0, length)
+	for _, class := range []string{upperChars, lowerChars, digitChars, symbolChars} {
+		c, err := randomChar(class)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	all := upperChars + lowerChars + digitChars + symbolChars
+	for len(password) < length {
+		c, err := randomChar(all)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+
+	return string(password), nil
+}
+
+func randomChar(alphabet string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+	if err != nil {
+		return 0, err
+	}
+	return alphabet[n.Int64()], nil
+}
@@ -0,0 +1,158 @@
+package subservices
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"db_project2/pkg/mailer"
+
+	"gorm.io/gorm"
+)
+
+type PasswordResetConfig struct {
+	TokenTTL        time.Duration
+	RequestCooldown time.Duration
+	ResetURL        string
+}
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+type PasswordResetService struct {
+	db     *gorm.DB
+	policy *PasswordPolicy
+	mailer mailer.Mailer
+	config PasswordResetConfig
+}
+
+func NewPasswordResetServiceInstance(db *gorm.DB, policy *PasswordPolicy, mail mailer.Mailer, config PasswordResetConfig) *PasswordResetService {
+	return &PasswordResetService{db: db, policy: policy, mailer: mail, config: config}
+}
+
+// RequestReset mails a single-use link to the student's address on file.
+// It reports success for unknown addresses too, so the endpoint cannot be
+// used to discover which emails are registered.
+func (p *PasswordResetService) RequestReset(email, ipAddress string) error {
+	var account struct {
+		UserID    int
+		Username  string
+		FirstName string
+		Email     string
+	}
+	err := p.db.Table("student s").
+		Select("u.user_id, u.username, s.first_name, s.email").
+		Joins(`JOIN "User" u ON u.student_id = s.student_id`).
+		Where("LOWER(s.email) = LOWER(?)", email).
+		Scan(&account).Error
+	if err != nil {
+		return fmt.Errorf("failed to look up account: %w", err)
+	}
+	if account.UserID == 0 {
+		log.Printf("Password reset requested for unknown email from %s", ipAddress)
+		return nil
+	}
+
+	var recent bool
+	err = p.db.Table("password_reset_token").
+		Select("COUNT(*) > 0").
+		Where("user_id = ? AND used_at IS NULL AND created_at > ?", account.UserID, time.Now().Add(-p.config.RequestCooldown)).
+		Find(&recent).Error
+	if err != nil {
+		return fmt.Errorf("failed to check recent reset requests: %w", err)
+	}
+	if recent {
+		log.Printf("Password reset for user_id %d requested again within cooldown", account.UserID)
+		return nil
+	}
+
+	token, err := generateToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate reset token: %w", err)
+	}
+
+	tx := p.db.Begin()
+
+	err = tx.Table("password_reset_token").
+		Where("user_id = ? AND used_at IS NULL", account.UserID).
+		Update("expires_at", time.Now()).Error
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to expire previous reset tokens: %w", err)
+	}
+
+	err = tx.Table("password_reset_token").Create(map[string]interface{}{
+		"token_hash":   hashSessionToken(token),
+		"user_id":      account.UserID,
+		"requested_ip": ipAddress,
+		"expires_at":   time.Now().Add(p.config.TokenTTL),
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to store reset token: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	link := p.config.ResetURL + "?token=" + url.QueryEscape(token)
+	err = p.mailer.Send(mailer.Message{
+		To:      account.Email,
+		Subject: "Library password reset",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nA password reset was requested for your library account %q.\n"+
+				"Open the link below within %s to choose a new password:\n\n%s\n\n"+
+				"If you did not request this, you can ignore this message.\n",
+			account.FirstName, account.Username, p.config.TokenTTL, link),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ResetPassword consumes token and sets newPassword. All existing sessions
+// and refresh tokens of the account are revoked afterwards.
+func (p *PasswordResetService) ResetPassword(token, newPassword string) error {
+	tx := p.db.Begin()
+
+	var stored struct {
+		TokenID int
+		UserID  int
+	}
+	err := tx.Raw(`
+		SELECT token_id, user_id
+		FROM password_reset_token
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > NOW()
+		FOR UPDATE
+	`, hashSessionToken(token)).Scan(&stored).Error
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to look up reset token: %w", err)
+	}
+	if stored.TokenID == 0 {
+		tx.Rollback()
+		return ErrInvalidResetToken
+	}
+
+	if err := p.policy.SetPassword(tx, stored.UserID, newPassword, false); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Table("password_reset_token").Where("token_id = ?", stored.TokenID).Update("used_at", time.Now()).Error
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to consume reset token: %w", err)
+	}
+
+	if err := revokeUserSessions(tx, stored.UserID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
@@ -0,0 +1,238 @@
+package subservices
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session IDs in the inventory carry their kind, because a login is either
+// a server-side session row or, in JWT mode, a refresh-token family.
+const (
+	sessionIDPrefix     = "s-"
+	tokenFamilyIDPrefix = "t-"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrUserNotFound    = errors.New("user not found")
+)
+
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"`
+}
+
+// CurrentSessionID returns the inventory ID of the login s belongs to.
+func (s *Session) CurrentSessionID() string {
+	if s.FamilyID != "" {
+		return tokenFamilyIDPrefix + s.FamilyID
+	}
+	return sessionIDPrefix + strconv.Itoa(s.SessionID)
+}
+
+// ListSessions returns the user's active logins, newest activity first.
+// currentID marks the caller's own session.
+func (a *AuthService) ListSessions(userID int, currentID string) ([]SessionInfo, error) {
+	var sessions []SessionInfo
+
+	var rows []struct {
+		SessionID  int
+		CreatedAt  time.Time
+		LastUsedAt time.Time
+		ExpiresAt  time.Time
+		IPAddress  string
+		UserAgent  string
+	}
+	err := a.db.Table("session").
+		Select("session_id, created_at, last_used_at, expires_at, ip_address, user_agent").
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > NOW() AND last_used_at > NOW() - (? * INTERVAL '1 second')",
+			userID, int64(a.config.SessionIdleTimeout.Seconds())).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	for _, row := range rows {
+		sessions = append(sessions, SessionInfo{
+			ID:         sessionIDPrefix + strconv.Itoa(row.SessionID),
+			Kind:       "session",
+			CreatedAt:  row.CreatedAt,
+			LastUsedAt: row.LastUsedAt,
+			ExpiresAt:  row.ExpiresAt,
+			IPAddress:  row.IPAddress,
+			UserAgent:  row.UserAgent,
+		})
+	}
+
+	// A token family's last use is its latest rotation; the unused refresh
+	// token is the one the client currently holds.
+	var families []struct {
+		FamilyID   string
+		CreatedAt  time.Time
+		LastUsedAt time.Time
+		ExpiresAt  time.Time
+		IPAddress  string
+		UserAgent  string
+	}
+	err = a.db.Raw(`
+		SELECT t.family_id, f.created_at, t.created_at AS last_used_at, t.expires_at, t.ip_address, t.user_agent
+		FROM refresh_token t
+		JOIN (
+			SELECT family_id, MIN(created_at) AS created_at
+			FROM refresh_token
+			WHERE user_id = ?
+			GROUP BY family_id
+		) f ON f.family_id = t.family_id
+		WHERE t.user_id = ? AND t.used_at IS NULL AND t.revoked_at IS NULL AND t.expires_at > NOW()
+	`, userID, userID).Scan(&families).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list token sessions: %w", err)
+	}
+	for _, family := range families {
+		sessions = append(sessions, SessionInfo{
+			ID:         tokenFamilyIDPrefix + family.FamilyID,
+			Kind:       "token",
+			CreatedAt:  family.CreatedAt,
+			LastUsedAt: family.LastUsedAt,
+			ExpiresAt:  family.ExpiresAt,
+			IPAddress:  family.IPAddress,
+			UserAgent:  family.UserAgent,
+		})
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+// RevokeSession signs out one of the user's own sessions.
+func (a *AuthService) RevokeSession(userID int, sessionID string) error {
+	var result *gorm.DB
+	switch {
+	case strings.HasPrefix(sessionID, sessionIDPrefix):
+		id, err := strconv.Atoi(strings.TrimPrefix(sessionID, sessionIDPrefix))
+		if err != nil {
+			return ErrSessionNotFound
+		}
+		result = a.db.Table("session").
+			Where("session_id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+			Update("revoked_at", time.Now())
+	case strings.HasPrefix(sessionID, tokenFamilyIDPrefix):
+		result = a.db.Table("refresh_token").
+			Where("family_id = ? AND user_id = ? AND revoked_at IS NULL", strings.TrimPrefix(sessionID, tokenFamilyIDPrefix), userID).
+			Update("revoked_at", time.Now())
+	default:
+		return ErrSessionNotFound
+	}
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke session: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeOtherSessions signs out everywhere except the caller's session and
+// returns how many logins were ended.
+func (a *AuthService) RevokeOtherSessions(userID int, currentID string) (int, error) {
+	sessions, err := a.ListSessions(userID, currentID)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, session := range sessions {
+		if session.Current {
+			continue
+		}
+		if err := a.RevokeSession(userID, session.ID); err != nil {
+			if errors.Is(err, ErrSessionNotFound) {
+				continue
+			}
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// ForceLogout ends every session and token family of userID on behalf of
+// an admin.
+func (a *AuthService) ForceLogout(actor Actor, userID int) error {
+	tx := a.db.Begin()
+
+	var exists bool
+	err := tx.Table("User").Select("COUNT(*) > 0").Where("user_id = ?", userID).Find(&exists).Error
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to look up user: %w", err)
+	}
+	if !exists {
+		tx.Rollback()
+		return ErrUserNotFound
+	}
+
+	if err := revokeUserSessions(tx, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := recordAudit(tx, actor, 0, "force_logout", fmt.Sprintf("user_id %d", userID)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// revokeUserSessions signs a user out everywhere. It takes the caller's
+// transaction so it can run as part of disabling an account or a card.
+func revokeUserSessions(tx *gorm.DB, userID int) error {
+	err := tx.Table("session").
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	err = tx.Table("refresh_token").
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// revokeStudentSessions signs out every login linked to studentID.
+func revokeStudentSessions(tx *gorm.DB, studentID int) error {
+	var userIDs []int
+	err := tx.Table("User").Where("student_id = ?", studentID).Pluck("user_id", &userIDs).Error
+	if err != nil {
+		return fmt.Errorf("failed to look up student logins: %w", err)
+	}
+
+	for _, userID := range userIDs {
+		if err := revokeUserSessions(tx, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+package subservices
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrStaffNotFound = errors.New("staff account not found")
+	ErrLastAdmin     = errors.New("cannot remove or demote the last active admin")
+	ErrInvalidRole   = errors.New("staff role must be Admin or LibraryAgent")
+	ErrSelfAction    = errors.New("you cannot disable or delete your own account")
+)
+
+var staffRoles = []string{"Admin", "LibraryAgent"}
+
+type StaffAccount struct {
+	UserID             int       `json:"user_id"`
+	Username           string    `json:"username"`
+	Email              *string   `json:"email"`
+	UserRole           string    `json:"user_role"`
+	IsActive           bool      `json:"is_active"`
+	MustChangePassword bool      `json:"must_change_password"`
+	BranchID           *int      `json:"branch_id"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// StaffService manages Admin and LibraryAgent logins. Every change that
+// could leave the system without an active admin is checked inside the
+// same transaction, with the admin rows locked.
+type StaffService struct {
+	db     *gorm.DB
+	policy *PasswordPolicy
+}
+
+func NewStaffServiceInstance(db *gorm.DB, policy *PasswordPolicy) *StaffService {
+	return &StaffService{db: db, policy: policy}
+}
+
+func (s *StaffService) ListStaff() ([]StaffAccount, error) {
+	var accounts []StaffAccount
+	err := s.db.Table("User").
+		Select("user_id, username, email, user_role, is_active, must_change_password, branch_id, created_at").
+		Where("user_role IN ?", staffRoles).
+		Order("username").
+		Scan(&accounts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list staff accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+// CreateStaff opens a staff login; branchID is the branch the account
+// works at and may be nil for staff covering every branch.
+func (s *StaffService) CreateStaff(actor Actor, username, email, role string, branchID *int) (*NewAccount, error) {
+	if !isStaffRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	temporaryPassword, err := s.policy.GenerateTemporaryPassword()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate temporary password: %w", err)
+	}
+
+	tx := s.db.Begin()
+
+	if branchID != nil {
+		if _, err := lookupBranch(tx, *branchID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	var userID int
+	err = tx.Raw(`
+		INSERT INTO "User" (username, password, user_role, email, must_change_password, branch_id)
+		VALUES (?, '', ?, NULLIF(?, ''), TRUE, ?)
+		RETURNING user_id
+	`, username, role, strings.TrimSpace(email), branchID).Scan(&userID).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create staff account: %w", err)
+	}
+
+	if err := s.policy.SetPassword(tx, userID, temporaryPassword, true); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := recordAudit(tx, actor, 0, "create_staff", fmt.Sprintf("user_id %d (%s, %s)", userID, username, role)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &NewAccount{Username: username, TemporaryPassword: temporaryPassword}, nil
+}
+
+func (s *StaffService) UpdateStaff(actor Actor, userID int, username, email string) error {
+	updates := map[string]interface{}{}
+	if username = strings.TrimSpace(username); username != "" {
+		updates["username"] = username
+	}
+	if email = strings.TrimSpace(email); email != "" {
+		updates["email"] = email
+	}
+	if len(updates) == 0 {
+		return fmt.Errorf("nothing to update")
+	}
+
+	tx := s.db.Begin()
+
+	if _, err := s.lockStaff(tx, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Table("User").Where("user_id = ?", userID).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update staff account: %w", err)
+	}
+
+	if err := recordAudit(tx, actor, 0, "update_staff", fmt.Sprintf("user_id %d", userID)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func (s *StaffService) SetStaffActive(actor Actor, userID int, active bool) error {
+	if !active && actor.UserID == userID {
+		return ErrSelfAction
+	}
+
+	tx := s.db.Begin()
+
+	account, err := s.lockStaff(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if !active && account.UserRole == "Admin" && account.IsActive {
+		if err := s.ensureAnotherActiveAdmin(tx, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Table("User").Where("user_id = ?", userID).Update("is_active", active).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update staff account: %w", err)
+	}
+
+	if !active {
+		if err := revokeUserSessions(tx, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	action := "enable_staff"
+	if !active {
+		action = "disable_staff"
+	}
+	if err := recordAudit(tx, actor, 0, action, fmt.Sprintf("user_id %d", userID)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func (s *StaffService) ChangeStaffRole(actor Actor, userID int, role string) error {
+	if !isStaffRole(role) {
+		return ErrInvalidRole
+	}
+
+	tx := s.db.Begin()
+
+	account, err := s.lockStaff(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if account.UserRole == "Admin" && role != "Admin" && account.IsActive {
+		if err := s.ensureAnotherActiveAdmin(tx, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Table("User").Where("user_id = ?", userID).Update("user_role", role).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to change role: %w", err)
+	}
+
+	// Sessions and tokens carry the role, so the account signs in again
+	// under the new one.
+	if role != account.UserRole {
+		if err := revokeUserSessions(tx, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	details := fmt.Sprintf("user_id %d: %s -> %s", userID, account.UserRole, role)
+	if err := recordAudit(tx, actor, 0, "change_staff_role", details); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// SetStaffBranch moves a staff account to another branch; nil leaves it
+// without one, so its desk operations cover every branch.
+func (s *StaffService) SetStaffBranch(actor Actor, userID int, branchID *int) error {
+	tx := s.db.Begin()
+
+	if _, err := s.lockStaff(tx, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	details := fmt.Sprintf("user_id %d: no branch", userID)
+	if branchID != nil {
+		branch, err := lookupBranch(tx, *branchID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		details = fmt.Sprintf("user_id %d: branch_id %d (%s)", userID, branch.BranchID, branch.Name)
+	}
+
+	if err := tx.Table("User").Where("user_id = ?", userID).Update("branch_id", branchID).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to set staff branch: %w", err)
+	}
+
+	if err := recordAudit(tx, actor, 0, "set_staff_branch", details); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func (s *StaffService) ResetStaffPassword(actor Actor, userID int) (*NewAccount, error) {
+	temporaryPassword, err := s.policy.GenerateTemporaryPassword()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate temporary password: %w", err)
+	}
+
+	tx := s.db.Begin()
+
+	account, err := s.lockStaff(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := s.policy.SetPassword(tx, userID, temporaryPassword, true); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// A reset usually means the old password leaked; end whatever it
+	// signed in.
+	if err := revokeUserSessions(tx, userID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := recordAudit(tx, actor, 0, "reset_staff_password", fmt.Sprintf("user_id %d", userID)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &NewAccount{Username: account.Username, TemporaryPassword: temporaryPassword}, nil
+}
+
+func (s *StaffService) DeleteStaff(actor Actor, userID int) error {
+	if actor.UserID == userID {
+		return ErrSelfAction
+	}
+
+	tx := s.db.Begin()
+
+	account, err := s.lockStaff(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if account.UserRole == "Admin" && account.IsActive {
+		if err := s.ensureAnotherActiveAdmin(tx, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Exec(`DELETE FROM "User" WHERE user_id = ?`, userID).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete staff account: %w", err)
+	}
+
+	details := fmt.Sprintf("user_id %d (%s)", userID, account.Username)
+	if err := recordAudit(tx, actor, 0, "delete_staff", details); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func (s *StaffService) lockStaff(tx *gorm.DB, userID int) (*StaffAccount, error) {
+	var account StaffAccount
+	err := tx.Raw(`
+		SELECT user_id, username, email, user_role, is_active, must_change_password, branch_id, created_at
+		FROM "User"
+		WHERE user_id = ? AND user_role IN ?
+		FOR UPDATE
+	`, userID, staffRoles).Scan(&account).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch staff account: %w", err)
+	}
+	if account.UserID == 0 {
+		return nil, ErrStaffNotFound
+	}
+	return &account, nil
+}
+
+// ensureAnotherActiveAdmin locks every active admin row so two concurrent
+// requests cannot each remove a different "other" admin.
+func (s *StaffService) ensureAnotherActiveAdmin(tx *gorm.DB, excludingUserID int) error {
+	var adminIDs []int
+	err := tx.Raw(`
+		SELECT user_id FROM "User"
+		WHERE user_role = 'Admin' AND is_active = TRUE
+		FOR UPDATE
+	`).Scan(&adminIDs).Error
+	if err != nil {
+		return fmt.Errorf("failed to check remaining admins: %w", err)
+	}
+
+	for _, id := range adminIDs {
+		if id != excludingUserID {
+			return nil
+		}
+	}
+	return ErrLastAdmin
+}
+
+func isStaffRole(role string) bool {
+	for _, r := range staffRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,441 @@
+package subservices
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	StocktakeOpen   = "open"
+	StocktakeClosed = "closed"
+)
+
+// Scan results, from the point of view of the location being counted.
+const (
+	ScanRecorded         = "recorded"
+	ScanDuplicate        = "duplicate"
+	ScanUnknown          = "unknown"
+	ScanMisplaced        = "misplaced"
+	ScanOnLoan           = "on_loan"
+	ScanUnexpectedStatus = "unexpected_status"
+	ScanInvalid          = "invalid"
+)
+
+// stocktakeMaxScans bounds one upload; scanners send their buffer in parts.
+const stocktakeMaxScans = 5000
+
+const stocktakeSessionColumns = "session_id, location_id, status, opened_by, opened_at, closed_by, closed_at, marked_missing"
+
+const stocktakeCopyColumns = "bc.copy_id, bc.barcode, bc.book_code, b.title, bc.location_id, lp.display_label AS location, bc.status"
+
+// stocktakeScope matches the copies shelved in a location or anywhere below it.
+const stocktakeScope = "bc.location_id IN (SELECT location_id FROM location_path WHERE ? = ANY(ancestors))"
+
+var (
+	ErrStocktakeNotFound     = errors.New("stocktake session not found")
+	ErrStocktakeClosed       = errors.New("stocktake session is closed")
+	ErrStocktakeLocationBusy = errors.New("a stocktake is already open for this location")
+	ErrInvalidStocktake      = errors.New("invalid stocktake")
+)
+
+type StocktakeSession struct {
+	SessionID     int        `json:"session_id"`
+	LocationID    int        `json:"location_id"`
+	Location      string     `json:"location" gorm:"-"`
+	Status        string     `json:"status"`
+	OpenedBy      *int       `json:"opened_by"`
+	OpenedAt      time.Time  `json:"opened_at"`
+	ClosedBy      *int       `json:"closed_by"`
+	ClosedAt      *time.Time `json:"closed_at"`
+	MarkedMissing int        `json:"marked_missing"`
+}
+
+type StocktakeScanResult struct {
+	Barcode  string  `json:"barcode"`
+	Result   string  `json:"result"`
+	CopyID   int     `json:"copy_id,omitempty"`
+	Status   string  `json:"status,omitempty"`
+	Location *string `json:"location,omitempty"`
+}
+
+type StocktakeCopy struct {
+	CopyID     int     `json:"copy_id"`
+	Barcode    string  `json:"barcode"`
+	BookCode   string  `json:"book_code"`
+	Title      string  `json:"title"`
+	LocationID *int    `json:"location_id"`
+	Location   *string `json:"location"`
+	InScope    bool    `json:"-"`
+	Status     string  `json:"status"`
+}
+
+// StocktakeReconciliation compares the scans of a session with Book_copy.
+// A scanned copy can appear in more than one list.
+type StocktakeReconciliation struct {
+	Session          StocktakeSession `json:"session"`
+	Expected         int              `json:"expected"`
+	Scanned          int              `json:"scanned"`
+	Missing          []StocktakeCopy  `json:"missing"`
+	Misplaced        []StocktakeCopy  `json:"misplaced"`
+	OnLoan           []StocktakeCopy  `json:"on_loan"`
+	UnexpectedStatus []StocktakeCopy  `json:"unexpected_status"`
+	Unknown          []string         `json:"unknown"`
+}
+
+// OpenStocktake starts counting a location, usually a rack or a shelf; the
+// copies of every location below it are expected too. Only one session per
+// location can be open at a time.
+func (l *LibraryAgentService) OpenStocktake(actor Actor, locationID int) (*StocktakeSession, error) {
+	tx := l.db.Begin()
+
+	location, err := lookupLocation(tx, locationID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var busy bool
+	err = tx.Table("stocktake_session").Select("COUNT(*) > 0").Where("location_id = ? AND status = ?", locationID, StocktakeOpen).Find(&busy).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to check open stocktakes: %w", err)
+	}
+	if busy {
+		tx.Rollback()
+		return nil, fmt.Errorf("%w: %s", ErrStocktakeLocationBusy, location.DisplayLabel)
+	}
+
+	var openedBy, openedAPIKeyID *int
+	if actor.UserID != 0 {
+		openedBy = &actor.UserID
+	}
+	if actor.APIKeyID != 0 {
+		openedAPIKeyID = &actor.APIKeyID
+	}
+	var sessionID int
+	err = tx.Raw(`
+		INSERT INTO stocktake_session (location_id, opened_by, opened_api_key_id)
+		VALUES (?, ?, ?)
+		RETURNING session_id
+	`, locationID, openedBy, openedAPIKeyID).Scan(&sessionID).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to open stocktake: %w", err)
+	}
+
+	if err := recordAudit(tx, actor, 0, "open_stocktake", fmt.Sprintf("session %d, %s", sessionID, location.DisplayLabel)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	session, err := lockStocktake(tx, sessionID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return session, nil
+}
+
+// RecordStocktakeScans adds scanned barcodes to an open session and reports
+// right away what each one means for the location. Scanning a barcode twice is
+// harmless.
+func (l *LibraryAgentService) RecordStocktakeScans(sessionID int, barcodes []string) ([]StocktakeScanResult, error) {
+	if len(barcodes) > stocktakeMaxScans {
+		return nil, fmt.Errorf("%w: at most %d barcodes per upload", ErrInvalidStocktake, stocktakeMaxScans)
+	}
+
+	tx := l.db.Begin()
+
+	session, err := lockStocktake(tx, sessionID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if session.Status != StocktakeOpen {
+		tx.Rollback()
+		return nil, ErrStocktakeClosed
+	}
+
+	lookup := make([]string, 0, len(barcodes))
+	for _, barcode := range barcodes {
+		if barcode = strings.TrimSpace(barcode); barcode != "" {
+			lookup = append(lookup, barcode)
+		}
+	}
+
+	copies := map[string]StocktakeCopy{}
+	if len(lookup) > 0 {
+		var found []StocktakeCopy
+		err := tx.Table("book_copy bc").
+			Select(stocktakeCopyColumns+", COALESCE("+stocktakeScope+", FALSE) AS in_scope", session.LocationID).
+			Joins("JOIN book b ON b.book_code = bc.book_code").
+			Joins("LEFT JOIN location_path lp ON lp.location_id = bc.location_id").
+			Where("bc.barcode IN ?", lookup).
+			Scan(&found).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to look up barcodes: %w", err)
+		}
+		for _, bookCopy := range found {
+			copies[bookCopy.Barcode] = bookCopy
+		}
+	}
+
+	results := make([]StocktakeScanResult, 0, len(lookup))
+	for _, barcode := range lookup {
+		result := StocktakeScanResult{Barcode: barcode}
+		if len(barcode) > 50 {
+			result.Result = ScanInvalid
+			results = append(results, result)
+			continue
+		}
+
+		bookCopy, known := copies[barcode]
+		var copyID interface{}
+		if known {
+			copyID = bookCopy.CopyID
+			result.CopyID, result.Status, result.Location = bookCopy.CopyID, bookCopy.Status, bookCopy.Location
+		}
+
+		inserted := tx.Exec(`
+			INSERT INTO stocktake_scan (session_id, barcode, copy_id)
+			VALUES (?, ?, ?)
+			ON CONFLICT (session_id, barcode) DO NOTHING
+		`, sessionID, barcode, copyID)
+		if inserted.Error != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to record scan: %w", inserted.Error)
+		}
+
+		switch {
+		case inserted.RowsAffected == 0:
+			result.Result = ScanDuplicate
+		case !known:
+			result.Result = ScanUnknown
+		case bookCopy.Status == CopyOnLoan:
+			result.Result = ScanOnLoan
+		case bookCopy.Status != CopyAvailable:
+			result.Result = ScanUnexpectedStatus
+		case !bookCopy.InScope:
+			result.Result = ScanMisplaced
+		default:
+			result.Result = ScanRecorded
+		}
+		results = append(results, result)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return results, nil
+}
+
+// GetStocktake returns the session with its reconciliation so far.
+func (l *LibraryAgentService) GetStocktake(sessionID int) (*StocktakeReconciliation, error) {
+	var session StocktakeSession
+	err := l.db.Table("stocktake_session").Select(stocktakeSessionColumns).Where("session_id = ?", sessionID).Scan(&session).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch stocktake session: %w", err)
+	}
+	if session.SessionID == 0 {
+		return nil, ErrStocktakeNotFound
+	}
+	if err := setStocktakeLocation(l.db, &session); err != nil {
+		return nil, err
+	}
+	return reconcileStocktake(l.db, &session)
+}
+
+// CloseStocktake ends a session and returns its reconciliation. With
+// markMissing, copies expected in the location but not scanned are set to
+// missing in the same transaction.
+func (l *LibraryAgentService) CloseStocktake(actor Actor, sessionID int, markMissing bool) (*StocktakeReconciliation, error) {
+	tx := l.db.Begin()
+
+	session, err := lockStocktake(tx, sessionID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if session.Status != StocktakeOpen {
+		tx.Rollback()
+		return nil, ErrStocktakeClosed
+	}
+
+	reconciliation, err := reconcileStocktake(tx, session)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	marked := 0
+	if markMissing {
+		reason := fmt.Sprintf("not found in stocktake %d of %s", session.SessionID, session.Location)
+		for i := range reconciliation.Missing {
+			bookCopy, err := lockCopy(tx, reconciliation.Missing[i].CopyID)
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			// A copy checked out since the count started is not missing.
+			if bookCopy.Status != CopyAvailable {
+				continue
+			}
+			if err := setCopyStatus(tx, actor, bookCopy, CopyMissing, reason); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			reconciliation.Missing[i].Status = CopyMissing
+			marked++
+		}
+	}
+
+	now := time.Now()
+	update := map[string]interface{}{
+		"status":         StocktakeClosed,
+		"closed_at":      now,
+		"marked_missing": marked,
+	}
+	if actor.UserID != 0 {
+		update["closed_by"] = actor.UserID
+	}
+	if actor.APIKeyID != 0 {
+		update["closed_api_key_id"] = actor.APIKeyID
+	}
+	if err := tx.Table("stocktake_session").Where("session_id = ?", sessionID).Updates(update).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to close stocktake: %w", err)
+	}
+
+	details := fmt.Sprintf("session %d, %s: %d expected, %d scanned, %d missing (%d marked), %d misplaced, %d unknown",
+		session.SessionID, session.Location, reconciliation.Expected, reconciliation.Scanned,
+		len(reconciliation.Missing), marked, len(reconciliation.Misplaced), len(reconciliation.Unknown))
+	if err := recordAudit(tx, actor, 0, "close_stocktake", details); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	session.Status = StocktakeClosed
+	session.ClosedAt = &now
+	if actor.UserID != 0 {
+		session.ClosedBy = &actor.UserID
+	}
+	session.MarkedMissing = marked
+	reconciliation.Session = *session
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return reconciliation, nil
+}
+
+func lockStocktake(tx *gorm.DB, sessionID int) (*StocktakeSession, error) {
+	var session StocktakeSession
+	err := tx.Raw(`
+		SELECT `+stocktakeSessionColumns+`
+		FROM stocktake_session
+		WHERE session_id = ?
+		FOR UPDATE
+	`, sessionID).Scan(&session).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch stocktake session: %w", err)
+	}
+	if session.SessionID == 0 {
+		return nil, ErrStocktakeNotFound
+	}
+	if err := setStocktakeLocation(tx, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func setStocktakeLocation(db *gorm.DB, session *StocktakeSession) error {
+	location, err := lookupLocation(db, session.LocationID)
+	if err != nil {
+		return err
+	}
+	session.Location = location.DisplayLabel
+	return nil
+}
+
+// reconcileStocktake compares the session's scans with the copies that
+// should be found, which are the available ones shelved in the location or
+// below it.
+func reconcileStocktake(db *gorm.DB, session *StocktakeSession) (*StocktakeReconciliation, error) {
+	reconciliation := &StocktakeReconciliation{
+		Session:          *session,
+		Missing:          []StocktakeCopy{},
+		Misplaced:        []StocktakeCopy{},
+		OnLoan:           []StocktakeCopy{},
+		UnexpectedStatus: []StocktakeCopy{},
+		Unknown:          []string{},
+	}
+
+	var expected int64
+	err := db.Table("book_copy bc").Where(stocktakeScope, session.LocationID).Where("bc.status = ?", CopyAvailable).Count(&expected).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count expected copies: %w", err)
+	}
+	reconciliation.Expected = int(expected)
+
+	err = db.Table("book_copy bc").
+		Select(stocktakeCopyColumns).
+		Joins("JOIN book b ON b.book_code = bc.book_code").
+		Joins("LEFT JOIN location_path lp ON lp.location_id = bc.location_id").
+		Where(stocktakeScope, session.LocationID).
+		Where("bc.status = ?", CopyAvailable).
+		Where("NOT EXISTS (SELECT 1 FROM stocktake_scan s WHERE s.session_id = ? AND s.copy_id = bc.copy_id)", session.SessionID).
+		Order("bc.barcode").
+		Scan(&reconciliation.Missing).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find missing copies: %w", err)
+	}
+
+	var scanned []StocktakeCopy
+	err = db.Table("stocktake_scan s").
+		Select(stocktakeCopyColumns+", COALESCE("+stocktakeScope+", FALSE) AS in_scope", session.LocationID).
+		Joins("JOIN book_copy bc ON bc.copy_id = s.copy_id").
+		Joins("JOIN book b ON b.book_code = bc.book_code").
+		Joins("LEFT JOIN location_path lp ON lp.location_id = bc.location_id").
+		Where("s.session_id = ?", session.SessionID).
+		Order("bc.barcode").
+		Scan(&scanned).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch scanned copies: %w", err)
+	}
+	for _, bookCopy := range scanned {
+		if !bookCopy.InScope {
+			reconciliation.Misplaced = append(reconciliation.Misplaced, bookCopy)
+		}
+		switch bookCopy.Status {
+		case CopyAvailable:
+		case CopyOnLoan:
+			reconciliation.OnLoan = append(reconciliation.OnLoan, bookCopy)
+		default:
+			reconciliation.UnexpectedStatus = append(reconciliation.UnexpectedStatus, bookCopy)
+		}
+	}
+
+	err = db.Table("stocktake_scan").
+		Where("session_id = ? AND copy_id IS NULL", session.SessionID).
+		Order("barcode").
+		Pluck("barcode", &reconciliation.Unknown).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch unknown barcodes: %w", err)
+	}
+
+	var total int64
+	if err := db.Table("stocktake_scan").Where("session_id = ?", session.SessionID).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count scans: %w", err)
+	}
+	reconciliation.Scanned = int(total)
+	return reconciliation, nil
+}
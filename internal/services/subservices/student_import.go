@@ -0,0 +1,350 @@
+package subservices
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	importBatchSize = 100
+	importMaxRows   = 5000
+)
+
+const (
+	ImportRowValid   = "valid"
+	ImportRowInvalid = "invalid"
+	ImportRowCreated = "created"
+	ImportRowFailed  = "failed"
+)
+
+var ErrInvalidImportFile = errors.New("invalid CSV file")
+
+var importRequiredColumns = []string{"first_name", "last_name", "email", "phone", "postal_address"}
+
+type ImportRowResult struct {
+	Row               int      `json:"row"`
+	Status            string   `json:"status"`
+	Email             string   `json:"email"`
+	Errors            []string `json:"errors,omitempty"`
+	StudentID         int      `json:"student_id,omitempty"`
+	Username          string   `json:"username,omitempty"`
+	TemporaryPassword string   `json:"temporary_password,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Valid   int               `json:"valid"`
+	Invalid int               `json:"invalid"`
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+type importRow struct {
+	result     *ImportRowResult
+	input      StudentInput
+	cardActive bool
+}
+
+// ImportStudents enrolls students from a CSV file with the columns
+// first_name, last_name, email, phone, postal_address and an optional
+// card_status (active/inactive). Every row is validated first, including
+// email and phone uniqueness within the file and against existing students.
+// In dry-run mode nothing is written. Otherwise valid rows are created in
+// batches; each row runs under a savepoint, so one failing row does not
+// undo the rest of its batch. If a batch cannot be written the import
+// stops there, and the report is returned with the error because the
+// students of earlier batches already exist.
+func (a *AdministratorService) ImportStudents(actor Actor, file io.Reader, dryRun bool) (*ImportReport, error) {
+	rows, err := parseImportFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.checkImportDuplicates(rows); err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{DryRun: dryRun, Total: len(rows), Rows: make([]ImportRowResult, 0, len(rows))}
+	var valid []importRow
+	for _, row := range rows {
+		if len(row.result.Errors) > 0 {
+			row.result.Status = ImportRowInvalid
+			report.Invalid++
+			continue
+		}
+		row.result.Status = ImportRowValid
+		report.Valid++
+		valid = append(valid, row)
+	}
+
+	var importErr error
+	if !dryRun {
+		for start := 0; start < len(valid); start += importBatchSize {
+			end := start + importBatchSize
+			if end > len(valid) {
+				end = len(valid)
+			}
+			if importErr = a.importBatch(actor, valid[start:end]); importErr != nil {
+				failImportRows(valid[start:end], "batch could not be committed")
+				failImportRows(valid[end:], "not imported after an earlier batch failed")
+				break
+			}
+		}
+
+		for _, row := range valid {
+			if row.result.Status == ImportRowCreated {
+				report.Created++
+			} else {
+				report.Failed++
+			}
+		}
+
+		tx := a.db.Begin()
+		details := fmt.Sprintf("%d rows, %d created, %d invalid, %d failed", report.Total, report.Created, report.Invalid, report.Failed)
+		if err := recordAudit(tx, actor, 0, "import_students", details); err != nil {
+			tx.Rollback()
+			if importErr == nil {
+				importErr = err
+			}
+		} else if err := tx.Commit().Error; err != nil && importErr == nil {
+			importErr = fmt.Errorf("failed to commit transaction: %w", err)
+		}
+	}
+
+	for _, row := range rows {
+		report.Rows = append(report.Rows, *row.result)
+	}
+	return report, importErr
+}
+
+func (a *AdministratorService) importBatch(actor Actor, batch []importRow) error {
+	tx := a.db.Begin()
+
+	for i, row := range batch {
+		savepoint := fmt.Sprintf("import_row_%d", i)
+		if err := tx.SavePoint(savepoint).Error; err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to create savepoint: %w", err)
+		}
+
+		account, studentID, err := a.createStudentWithCard(tx, actor, row.input, row.cardActive)
+		if err != nil {
+			if rollbackErr := tx.RollbackTo(savepoint).Error; rollbackErr != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to roll back row %d: %w", row.result.Row, rollbackErr)
+			}
+			row.result.Status = ImportRowFailed
+			row.result.Errors = append(row.result.Errors, err.Error())
+			continue
+		}
+
+		row.result.Status = ImportRowCreated
+		row.result.StudentID = studentID
+		row.result.Username = account.Username
+		row.result.TemporaryPassword = account.TemporaryPassword
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit import batch: %w", err)
+	}
+	return nil
+}
+
+// failImportRows marks rows whose batch was rolled back, or never written,
+// as failed and drops the credentials of students that do not exist.
+func failImportRows(rows []importRow, reason string) {
+	for _, row := range rows {
+		if row.result.Status == ImportRowFailed {
+			continue
+		}
+		row.result.Status = ImportRowFailed
+		row.result.StudentID, row.result.Username, row.result.TemporaryPassword = 0, "", ""
+		row.result.Errors = append(row.result.Errors, reason)
+	}
+}
+
+func parseImportFile(file io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing header row", ErrInvalidImportFile)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	for _, required := range importRequiredColumns {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: missing column %s", ErrInvalidImportFile, required)
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+		if len(rows) == importMaxRows {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrInvalidImportFile, importMaxRows)
+		}
+
+		field := func(name string) string {
+			index, ok := columns[name]
+			if !ok || index >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[index])
+		}
+
+		if strings.Join(record, "") == "" {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		row := importRow{
+			result: &ImportRowResult{Row: line, Email: field("email")},
+			input: StudentInput{
+				FirstName:     field("first_name"),
+				LastName:      field("last_name"),
+				Email:         field("email"),
+				Phone:         field("phone"),
+				PostalAddress: field("postal_address"),
+			},
+			cardActive: true,
+		}
+		row.validate(field("card_status"))
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: no data rows", ErrInvalidImportFile)
+	}
+	return rows, nil
+}
+
+func (r *importRow) validate(cardStatus string) {
+	checkLength := func(column, value string, max int) {
+		if value == "" {
+			r.addError(column + " is required")
+		} else if utf8.RuneCountInString(value) > max {
+			r.addError(fmt.Sprintf("%s is longer than %d characters", column, max))
+		}
+	}
+
+	fields := r.input.fields()
+	for _, field := range studentFieldLimits {
+		checkLength(field.column, fields[field.column], field.max)
+	}
+
+	if r.input.Email != "" {
+		if address, err := mail.ParseAddress(r.input.Email); err != nil || address.Address != r.input.Email {
+			r.addError("email is not a valid address")
+		}
+	}
+
+	switch strings.ToLower(cardStatus) {
+	case "", "active", "true", "1":
+		r.cardActive = true
+	case "inactive", "false", "0":
+		r.cardActive = false
+	default:
+		r.addError("card_status must be active or inactive")
+	}
+}
+
+func (r *importRow) addError(message string) {
+	r.result.Errors = append(r.result.Errors, message)
+}
+
+// checkImportDuplicates flags emails and phones that repeat within the file
+// or already belong to a student, matching the UNIQUE constraints.
+func (a *AdministratorService) checkImportDuplicates(rows []importRow) error {
+	firstEmail := map[string]int{}
+	firstPhone := map[string]int{}
+	var emails, phones []string
+
+	for _, row := range rows {
+		email := strings.ToLower(row.input.Email)
+		if email != "" {
+			if line, ok := firstEmail[email]; ok {
+				row.addError(fmt.Sprintf("email duplicates row %d", line))
+			} else {
+				firstEmail[email] = row.result.Row
+				emails = append(emails, row.input.Email)
+			}
+		}
+
+		if row.input.Phone != "" {
+			if line, ok := firstPhone[row.input.Phone]; ok {
+				row.addError(fmt.Sprintf("phone duplicates row %d", line))
+			} else {
+				firstPhone[row.input.Phone] = row.result.Row
+				phones = append(phones, row.input.Phone)
+			}
+		}
+	}
+
+	existingEmails, err := a.existingStudentValues("email", emails)
+	if err != nil {
+		return err
+	}
+	existingPhones, err := a.existingStudentValues("phone", phones)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if existingEmails[strings.ToLower(row.input.Email)] {
+			row.addError("email already belongs to a student")
+		}
+		if existingPhones[strings.ToLower(row.input.Phone)] {
+			row.addError("phone already belongs to a student")
+		}
+	}
+	return nil
+}
+
+// existingStudentValues returns which of values are already used in column,
+// ignoring case as the in-file duplicate check does.
+func (a *AdministratorService) existingStudentValues(column string, values []string) (map[string]bool, error) {
+	lowered := make([]string, len(values))
+	for i, value := range values {
+		lowered[i] = strings.ToLower(value)
+	}
+
+	existing := map[string]bool{}
+	for start := 0; start < len(lowered); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(lowered) {
+			end = len(lowered)
+		}
+
+		var found []string
+		err := a.db.Table("student").
+			Where("LOWER("+column+") IN ?", lowered[start:end]).
+			Pluck(column, &found).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to check existing %s values: %w", column, err)
+		}
+		for _, value := range found {
+			existing[strings.ToLower(value)] = true
+		}
+	}
+	return existing, nil
+}
@@ -0,0 +1,294 @@
+package subservices
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+const (
+	StudentActive   = "active"
+	StudentInactive = "inactive"
+	StudentArchived = "archived"
+)
+
+var (
+	ErrStudentNotFound     = errors.New("student not found")
+	ErrStudentArchived     = errors.New("archived student records cannot be changed")
+	ErrStudentHasOpenLoans = errors.New("student still has books on loan")
+	ErrStudentContactTaken = errors.New("email or phone already belongs to another student")
+	ErrInvalidStudentField = errors.New("invalid student field")
+)
+
+// studentFieldLimits mirrors the Student column definitions.
+var studentFieldLimits = []struct {
+	column string
+	max    int
+}{
+	{"first_name", 50},
+	{"last_name", 50},
+	{"email", 100},
+	{"phone", 15},
+	{"postal_address", 255},
+}
+
+const studentRecordColumns = "student_id, first_name, last_name, email, phone, postal_address, status, status_changed_at"
+
+type StudentRecord struct {
+	StudentID       int        `json:"student_id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Email           string     `json:"email"`
+	Phone           string     `json:"phone"`
+	PostalAddress   string     `json:"postal_address"`
+	Status          string     `json:"status"`
+	StatusChangedAt *time.Time `json:"status_changed_at"`
+}
+
+func (i StudentInput) fields() map[string]string {
+	return map[string]string{
+		"first_name":     i.FirstName,
+		"last_name":      i.LastName,
+		"email":          i.Email,
+		"phone":          i.Phone,
+		"postal_address": i.PostalAddress,
+	}
+}
+
+// UpdateStudent changes the non-empty fields of input. Archived records are
+// read-only.
+func (a *AdministratorService) UpdateStudent(actor Actor, studentID int, input StudentInput) (*StudentRecord, error) {
+	updates := map[string]interface{}{}
+	var changed []string
+	fields := input.fields()
+	for _, field := range studentFieldLimits {
+		value := strings.TrimSpace(fields[field.column])
+		if value == "" {
+			continue
+		}
+		if utf8.RuneCountInString(value) > field.max {
+			return nil, fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidStudentField, field.column, field.max)
+		}
+		updates[field.column] = value
+		changed = append(changed, field.column)
+	}
+	if len(updates) == 0 {
+		return nil, fmt.Errorf("%w: nothing to update", ErrInvalidStudentField)
+	}
+	if email, ok := updates["email"].(string); ok {
+		if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+			return nil, fmt.Errorf("%w: email is not a valid address", ErrInvalidStudentField)
+		}
+	}
+
+	tx := a.db.Begin()
+
+	student, err := lockStudent(tx, studentID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if student.Status == StudentArchived {
+		tx.Rollback()
+		return nil, ErrStudentArchived
+	}
+
+	var taken bool
+	err = tx.Table("student").
+		Select("COUNT(*) > 0").
+		Where("student_id <> ? AND (LOWER(email) = LOWER(?) OR phone = ?)", studentID, updates["email"], updates["phone"]).
+		Find(&taken).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to check student contact details: %w", err)
+	}
+	if taken {
+		tx.Rollback()
+		return nil, ErrStudentContactTaken
+	}
+
+	if err := tx.Table("student").Where("student_id = ?", studentID).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update student: %w", err)
+	}
+
+	if err := recordAudit(tx, actor, studentID, "update_student", strings.Join(changed, ", ")); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	student, err = lockStudent(tx, studentID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return student, nil
+}
+
+// SetStudentActive deactivates or reactivates a student. A deactivated
+// student keeps their record and open loans but cannot sign in or borrow.
+func (a *AdministratorService) SetStudentActive(actor Actor, studentID int, active bool) error {
+	status, action := StudentInactive, "deactivate_student"
+	if active {
+		status, action = StudentActive, "reactivate_student"
+	}
+
+	tx := a.db.Begin()
+
+	student, err := lockStudent(tx, studentID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if student.Status == StudentArchived {
+		tx.Rollback()
+		return ErrStudentArchived
+	}
+
+	if err := setStudentStatus(tx, studentID, status); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := recordAudit(tx, actor, studentID, action, ""); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// ArchiveStudent retires the record of someone who left. The student and
+// their loan history stay in place for statistics, but the login and card
+// are switched off and the record can no longer be changed.
+func (a *AdministratorService) ArchiveStudent(actor Actor, studentID int) error {
+	tx := a.db.Begin()
+
+	student, err := lockStudent(tx, studentID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if student.Status == StudentArchived {
+		tx.Rollback()
+		return ErrStudentArchived
+	}
+
+	if err := ensureNoOpenLoans(tx, studentID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := setStudentStatus(tx, studentID, StudentArchived); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := suspendStudentCards(tx, actor, studentID, "student archived"); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := recordAudit(tx, actor, studentID, "archive_student", ""); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// DeleteStudent removes the student, their card and login. It is refused
+// while loans are open; past loans are kept with student_id set to NULL.
+func (a *AdministratorService) DeleteStudent(actor Actor, studentID int) error {
+	tx := a.db.Begin()
+
+	student, err := lockStudent(tx, studentID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := ensureNoOpenLoans(tx, studentID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := revokeStudentSessions(tx, studentID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Exec("DELETE FROM student WHERE student_id = ?", studentID).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete student: %w", err)
+	}
+
+	// The audit row cannot reference the deleted student, so it names them.
+	details := fmt.Sprintf("student_id %d (%s %s)", studentID, student.FirstName, student.LastName)
+	if err := recordAudit(tx, actor, 0, "delete_student", details); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func lockStudent(tx *gorm.DB, studentID int) (*StudentRecord, error) {
+	var student StudentRecord
+	err := tx.Raw(`
+		SELECT `+studentRecordColumns+`
+		FROM student
+		WHERE student_id = ?
+		FOR UPDATE
+	`, studentID).Scan(&student).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch student: %w", err)
+	}
+	if student.StudentID == 0 {
+		return nil, ErrStudentNotFound
+	}
+	return &student, nil
+}
+
+// setStudentStatus keeps the student's login in step with the record: only
+// active students can sign in.
+func setStudentStatus(tx *gorm.DB, studentID int, status string) error {
+	err := tx.Table("student").Where("student_id = ?", studentID).Updates(map[string]interface{}{
+		"status":            status,
+		"status_changed_at": time.Now(),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update student status: %w", err)
+	}
+
+	active := status == StudentActive
+	if err := tx.Table("User").Where("student_id = ?", studentID).Update("is_active", active).Error; err != nil {
+		return fmt.Errorf("failed to update student login: %w", err)
+	}
+
+	if !active {
+		return revokeStudentSessions(tx, studentID)
+	}
+	return nil
+}
+
+func ensureNoOpenLoans(tx *gorm.DB, studentID int) error {
+	var openLoans int64
+	err := tx.Table("loan").Where("student_id = ? AND return_date IS NULL", studentID).Count(&openLoans).Error
+	if err != nil {
+		return fmt.Errorf("failed to check open loans: %w", err)
+	}
+	if openLoans > 0 {
+		return fmt.Errorf("%w (%d open)", ErrStudentHasOpenLoans, openLoans)
+	}
+	return nil
+}
@@ -1,7 +1,6 @@
 package subservices
 
 import (
-	"fmt"
 	"log"
 
 	"gorm.io/gorm"
@@ -19,7 +18,7 @@ func (s *StudentService) GetAvailableResources() ([]map[string]interface{}, erro
 	var resources []map[string]interface{}
 
 	err := s.db.Table("available_copies").
-		Select("title, authors, languages, publisher, available_copies").
+		Select("title, authors, languages, publisher, available_copies, locations").
 		Scan(&resources).Error
 
 	if err != nil {
@@ -30,30 +29,6 @@ func (s *StudentService) GetAvailableResources() ([]map[string]interface{}, erro
 	return resources, nil
 }
 
-func (s *StudentService) ChangePassword(studentID int, oldPassword, newPassword string) error {
-    var storedPassword string
-
-    err := s.db.Table("User").Select("password").Where("student_id = ?", studentID).Scan(&storedPassword).Error
-    if err != nil {
-        return fmt.Errorf("failed to fetch stored password: %w", err)
-    }
-
-    if storedPassword != oldPassword {
-        return fmt.Errorf("old password does not match")
-    }
-
-    result := s.db.Table("User").Where("student_id = ?", studentID).Update("password", newPassword)
-    if result.Error != nil {
-        return fmt.Errorf("failed to update password: %w", result.Error)
-    }
-
-    if result.RowsAffected == 0 {
-        return fmt.Errorf("no rows were updated, check if student_id is valid")
-    }
-
-    return nil
-}
-
 func (s *StudentService) GetLoansByStudentID(studentID int) ([]map[string]interface{}, error) {
 	var loans []map[string]interface{}
 
@@ -69,9 +44,9 @@ func (s *StudentService) GetLoansByStudentID(studentID int) ([]map[string]interf
 
 func (s *StudentService) ViewStudentProfile(studentID int) (map[string]interface{}, error) {
 	var profile map[string]interface{}
-	err := s.db.Table("users").
+	err := s.db.Table("student").
 		Select("first_name, last_name, email, phone, postal_address").
-		Where("user_id = ?", studentID).
-		First(&profile).Error
+		Where("student_id = ?", studentID).
+		Take(&profile).Error
 	return profile, err
 }
@@ -0,0 +1,324 @@
+package subservices
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Transfer kinds: a copy returned away from its home branch goes back as a
+// return, stock moved on purpose as a transfer.
+const (
+	TransferReturn = "return"
+	TransferStock  = "transfer"
+)
+
+const (
+	TransferInTransit = "in_transit"
+	TransferReceived  = "received"
+	TransferCancelled = "cancelled"
+)
+
+// transferMax bounds one shipment, about a crate of books.
+const transferMax = 200
+
+const transferColumns = `t.transfer_id, t.copy_id, bc.barcode, b.title,
+	t.from_branch_id, fb.name AS from_branch, t.to_branch_id, tb.name AS to_branch,
+	t.kind, t.status, t.reason, t.sent_by, t.sent_at, t.received_by, t.received_at`
+
+var (
+	ErrTransferNotFound = errors.New("transfer not found")
+	ErrTransferNotOpen  = errors.New("transfer is no longer in transit")
+	ErrWrongBranch      = errors.New("transfer is addressed to another branch")
+	ErrCopyElsewhere    = errors.New("copy belongs to another branch")
+	ErrInvalidTransfer  = errors.New("invalid transfer")
+)
+
+type CopyTransfer struct {
+	TransferID   int        `json:"transfer_id"`
+	CopyID       int        `json:"copy_id"`
+	Barcode      string     `json:"barcode"`
+	Title        string     `json:"title"`
+	FromBranchID int        `json:"from_branch_id"`
+	FromBranch   string     `json:"from_branch"`
+	ToBranchID   int        `json:"to_branch_id"`
+	ToBranch     string     `json:"to_branch"`
+	Kind         string     `json:"kind"`
+	Status       string     `json:"status"`
+	Reason       *string    `json:"reason"`
+	SentBy       *int       `json:"sent_by"`
+	SentAt       time.Time  `json:"sent_at"`
+	ReceivedBy   *int       `json:"received_by"`
+	ReceivedAt   *time.Time `json:"received_at"`
+}
+
+// ListTransfers returns the transfers leaving or arriving at a branch, by
+// default the staff member's own, newest first. status defaults to
+// in_transit; "all" includes finished ones.
+func (l *LibraryAgentService) ListTransfers(actor Actor, branchID *int, status string) ([]CopyTransfer, error) {
+	branch, err := resolveBranch(l.db, actor, branchID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := transferQuery(l.db).Order("t.sent_at DESC, t.transfer_id DESC")
+	switch status {
+	case "":
+		query = query.Where("t.status = ?", TransferInTransit)
+	case TransferInTransit, TransferReceived, TransferCancelled:
+		query = query.Where("t.status = ?", status)
+	case "all":
+	default:
+		return nil, fmt.Errorf("%w: status must be in_transit, received, cancelled or all", ErrInvalidTransfer)
+	}
+	if branch != 0 {
+		query = query.Where("t.from_branch_id = ? OR t.to_branch_id = ?", branch, branch)
+	}
+
+	transfers := []CopyTransfer{}
+	if err := query.Scan(&transfers).Error; err != nil {
+		return nil, fmt.Errorf("failed to list transfers: %w", err)
+	}
+	return transfers, nil
+}
+
+// SendTransfer moves available copies to another branch. They stay in
+// transit, and out of the catalog counts, until that branch receives them.
+// Staff can only send their own branch's copies.
+func (l *LibraryAgentService) SendTransfer(actor Actor, copyIDs []int, toBranchID int, reason string) ([]CopyTransfer, error) {
+	if len(copyIDs) == 0 {
+		return nil, fmt.Errorf("%w: no copies given", ErrInvalidTransfer)
+	}
+	if len(copyIDs) > transferMax {
+		return nil, fmt.Errorf("%w: at most %d copies per transfer", ErrInvalidTransfer, transferMax)
+	}
+	reason = strings.TrimSpace(reason)
+
+	tx := l.db.Begin()
+
+	toBranch, err := lookupBranch(tx, toBranchID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	staffBranch, err := resolveBranch(tx, actor, nil)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var transferIDs []int
+	seen := make(map[int]bool, len(copyIDs))
+	for _, copyID := range copyIDs {
+		if seen[copyID] {
+			continue
+		}
+		seen[copyID] = true
+
+		bookCopy, err := lockCopy(tx, copyID)
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("copy_id %d: %w", copyID, err)
+		}
+		if staffBranch != 0 && bookCopy.BranchID != staffBranch {
+			tx.Rollback()
+			return nil, fmt.Errorf("copy_id %d: %w", copyID, ErrCopyElsewhere)
+		}
+		if bookCopy.BranchID == toBranchID {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: copy_id %d already belongs to %s", ErrInvalidTransfer, copyID, toBranch.Name)
+		}
+		if bookCopy.Status != CopyAvailable {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: copy_id %d is %s", ErrInvalidCopyTransition, copyID, bookCopy.Status)
+		}
+
+		transferID, err := startTransfer(tx, actor, bookCopy, bookCopy.BranchID, toBranchID, TransferStock, reason)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		transferIDs = append(transferIDs, transferID)
+	}
+
+	details := fmt.Sprintf("%d copies to branch_id %d (%s)", len(transferIDs), toBranchID, toBranch.Name)
+	if err := recordAudit(tx, actor, 0, "send_transfer", details); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	transfers := []CopyTransfer{}
+	if err := transferQuery(tx).Where("t.transfer_id IN ?", transferIDs).Order("t.transfer_id").Scan(&transfers).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to fetch transfers: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return transfers, nil
+}
+
+// ReceiveTransfer books a copy in at the branch it was sent to and makes it
+// available there. A transferred copy has to be shelved at a location of
+// that branch; a returned copy goes back to its old location unless
+// another is given.
+func (l *LibraryAgentService) ReceiveTransfer(actor Actor, transferID int, locationID *int) (*CopyTransfer, error) {
+	tx := l.db.Begin()
+
+	var transfer CopyTransfer
+	err := tx.Raw(`
+		SELECT transfer_id, copy_id, from_branch_id, to_branch_id, kind, status
+		FROM copy_transfer
+		WHERE transfer_id = ?
+		FOR UPDATE
+	`, transferID).Scan(&transfer).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to fetch transfer: %w", err)
+	}
+	if transfer.TransferID == 0 {
+		tx.Rollback()
+		return nil, ErrTransferNotFound
+	}
+	if transfer.Status != TransferInTransit {
+		tx.Rollback()
+		return nil, ErrTransferNotOpen
+	}
+
+	staffBranch, err := resolveBranch(tx, actor, nil)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if staffBranch != 0 && staffBranch != transfer.ToBranchID {
+		tx.Rollback()
+		return nil, ErrWrongBranch
+	}
+
+	bookCopy, err := lockCopy(tx, transfer.CopyID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if locationID == nil && transfer.Kind == TransferStock {
+		tx.Rollback()
+		return nil, fmt.Errorf("%w: location_id is required to shelve a transferred copy", ErrInvalidTransfer)
+	}
+	reason := fmt.Sprintf("received from transfer %d", transferID)
+	if locationID != nil {
+		location, err := lookupLocation(tx, *locationID)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if location.BranchID != transfer.ToBranchID {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: location_id %d belongs to another branch", ErrInvalidLocation, *locationID)
+		}
+	}
+	if locationID != nil && (bookCopy.LocationID == nil || *bookCopy.LocationID != *locationID) {
+		if err := tx.Table("book_copy").Where("copy_id = ?", bookCopy.CopyID).Update("location_id", *locationID).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to shelve copy: %w", err)
+		}
+		if err := recordCopyLocation(tx, actor, bookCopy.CopyID, bookCopy.LocationID, *locationID, reason); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Table("book_copy").Where("copy_id = ?", bookCopy.CopyID).Update("branch_id", transfer.ToBranchID).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update copy branch: %w", err)
+	}
+	if err := setCopyStatus(tx, actor, bookCopy, CopyAvailable, reason); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	update := map[string]interface{}{
+		"status":      TransferReceived,
+		"received_at": time.Now(),
+	}
+	if actor.UserID != 0 {
+		update["received_by"] = actor.UserID
+	}
+	if actor.APIKeyID != 0 {
+		update["received_api_key_id"] = actor.APIKeyID
+	}
+	if err := tx.Table("copy_transfer").Where("transfer_id = ?", transferID).Updates(update).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to receive transfer: %w", err)
+	}
+
+	details := fmt.Sprintf("transfer %d: copy_id %d (%s) at branch_id %d", transferID, bookCopy.CopyID, bookCopy.Barcode, transfer.ToBranchID)
+	if err := recordAudit(tx, actor, 0, "receive_transfer", details); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := transferQuery(tx).Where("t.transfer_id = ?", transferID).Scan(&transfer).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to fetch transfer: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &transfer, nil
+}
+
+// startTransfer puts a locked copy in transit and records where it goes.
+func startTransfer(tx *gorm.DB, actor Actor, bookCopy *BookCopy, fromBranchID, toBranchID int, kind, reason string) (int, error) {
+	statusReason := reason
+	if statusReason == "" {
+		statusReason = fmt.Sprintf("%s to branch_id %d", kind, toBranchID)
+	}
+	if err := setCopyStatus(tx, actor, bookCopy, CopyInTransit, statusReason); err != nil {
+		return 0, err
+	}
+
+	var sentBy, sentAPIKeyID *int
+	if actor.UserID != 0 {
+		sentBy = &actor.UserID
+	}
+	if actor.APIKeyID != 0 {
+		sentAPIKeyID = &actor.APIKeyID
+	}
+	var transferID int
+	err := tx.Raw(`
+		INSERT INTO copy_transfer (copy_id, from_branch_id, to_branch_id, kind, reason, sent_by, sent_api_key_id)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), ?, ?)
+		RETURNING transfer_id
+	`, bookCopy.CopyID, fromBranchID, toBranchID, kind, reason, sentBy, sentAPIKeyID).Scan(&transferID).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to record transfer: %w", err)
+	}
+	return transferID, nil
+}
+
+// cancelOpenTransfer ends the transfer of a copy that will not arrive.
+func cancelOpenTransfer(tx *gorm.DB, copyID int) error {
+	err := tx.Table("copy_transfer").
+		Where("copy_id = ? AND status = ?", copyID, TransferInTransit).
+		Update("status", TransferCancelled).Error
+	if err != nil {
+		return fmt.Errorf("failed to cancel transfer: %w", err)
+	}
+	return nil
+}
+
+func transferQuery(db *gorm.DB) *gorm.DB {
+	return db.Table("copy_transfer t").
+		Select(transferColumns).
+		Joins("JOIN book_copy bc ON bc.copy_id = t.copy_id").
+		Joins("JOIN book b ON b.book_code = bc.book_code").
+		Joins("JOIN branch fb ON fb.branch_id = t.from_branch_id").
+		Joins("JOIN branch tb ON tb.branch_id = t.to_branch_id")
+}
@@ -0,0 +1,513 @@
+package subservices
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"db_project2/pkg/totp"
+
+	"gorm.io/gorm"
+)
+
+type TwoFactorConfig struct {
+	Issuer            string
+	RequireForAdmin   bool
+	ChallengeTTL      time.Duration
+	MaxAttempts       int
+	Skew              int
+	RecoveryCodeCount int
+}
+
+var (
+	ErrTwoFactorStaffOnly      = errors.New("two-factor authentication is only available for staff accounts")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled    = errors.New("two-factor authentication is not set up")
+	ErrTwoFactorRequired       = errors.New("two-factor authentication is mandatory for this role")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrInvalidChallenge        = errors.New("invalid or expired login challenge")
+)
+
+// recoveryCodeAlphabet leaves out characters that are easily confused
+// when a code is copied from paper.
+const recoveryCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+type TwoFactorEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TwoFactorStatus struct {
+	Enabled               bool `json:"enabled"`
+	Required              bool `json:"required"`
+	RemainingRecoveryCode int  `json:"remaining_recovery_codes"`
+}
+
+// TwoFactorService handles TOTP enrolment for staff accounts and the second
+// step of a login. A login challenge is only valid for a short time and a
+// limited number of wrong codes, on top of the per-username login throttle.
+type TwoFactorService struct {
+	db     *gorm.DB
+	config TwoFactorConfig
+}
+
+func NewTwoFactorServiceInstance(db *gorm.DB, config TwoFactorConfig) *TwoFactorService {
+	return &TwoFactorService{db: db, config: config}
+}
+
+type totpState struct {
+	UserID          int
+	Username        string
+	UserRole        string
+	TOTPSecret      *string `gorm:"column:totp_secret"`
+	TOTPEnabled     bool    `gorm:"column:totp_enabled"`
+	TOTPLastCounter int64   `gorm:"column:totp_last_counter"`
+}
+
+// SetupRequired reports whether an account must enrol before it may use
+// anything other than the enrolment endpoints.
+func (t *TwoFactorService) SetupRequired(role string, enabled bool) bool {
+	return t.config.RequireForAdmin && role == "Admin" && !enabled
+}
+
+func (t *TwoFactorService) GetStatus(actor Actor) (*TwoFactorStatus, error) {
+	state, err := t.loadState(t.db, actor.UserID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var remaining int64
+	err = t.db.Table("recovery_code").Where("user_id = ? AND used_at IS NULL", actor.UserID).Count(&remaining).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+
+	return &TwoFactorStatus{
+		Enabled:               state.TOTPEnabled,
+		Required:              t.config.RequireForAdmin && state.UserRole == "Admin",
+		RemainingRecoveryCode: int(remaining),
+	}, nil
+}
+
+// BeginEnrollment stores a fresh secret that stays inactive until
+// ConfirmEnrollment sees a valid code generated from it.
+func (t *TwoFactorService) BeginEnrollment(actor Actor) (*TwoFactorEnrollment, error) {
+	state, err := t.loadState(t.db, actor.UserID, false)
+	if err != nil {
+		return nil, err
+	}
+	if !isStaffRole(state.UserRole) {
+		return nil, ErrTwoFactorStaffOnly
+	}
+	if state.TOTPEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+
+	err = t.db.Table("User").Where("user_id = ?", actor.UserID).Update("totp_secret", secret).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to store totp secret: %w", err)
+	}
+
+	return &TwoFactorEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(t.config.Issuer, state.Username, secret),
+	}, nil
+}
+
+// ConfirmEnrollment enables two-factor authentication and returns the
+// recovery codes. They are shown exactly once; only their hashes are kept.
+func (t *TwoFactorService) ConfirmEnrollment(actor Actor, code string) ([]string, error) {
+	tx := t.db.Begin()
+
+	state, err := t.loadState(tx, actor.UserID, true)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if state.TOTPEnabled {
+		tx.Rollback()
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if state.TOTPSecret == nil {
+		tx.Rollback()
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	counter, ok := totp.Validate(*state.TOTPSecret, code, time.Now(), t.config.Skew)
+	if !ok {
+		tx.Rollback()
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	err = tx.Table("User").Where("user_id = ?", actor.UserID).Updates(map[string]interface{}{
+		"totp_enabled":      true,
+		"totp_last_counter": counter,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+
+	codes, err := t.replaceRecoveryCodes(tx, actor.UserID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := recordAudit(tx, actor, 0, "enable_two_factor", fmt.Sprintf("user_id %d", actor.UserID)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off after checking a current
+// code or recovery code. Admins cannot opt out while it is mandatory.
+func (t *TwoFactorService) Disable(actor Actor, code string) error {
+	tx := t.db.Begin()
+
+	state, err := t.loadState(tx, actor.UserID, true)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !state.TOTPEnabled {
+		tx.Rollback()
+		return ErrTwoFactorNotEnrolled
+	}
+	if t.config.RequireForAdmin && state.UserRole == "Admin" {
+		tx.Rollback()
+		return ErrTwoFactorRequired
+	}
+
+	ok, err := t.verifyCode(tx, state, code)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !ok {
+		tx.Rollback()
+		return ErrInvalidTwoFactorCode
+	}
+
+	if err := t.clearTwoFactor(tx, actor.UserID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := recordAudit(tx, actor, 0, "disable_two_factor", fmt.Sprintf("user_id %d", actor.UserID)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// RegenerateRecoveryCodes invalidates every unused recovery code and
+// issues a new set.
+func (t *TwoFactorService) RegenerateRecoveryCodes(actor Actor, code string) ([]string, error) {
+	tx := t.db.Begin()
+
+	state, err := t.loadState(tx, actor.UserID, true)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if !state.TOTPEnabled {
+		tx.Rollback()
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	ok, err := t.verifyCode(tx, state, code)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if !ok {
+		tx.Rollback()
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, err := t.replaceRecoveryCodes(tx, actor.UserID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := recordAudit(tx, actor, 0, "regenerate_recovery_codes", fmt.Sprintf("user_id %d", actor.UserID)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return codes, nil
+}
+
+// ResetForUser lets an admin clear the second factor of a staff member who
+// lost both their device and recovery codes. They enrol again afterwards.
+func (t *TwoFactorService) ResetForUser(actor Actor, userID int) error {
+	tx := t.db.Begin()
+
+	state, err := t.loadState(tx, userID, true)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !isStaffRole(state.UserRole) {
+		tx.Rollback()
+		return ErrStaffNotFound
+	}
+
+	if err := t.clearTwoFactor(tx, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := recordAudit(tx, actor, 0, "reset_two_factor", fmt.Sprintf("user_id %d", userID)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// CreateChallenge is issued after a correct password for an account with
+// two-factor authentication. The returned token is exchanged, together with
+// a code, for a session in CompleteChallenge.
+func (t *TwoFactorService) CreateChallenge(userID int, ipAddress string) (string, error) {
+	token, err := generateToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate login challenge: %w", err)
+	}
+
+	err = t.db.Table("two_factor_challenge").Create(map[string]interface{}{
+		"token_hash": hashSessionToken(token),
+		"user_id":    userID,
+		"ip_address": ipAddress,
+		"expires_at": time.Now().Add(t.config.ChallengeTTL),
+	}).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to store login challenge: %w", err)
+	}
+
+	err = t.db.Exec("DELETE FROM two_factor_challenge WHERE expires_at < NOW()").Error
+	if err != nil {
+		return "", fmt.Errorf("failed to purge expired login challenges: %w", err)
+	}
+
+	return token, nil
+}
+
+// PendingChallenge returns the account a challenge belongs to without
+// consuming it, so the caller can apply the login throttle first.
+func (t *TwoFactorService) PendingChallenge(token string) (*User, error) {
+	var user User
+	err := t.db.Table(`"User" u`).
+		Select("u.*").
+		Joins("JOIN two_factor_challenge c ON c.user_id = u.user_id").
+		Where("c.token_hash = ? AND c.used_at IS NULL AND c.expires_at > NOW() AND c.failed_attempts < ?",
+			hashSessionToken(token), t.config.MaxAttempts).
+		Scan(&user).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up login challenge: %w", err)
+	}
+	if user.UserID == 0 {
+		return nil, ErrInvalidChallenge
+	}
+	return &user, nil
+}
+
+// CompleteChallenge checks code against the challenge owner's TOTP secret
+// or unused recovery codes. Wrong codes count towards the challenge limit.
+func (t *TwoFactorService) CompleteChallenge(token, code string) (*User, error) {
+	tx := t.db.Begin()
+
+	var challenge struct {
+		ChallengeID int
+		UserID      int
+	}
+	err := tx.Raw(`
+		SELECT challenge_id, user_id
+		FROM two_factor_challenge
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > NOW() AND failed_attempts < ?
+		FOR UPDATE
+	`, hashSessionToken(token), t.config.MaxAttempts).Scan(&challenge).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to look up login challenge: %w", err)
+	}
+	if challenge.ChallengeID == 0 {
+		tx.Rollback()
+		return nil, ErrInvalidChallenge
+	}
+
+	state, err := t.loadState(tx, challenge.UserID, true)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	ok, err := t.verifyCode(tx, state, code)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if !ok {
+		err = tx.Exec("UPDATE two_factor_challenge SET failed_attempts = failed_attempts + 1 WHERE challenge_id = ?", challenge.ChallengeID).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to record failed attempt: %w", err)
+		}
+		if err := tx.Commit().Error; err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	err = tx.Table("two_factor_challenge").Where("challenge_id = ?", challenge.ChallengeID).Update("used_at", time.Now()).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to consume login challenge: %w", err)
+	}
+
+	var user User
+	err = tx.Table("User").Where("user_id = ?", challenge.UserID).First(&user).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if !user.IsActive {
+		tx.Rollback()
+		return nil, ErrAccountDisabled
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &user, nil
+}
+
+func (t *TwoFactorService) loadState(db *gorm.DB, userID int, lock bool) (*totpState, error) {
+	query := `
+		SELECT user_id, username, user_role, totp_secret, totp_enabled, totp_last_counter
+		FROM "User"
+		WHERE user_id = ?`
+	if lock {
+		query += " FOR UPDATE"
+	}
+
+	var state totpState
+	if err := db.Raw(query, userID).Scan(&state).Error; err != nil {
+		return nil, fmt.Errorf("failed to load two-factor settings: %w", err)
+	}
+	if state.UserID == 0 {
+		return nil, ErrStaffNotFound
+	}
+	return &state, nil
+}
+
+// verifyCode accepts a TOTP code newer than the last one used, or an unused
+// recovery code, which is consumed. Must run inside a transaction holding
+// the user row lock.
+func (t *TwoFactorService) verifyCode(tx *gorm.DB, state *totpState, code string) (bool, error) {
+	if !state.TOTPEnabled || state.TOTPSecret == nil {
+		return false, nil
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		counter, ok := totp.Validate(*state.TOTPSecret, code, time.Now(), t.config.Skew)
+		if !ok || counter <= state.TOTPLastCounter {
+			return false, nil
+		}
+		err := tx.Table("User").Where("user_id = ?", state.UserID).Update("totp_last_counter", counter).Error
+		if err != nil {
+			return false, fmt.Errorf("failed to store totp counter: %w", err)
+		}
+		return true, nil
+	}
+
+	result := tx.Table("recovery_code").
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", state.UserID, hashSessionToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (t *TwoFactorService) replaceRecoveryCodes(tx *gorm.DB, userID int) ([]string, error) {
+	err := tx.Exec("DELETE FROM recovery_code WHERE user_id = ?", userID).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete old recovery codes: %w", err)
+	}
+
+	codes := make([]string, 0, t.config.RecoveryCodeCount)
+	for i := 0; i < t.config.RecoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+
+		err = tx.Table("recovery_code").Create(map[string]interface{}{
+			"user_id":   userID,
+			"code_hash": hashSessionToken(normalizeRecoveryCode(code)),
+		}).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to store recovery code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+func (t *TwoFactorService) clearTwoFactor(tx *gorm.DB, userID int) error {
+	err := tx.Table("User").Where("user_id = ?", userID).Updates(map[string]interface{}{
+		"totp_secret":       nil,
+		"totp_enabled":      false,
+		"totp_last_counter": 0,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+
+	err = tx.Exec("DELETE FROM recovery_code WHERE user_id = ?", userID).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	return nil
+}
+
+// generateRecoveryCode returns a code like "K7QX2-M9TPA" (50 bits).
+func generateRecoveryCode() (string, error) {
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, 0, 11)
+	for i, b := range raw {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		code = append(code, recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+	}
+	return string(code), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -3,10 +3,14 @@ package main
 import (
 	server "db_project2/server"
 	"log"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import-marc" {
+		os.Exit(server.ImportMARC(os.Args[2:]))
+	}
+
 	log.Println("Starting server...")
 	server.Start()
 }
-
@@ -0,0 +1,63 @@
+// Package cardnumber builds and checks the numbers printed on library cards:
+// 14 digits, a leading 2 (the usual prefix for patron barcodes), the card ID
+// padded to 12 digits and a Luhn check digit. Digits only, so the number
+// prints as Codabar or Code128 alike.
+package cardnumber
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	Prefix = "2"
+	Length = 14
+)
+
+// Format returns the card number for cardID. It must agree with the
+// library_card_number SQL function that fills LibraryCard.card_number.
+func Format(cardID int) string {
+	payload := fmt.Sprintf("%s%012d", Prefix, cardID)
+	return payload + string(rune('0'+checkDigit(payload)))
+}
+
+// Normalize strips the spaces and dashes people type and the Codabar
+// start/stop characters (A-D) some scanners send along.
+func Normalize(number string) string {
+	number = strings.ToUpper(strings.TrimSpace(number))
+	if len(number) >= 2 && strings.ContainsRune("ABCD", rune(number[0])) && strings.ContainsRune("ABCD", rune(number[len(number)-1])) {
+		number = number[1 : len(number)-1]
+	}
+	return strings.NewReplacer(" ", "", "-", "").Replace(number)
+}
+
+// Valid reports whether a normalized number has the right shape and check
+// digit.
+func Valid(number string) bool {
+	if len(number) != Length || !strings.HasPrefix(number, Prefix) {
+		return false
+	}
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return int(number[Length-1]-'0') == checkDigit(number[:Length-1])
+}
+
+// checkDigit is the Luhn digit for payload: every second digit from the
+// right is doubled.
+func checkDigit(payload string) int {
+	sum := 0
+	for i := 0; i < len(payload); i++ {
+		digit := int(payload[len(payload)-1-i] - '0')
+		if i%2 == 0 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return (10 - sum%10) % 10
+}
@@ -0,0 +1,58 @@
+package cardnumber
+
+import "testing"
+
+// The expected numbers are those library_card_number (migration 15) returns
+// for the same card IDs.
+func TestFormatMatchesSQLFunction(t *testing.T) {
+	tests := []struct {
+		cardID int
+		want   string
+	}{
+		{1, "20000000000014"},
+		{2, "20000000000022"},
+		{42, "20000000000428"},
+		{1234, "20000000012340"},
+		{999999999999, "29999999999998"},
+	}
+
+	for _, tt := range tests {
+		got := Format(tt.cardID)
+		if got != tt.want {
+			t.Errorf("Format(%d) = %s, want %s", tt.cardID, got, tt.want)
+		}
+		if !Valid(got) {
+			t.Errorf("Valid(Format(%d)) = false", tt.cardID)
+		}
+	}
+}
+
+func TestValidRejectsMalformedNumbers(t *testing.T) {
+	for _, number := range []string{
+		"",
+		"20000000000015",  // wrong check digit
+		"10000000000014",  // wrong prefix
+		"2000000000014",   // too short
+		"200000000000140", // too long
+		"2000000000001A",
+	} {
+		if Valid(number) {
+			t.Errorf("Valid(%q) = true", number)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"20000000000014":      "20000000000014",
+		" 2000-0000-0000-14 ": "20000000000014",
+		"A20000000000014B":    "20000000000014",
+		"d2000 0000 0000 14a": "20000000000014",
+	}
+
+	for input, want := range tests {
+		if got := Normalize(input); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
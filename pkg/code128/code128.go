@@ -0,0 +1,83 @@
+// Package code128 encodes text as a Code 128 barcode. Printable ASCII uses
+// code set B; strings of an even number of digits use the denser code set C.
+package code128
+
+import (
+	"errors"
+	"strings"
+)
+
+// QuietZone is the blank margin, in modules, required on each side.
+const QuietZone = 10
+
+const (
+	startB = 104
+	startC = 105
+)
+
+var ErrUnsupported = errors.New("code128: only printable ASCII can be encoded")
+
+// patterns holds the bar and space widths of every symbol value; each
+// symbol is 11 modules wide.
+var patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232",
+}
+
+const stopPattern = "2331112"
+
+// Encode returns the barcode as modules, true for a bar, without the quiet
+// zones.
+func Encode(text string) ([]bool, error) {
+	if text == "" {
+		return nil, ErrUnsupported
+	}
+	for _, r := range text {
+		if r < 32 || r > 126 {
+			return nil, ErrUnsupported
+		}
+	}
+
+	var values []int
+	if len(text) >= 4 && len(text)%2 == 0 && strings.Trim(text, "0123456789") == "" {
+		values = append(values, startC)
+		for i := 0; i < len(text); i += 2 {
+			values = append(values, int(text[i]-'0')*10+int(text[i+1]-'0'))
+		}
+	} else {
+		values = append(values, startB)
+		for i := 0; i < len(text); i++ {
+			values = append(values, int(text[i])-32)
+		}
+	}
+
+	checksum := values[0]
+	for i, value := range values[1:] {
+		checksum += (i + 1) * value
+	}
+	values = append(values, checksum%103)
+
+	var modules []bool
+	for _, value := range values {
+		modules = appendPattern(modules, patterns[value])
+	}
+	return appendPattern(modules, stopPattern), nil
+}
+
+func appendPattern(modules []bool, pattern string) []bool {
+	for i, width := range pattern {
+		for n := 0; n < int(width-'0'); n++ {
+			modules = append(modules, i%2 == 0)
+		}
+	}
+	return modules
+}
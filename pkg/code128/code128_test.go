@@ -0,0 +1,120 @@
+package code128
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decode turns modules back into symbol values: each symbol is three bars
+// and three spaces, and the last seven widths are the stop pattern.
+func decode(t *testing.T, modules []bool) []int {
+	t.Helper()
+
+	var widths strings.Builder
+	run := 1
+	for i := 1; i <= len(modules); i++ {
+		if i < len(modules) && modules[i] == modules[i-1] {
+			run++
+			continue
+		}
+		widths.WriteByte(byte('0' + run))
+		run = 1
+	}
+
+	runs := widths.String()
+	if !modules[0] || !strings.HasSuffix(runs, stopPattern) || (len(runs)-len(stopPattern))%6 != 0 {
+		t.Fatalf("modules do not end in a stop pattern: %s", runs)
+	}
+
+	var values []int
+	for i := 0; i < len(runs)-len(stopPattern); i += 6 {
+		value := -1
+		for v, pattern := range patterns {
+			if pattern == runs[i:i+6] {
+				value = v
+				break
+			}
+		}
+		if value < 0 {
+			t.Fatalf("unknown symbol %s", runs[i:i+6])
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// The expected values are start symbol, data and the mod-103 checksum,
+// computed by hand from the Code 128 tables.
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		text string
+		want []int
+	}{
+		// Set C: digit pairs. 105 + 1*12 + 2*34 + 3*56 + 4*78 = 665 = 6*103 + 47.
+		{"12345678", []int{startC, 12, 34, 56, 78, 47}},
+		// Leading zeros stay as pairs: 105 + 2*1 + 3*23 + 4*45 = 356 = 3*103 + 47.
+		{"00012345", []int{startC, 0, 1, 23, 45, 47}},
+		// Set B: character - 32. 104 + 1*33 + 2*34 + 3*35 = 310 = 3*103 + 1.
+		{"ABC", []int{startB, 33, 34, 35, 1}},
+		{"Wikipedia", []int{startB, 55, 73, 75, 73, 80, 69, 68, 73, 65, 88}},
+		// Digits that cannot all be paired, or too few to save space, use set B.
+		// 104 + 1*17 + 2*18 + 3*19 = 214 = 2*103 + 8.
+		{"123", []int{startB, 17, 18, 19, 8}},
+		// 104 + 1*17 + 2*18 = 157 = 103 + 54.
+		{"12", []int{startB, 17, 18, 54}},
+		// 104 + 1*17 + 2*18 + 3*33 + 4*20 = 336 = 3*103 + 27.
+		{"12A4", []int{startB, 17, 18, 33, 20, 27}},
+	}
+
+	for _, tt := range tests {
+		modules, err := Encode(tt.text)
+		if err != nil {
+			t.Errorf("Encode(%q) returned %v", tt.text, err)
+			continue
+		}
+		if want := 11*len(tt.want) + 13; len(modules) != want {
+			t.Errorf("Encode(%q) is %d modules wide, want %d", tt.text, len(modules), want)
+		}
+		if got := decode(t, modules); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+// Start and stop symbols as printed in the Code 128 specification, with 1
+// for a bar module and 0 for a space.
+func TestEncodeStartAndStopModules(t *testing.T) {
+	modules, err := Encode("ABC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bits := func(modules []bool) string {
+		var b strings.Builder
+		for _, bar := range modules {
+			if bar {
+				b.WriteByte('1')
+			} else {
+				b.WriteByte('0')
+			}
+		}
+		return b.String()
+	}
+
+	if got := bits(modules[:11]); got != "11010010000" {
+		t.Errorf("start B = %s, want 11010010000", got)
+	}
+	if got := bits(modules[len(modules)-13:]); got != "1100011101011" {
+		t.Errorf("stop = %s, want 1100011101011", got)
+	}
+}
+
+func TestEncodeRejectsUnsupportedText(t *testing.T) {
+	for _, text := range []string{"", "tab\there", "café", "line\n"} {
+		if _, err := Encode(text); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Encode(%q) error = %v, want ErrUnsupported", text, err)
+		}
+	}
+}
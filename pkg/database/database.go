@@ -4,7 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
-	//"path/filepath"
+	"path/filepath"
+	"sort"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -87,3 +88,56 @@ func ExecuteSchemaFile(db *gorm.DB, filePath string) error {
 	log.Println("Schema file executed successfully.")
 	return nil
 }
+
+// bootstrapMigrations are executed by the postgres container entrypoint when
+// the volume is first created and must not be replayed by the application.
+var bootstrapMigrations = map[string]bool{
+	"01-init-db.sql":       true,
+	"02-create-tables.sql": true,
+}
+
+func RunMigrations(db *gorm.DB, dir string) error {
+	err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migration (
+			filename VARCHAR(255) PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`).Error
+	if err != nil {
+		return fmt.Errorf("error creating schema_migration table: %w", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return fmt.Errorf("error listing migration files: %w", err)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		name := filepath.Base(file)
+		if bootstrapMigrations[name] {
+			continue
+		}
+
+		var applied bool
+		err := db.Table("schema_migration").Select("COUNT(*) > 0").Where("filename = ?", name).Find(&applied).Error
+		if err != nil {
+			return fmt.Errorf("error checking migration %s: %w", name, err)
+		}
+		if applied {
+			continue
+		}
+
+		if err := ExecuteSchemaFile(db, file); err != nil {
+			return fmt.Errorf("migration %s failed: %w", name, err)
+		}
+
+		err = db.Table("schema_migration").Create(map[string]interface{}{"filename": name}).Error
+		if err != nil {
+			return fmt.Errorf("error recording migration %s: %w", name, err)
+		}
+		log.Printf("Applied migration %s", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS Session (
+    session_id SERIAL PRIMARY KEY,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    user_id INT NOT NULL,
+    user_role VARCHAR(20) NOT NULL,
+    ip_address VARCHAR(45),
+    user_agent VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES "User"(user_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_session_user_id ON Session(user_id);
+CREATE INDEX IF NOT EXISTS idx_session_expires_at ON Session(expires_at);
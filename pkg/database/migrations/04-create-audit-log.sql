@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS Audit_Log (
+    audit_id SERIAL PRIMARY KEY,
+    actor_user_id INT,
+    target_student_id INT,
+    action VARCHAR(50) NOT NULL,
+    details TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (actor_user_id) REFERENCES "User"(user_id) ON DELETE SET NULL,
+    FOREIGN KEY (target_student_id) REFERENCES Student(student_id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target_student_id ON Audit_Log(target_student_id);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS Refresh_Token (
+    token_id SERIAL PRIMARY KEY,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    family_id VARCHAR(32) NOT NULL,
+    user_id INT NOT NULL,
+    ip_address VARCHAR(45),
+    user_agent VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ DEFAULT NULL,
+    revoked_at TIMESTAMPTZ DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES "User"(user_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_token_family_id ON Refresh_Token(family_id);
+CREATE TABLE IF NOT EXISTS Revoked_Access_Token (
+    jti VARCHAR(32) PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS Login_Attempt (
+    attempt_id SERIAL PRIMARY KEY,
+    username VARCHAR(50) NOT NULL,
+    ip_address VARCHAR(45),
+    succeeded BOOLEAN NOT NULL,
+    reason VARCHAR(100),
+    attempted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_login_attempt_username ON Login_Attempt(username);
+CREATE TABLE IF NOT EXISTS Login_Throttle (
+    scope VARCHAR(10) NOT NULL CHECK (scope IN ('user', 'ip')),
+    key VARCHAR(255) NOT NULL,
+    failure_count INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    blocked_until TIMESTAMPTZ,
+    locked_until TIMESTAMPTZ,
+    PRIMARY KEY (scope, key)
+);
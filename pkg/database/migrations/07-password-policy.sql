@@ -0,0 +1,14 @@
+ALTER TABLE "User"
+ADD COLUMN IF NOT EXISTS must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+-- Accounts still on the old shared default must pick their own password.
+UPDATE "User"
+SET must_change_password = TRUE
+WHERE password = 'default_password';
+CREATE TABLE IF NOT EXISTS Password_History (
+    history_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    password_hash VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES "User"(user_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON Password_History(user_id);
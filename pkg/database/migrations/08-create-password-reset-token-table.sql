@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS Password_Reset_Token (
+    token_id SERIAL PRIMARY KEY,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    user_id INT NOT NULL,
+    requested_ip VARCHAR(45),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES "User"(user_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_password_reset_token_user_id ON Password_Reset_Token(user_id);
@@ -0,0 +1,6 @@
+ALTER TABLE "User"
+ADD COLUMN IF NOT EXISTS is_active BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE "User"
+ADD COLUMN IF NOT EXISTS email VARCHAR(100) UNIQUE;
+ALTER TABLE "User"
+ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
@@ -0,0 +1,29 @@
+ALTER TABLE "User"
+ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64) DEFAULT NULL;
+ALTER TABLE "User"
+ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE "User"
+ADD COLUMN IF NOT EXISTS totp_last_counter BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS Recovery_Code (
+    code_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMPTZ DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES "User"(user_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_code_user_id ON Recovery_Code(user_id);
+
+CREATE TABLE IF NOT EXISTS Two_Factor_Challenge (
+    challenge_id SERIAL PRIMARY KEY,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    user_id INT NOT NULL,
+    ip_address VARCHAR(45),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    failed_attempts INT NOT NULL DEFAULT 0,
+    used_at TIMESTAMPTZ DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES "User"(user_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_two_factor_challenge_user_id ON Two_Factor_Challenge(user_id);
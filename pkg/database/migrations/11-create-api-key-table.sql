@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS Api_Key (
+    key_id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    key_prefix VARCHAR(16) NOT NULL,
+    scopes TEXT NOT NULL,
+    allowed_ips TEXT NOT NULL DEFAULT '',
+    created_by INT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    rotated_at TIMESTAMPTZ DEFAULT NULL,
+    expires_at TIMESTAMPTZ DEFAULT NULL,
+    last_used_at TIMESTAMPTZ DEFAULT NULL,
+    last_used_ip VARCHAR(45),
+    revoked_at TIMESTAMPTZ DEFAULT NULL,
+    FOREIGN KEY (created_by) REFERENCES "User"(user_id) ON DELETE SET NULL
+);
+
+ALTER TABLE Audit_Log
+ADD COLUMN IF NOT EXISTS api_key_id INT REFERENCES Api_Key(key_id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_audit_log_api_key_id ON Audit_Log(api_key_id);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS Oidc_Login_State (
+    state_hash CHAR(64) PRIMARY KEY,
+    code_verifier VARCHAR(128) NOT NULL,
+    nonce VARCHAR(128) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS Oidc_Identity (
+    identity_id SERIAL PRIMARY KEY,
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id INT NOT NULL,
+    email VARCHAR(100),
+    linked_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMPTZ,
+    UNIQUE (issuer, subject),
+    FOREIGN KEY (user_id) REFERENCES "User"(user_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_oidc_identity_user_id ON Oidc_Identity(user_id);
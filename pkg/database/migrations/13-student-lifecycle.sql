@@ -0,0 +1,16 @@
+ALTER TABLE Student
+ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (
+    status IN ('active', 'inactive', 'archived')
+);
+ALTER TABLE Student
+ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMPTZ DEFAULT NULL;
+
+-- Loans outlive the student so circulation statistics stay complete. A
+-- deleted student's loans keep their dates and copy with student_id NULL.
+ALTER TABLE Loan
+ALTER COLUMN student_id DROP NOT NULL;
+ALTER TABLE Loan
+DROP CONSTRAINT IF EXISTS loan_student_id_fkey;
+ALTER TABLE Loan
+ADD CONSTRAINT loan_student_id_fkey FOREIGN KEY (student_id) REFERENCES Student(student_id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_loan_student_id ON Loan(student_id);
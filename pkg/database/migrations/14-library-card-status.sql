@@ -0,0 +1,54 @@
+-- LibraryCard.status was a boolean flipped by toggle_card_status. It becomes
+-- an explicit state; every change is recorded in Card_Status_History.
+ALTER TABLE LibraryCard
+ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE LibraryCard
+ALTER COLUMN status TYPE VARCHAR(20) USING (
+    CASE
+        WHEN status IS FALSE THEN 'suspended'
+        ELSE 'active'
+    END
+);
+ALTER TABLE LibraryCard
+ALTER COLUMN status SET DEFAULT 'active';
+ALTER TABLE LibraryCard
+ALTER COLUMN status SET NOT NULL;
+ALTER TABLE LibraryCard
+ADD CONSTRAINT librarycard_status_check CHECK (
+    status IN ('active', 'suspended', 'blocked', 'expired')
+);
+ALTER TABLE LibraryCard
+ADD COLUMN IF NOT EXISTS status_reason TEXT;
+ALTER TABLE LibraryCard
+ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMPTZ;
+ALTER TABLE LibraryCard
+ADD COLUMN IF NOT EXISTS expiry_date DATE;
+-- Existing cards get a full year from today rather than from activation, so
+-- cards issued more than a year ago are not expired the moment this runs.
+UPDATE LibraryCard
+SET expiry_date = GREATEST(activation_date, CURRENT_DATE) + INTERVAL '1 year'
+WHERE expiry_date IS NULL;
+ALTER TABLE LibraryCard
+ALTER COLUMN expiry_date SET NOT NULL;
+
+DROP PROCEDURE IF EXISTS toggle_card_status(INT);
+
+CREATE TABLE IF NOT EXISTS Card_Status_History (
+    history_id SERIAL PRIMARY KEY,
+    card_id INT NOT NULL,
+    old_status VARCHAR(20),
+    new_status VARCHAR(20) NOT NULL,
+    expiry_date DATE NOT NULL,
+    reason TEXT NOT NULL,
+    changed_by INT,
+    api_key_id INT,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (card_id) REFERENCES LibraryCard(card_id) ON DELETE CASCADE,
+    FOREIGN KEY (changed_by) REFERENCES "User"(user_id) ON DELETE SET NULL,
+    FOREIGN KEY (api_key_id) REFERENCES Api_Key(key_id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_card_status_history_card_id ON Card_Status_History(card_id);
+
+INSERT INTO Card_Status_History (card_id, old_status, new_status, expiry_date, reason, changed_at)
+SELECT card_id, NULL, status, expiry_date, 'existing card', activation_date
+FROM LibraryCard;
@@ -0,0 +1,49 @@
+-- Printed card numbers: '2', the card_id padded to 12 digits and a Luhn
+-- check digit. Must agree with pkg/cardnumber.
+CREATE OR REPLACE FUNCTION library_card_number(id INT) RETURNS VARCHAR AS $$
+DECLARE payload TEXT := '2' || LPAD(id::TEXT, 12, '0');
+total INT := 0;
+digit INT;
+BEGIN FOR i IN 1..LENGTH(payload) LOOP digit := SUBSTRING(payload FROM LENGTH(payload) - i + 1 FOR 1)::INT;
+IF i % 2 = 1 THEN digit := digit * 2;
+IF digit > 9 THEN digit := digit - 9;
+END IF;
+END IF;
+total := total + digit;
+END LOOP;
+RETURN payload || ((10 - total % 10) % 10)::TEXT;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+ALTER TABLE LibraryCard
+ADD COLUMN IF NOT EXISTS card_number VARCHAR(20) UNIQUE;
+ALTER TABLE LibraryCard
+ADD COLUMN IF NOT EXISTS replaces_card_id INT REFERENCES LibraryCard(card_id) ON DELETE SET NULL;
+UPDATE LibraryCard
+SET card_number = library_card_number(card_id)
+WHERE card_number IS NULL;
+
+CREATE OR REPLACE FUNCTION set_library_card_number() RETURNS TRIGGER AS $$ BEGIN IF NEW.card_number IS NULL THEN NEW.card_number := library_card_number(NEW.card_id);
+END IF;
+RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+DO $$ BEGIN IF NOT EXISTS (
+    SELECT 1
+    FROM pg_trigger
+    WHERE tgname = 'library_card_number_trigger'
+) THEN CREATE TRIGGER library_card_number_trigger BEFORE
+INSERT ON LibraryCard FOR EACH ROW EXECUTE FUNCTION set_library_card_number();
+END IF;
+END $$;
+ALTER TABLE LibraryCard
+ALTER COLUMN card_number SET NOT NULL;
+
+-- A card reported lost keeps its row, so the old number still resolves to
+-- the patron and the replacement that superseded it.
+ALTER TABLE LibraryCard
+DROP CONSTRAINT IF EXISTS librarycard_status_check;
+ALTER TABLE LibraryCard
+ADD CONSTRAINT librarycard_status_check CHECK (
+    status IN ('active', 'suspended', 'blocked', 'expired', 'lost')
+);
@@ -0,0 +1,23 @@
+-- The join tables had no keys, so the same link could be stored twice.
+-- Remove existing duplicates, then let unique indexes keep them out.
+DELETE FROM Book_Author a USING Book_Author b
+WHERE a.ctid > b.ctid
+    AND a.book_code = b.book_code
+    AND a.author_id = b.author_id;
+DELETE FROM Book_Publisher a USING Book_Publisher b
+WHERE a.ctid > b.ctid
+    AND a.book_code = b.book_code
+    AND a.publisher_id = b.publisher_id;
+DELETE FROM Book_Subject a USING Book_Subject b
+WHERE a.ctid > b.ctid
+    AND a.book_code = b.book_code
+    AND a.subject_id = b.subject_id;
+DELETE FROM Book_Language a USING Book_Language b
+WHERE a.ctid > b.ctid
+    AND a.book_code = b.book_code
+    AND LOWER(a.language) = LOWER(b.language);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_book_author_unique ON Book_Author(book_code, author_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_book_publisher_unique ON Book_Publisher(book_code, publisher_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_book_subject_unique ON Book_Subject(book_code, subject_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_book_language_unique ON Book_Language(book_code, LOWER(language));
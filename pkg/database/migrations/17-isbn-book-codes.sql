@@ -0,0 +1,69 @@
+-- book_code becomes the bare ISBN-13 (or a LOC- prefixed local identifier),
+-- so existing codes are rewritten. The referencing keys follow along.
+ALTER TABLE Book_Language DROP CONSTRAINT IF EXISTS book_language_book_code_fkey;
+ALTER TABLE Book_Language
+ADD CONSTRAINT book_language_book_code_fkey FOREIGN KEY (book_code) REFERENCES Book(book_code) ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE Book_Author DROP CONSTRAINT IF EXISTS book_author_book_code_fkey;
+ALTER TABLE Book_Author
+ADD CONSTRAINT book_author_book_code_fkey FOREIGN KEY (book_code) REFERENCES Book(book_code) ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE Book_Publisher DROP CONSTRAINT IF EXISTS book_publisher_book_code_fkey;
+ALTER TABLE Book_Publisher
+ADD CONSTRAINT book_publisher_book_code_fkey FOREIGN KEY (book_code) REFERENCES Book(book_code) ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE Book_Subject DROP CONSTRAINT IF EXISTS book_subject_book_code_fkey;
+ALTER TABLE Book_Subject
+ADD CONSTRAINT book_subject_book_code_fkey FOREIGN KEY (book_code) REFERENCES Book(book_code) ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE Book_copy DROP CONSTRAINT IF EXISTS book_copy_book_code_fkey;
+ALTER TABLE Book_copy
+ADD CONSTRAINT book_copy_book_code_fkey FOREIGN KEY (book_code) REFERENCES Book(book_code) ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- Returns the bare ISBN-13 for a valid ISBN-10 or ISBN-13, else NULL.
+-- Must agree with pkg/isbn.
+CREATE OR REPLACE FUNCTION normalize_isbn(code TEXT) RETURNS TEXT AS $$
+DECLARE bare TEXT := UPPER(REGEXP_REPLACE(code, '[ -]', '', 'g'));
+total INT := 0;
+BEGIN IF bare ~ '^[0-9]{9}[0-9X]$' THEN FOR i IN 1..10 LOOP total := total + (11 - i) * (
+    CASE
+        WHEN SUBSTRING(bare FROM i FOR 1) = 'X' THEN 10
+        ELSE SUBSTRING(bare FROM i FOR 1)::INT
+    END
+);
+END LOOP;
+IF total % 11 <> 0 THEN RETURN NULL;
+END IF;
+bare := '978' || LEFT(bare, 9);
+total := 0;
+FOR i IN 1..12 LOOP total := total + SUBSTRING(bare FROM i FOR 1)::INT * (
+    CASE
+        WHEN i % 2 = 0 THEN 3
+        ELSE 1
+    END
+);
+END LOOP;
+RETURN bare || ((10 - total % 10) % 10)::TEXT;
+ELSIF bare ~ '^97[89][0-9]{10}$' THEN FOR i IN 1..13 LOOP total := total + SUBSTRING(bare FROM i FOR 1)::INT * (
+    CASE
+        WHEN i % 2 = 0 THEN 3
+        ELSE 1
+    END
+);
+END LOOP;
+IF total % 10 <> 0 THEN RETURN NULL;
+END IF;
+RETURN bare;
+END IF;
+RETURN NULL;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- Codes that are not ISBNs, or that would collide with another title once
+-- normalized, are left for staff to fix.
+UPDATE Book b
+SET book_code = normalize_isbn(b.book_code)
+WHERE normalize_isbn(b.book_code) IS NOT NULL
+    AND normalize_isbn(b.book_code) <> b.book_code
+    AND NOT EXISTS (
+        SELECT 1
+        FROM Book other
+        WHERE other.book_code <> b.book_code
+            AND COALESCE(normalize_isbn(other.book_code), other.book_code) = normalize_isbn(b.book_code)
+    );
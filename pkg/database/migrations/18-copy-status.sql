@@ -0,0 +1,92 @@
+-- Book_copy.is_available could only say available or not. It is replaced by
+-- an explicit status; every change is recorded in Copy_Status_History.
+ALTER TABLE Book_copy
+ADD COLUMN IF NOT EXISTS status VARCHAR(20);
+ALTER TABLE Book_copy
+ADD COLUMN IF NOT EXISTS status_reason TEXT;
+ALTER TABLE Book_copy
+ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMPTZ;
+
+-- Copies out without an open loan cannot be told apart, so they wait in
+-- processing for staff to check.
+UPDATE Book_copy bc
+SET status = CASE
+        WHEN EXISTS (
+            SELECT 1
+            FROM Loan l
+            WHERE l.copy_id = bc.copy_id
+                AND l.return_date IS NULL
+        ) THEN 'on_loan'
+        WHEN bc.is_available IS FALSE THEN 'processing'
+        ELSE 'available'
+    END,
+    status_reason = CASE
+        WHEN bc.is_available IS FALSE
+        AND NOT EXISTS (
+            SELECT 1
+            FROM Loan l
+            WHERE l.copy_id = bc.copy_id
+                AND l.return_date IS NULL
+        ) THEN 'unavailable without an open loan when statuses were introduced'
+    END
+WHERE status IS NULL;
+
+ALTER TABLE Book_copy
+ALTER COLUMN status SET DEFAULT 'available';
+ALTER TABLE Book_copy
+ALTER COLUMN status SET NOT NULL;
+ALTER TABLE Book_copy
+ADD CONSTRAINT book_copy_status_check CHECK (
+    status IN (
+        'processing',
+        'available',
+        'on_loan',
+        'on_hold_shelf',
+        'in_repair',
+        'damaged',
+        'lost',
+        'withdrawn'
+    )
+);
+CREATE INDEX IF NOT EXISTS idx_book_copy_book_code_status ON Book_copy(book_code, status);
+
+CREATE TABLE IF NOT EXISTS Copy_Status_History (
+    history_id SERIAL PRIMARY KEY,
+    copy_id INT NOT NULL,
+    old_status VARCHAR(20),
+    new_status VARCHAR(20) NOT NULL,
+    reason TEXT NOT NULL,
+    changed_by INT,
+    api_key_id INT,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (copy_id) REFERENCES Book_copy(copy_id) ON DELETE CASCADE,
+    FOREIGN KEY (changed_by) REFERENCES "User"(user_id) ON DELETE SET NULL,
+    FOREIGN KEY (api_key_id) REFERENCES Api_Key(key_id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_copy_status_history_copy_id ON Copy_Status_History(copy_id);
+
+INSERT INTO Copy_Status_History (copy_id, old_status, new_status, reason)
+SELECT copy_id, NULL, status, COALESCE(status_reason, 'existing copy')
+FROM Book_copy;
+
+CREATE OR REPLACE VIEW available_copies AS
+SELECT b.title,
+    STRING_AGG(
+        DISTINCT a.first_name || ' ' || a.last_name,
+        ', '
+    ) AS authors,
+    STRING_AGG(DISTINCT bl.language, ', ') AS languages,
+    p.name AS publisher,
+    COUNT(DISTINCT bc.copy_id) AS available_copies
+FROM Book b
+    JOIN Book_copy bc ON b.book_code = bc.book_code
+    LEFT JOIN Book_Author ba ON b.book_code = ba.book_code
+    LEFT JOIN Author a ON ba.author_id = a.author_id
+    LEFT JOIN Book_Language bl ON b.book_code = bl.book_code
+    LEFT JOIN Book_Publisher bp ON b.book_code = bp.book_code
+    LEFT JOIN Publisher p ON bp.publisher_id = p.publisher_id
+WHERE bc.status = 'available'
+GROUP BY b.title,
+    p.name;
+
+ALTER TABLE Book_copy DROP COLUMN IF EXISTS is_available;
@@ -0,0 +1,14 @@
+-- Labels print the call number and can be run for the copies added in a
+-- date range, so books get a call number and copies a creation time.
+ALTER TABLE Book
+ADD COLUMN IF NOT EXISTS call_number VARCHAR(50);
+ALTER TABLE Book_copy
+ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ;
+UPDATE Book_copy
+SET created_at = COALESCE(purchase_date::TIMESTAMPTZ, NOW())
+WHERE created_at IS NULL;
+ALTER TABLE Book_copy
+ALTER COLUMN created_at SET DEFAULT NOW();
+ALTER TABLE Book_copy
+ALTER COLUMN created_at SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_book_copy_created_at ON Book_copy(created_at);
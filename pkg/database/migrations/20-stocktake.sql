@@ -0,0 +1,49 @@
+-- Stocktake sessions audit one rack at a time against Book_copy. Copies
+-- expected on the rack but not scanned can be set to the new missing status.
+ALTER TABLE Book_copy DROP CONSTRAINT IF EXISTS book_copy_status_check;
+ALTER TABLE Book_copy
+ADD CONSTRAINT book_copy_status_check CHECK (
+    status IN (
+        'processing',
+        'available',
+        'on_loan',
+        'on_hold_shelf',
+        'in_repair',
+        'damaged',
+        'missing',
+        'lost',
+        'withdrawn'
+    )
+);
+CREATE INDEX IF NOT EXISTS idx_book_copy_rack_number ON Book_copy(rack_number);
+
+CREATE TABLE IF NOT EXISTS Stocktake_Session (
+    session_id SERIAL PRIMARY KEY,
+    rack_number INT NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'closed')),
+    opened_by INT,
+    opened_api_key_id INT,
+    opened_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    closed_by INT,
+    closed_api_key_id INT,
+    closed_at TIMESTAMPTZ,
+    marked_missing INT NOT NULL DEFAULT 0,
+    FOREIGN KEY (opened_by) REFERENCES "User"(user_id) ON DELETE SET NULL,
+    FOREIGN KEY (opened_api_key_id) REFERENCES Api_Key(key_id) ON DELETE SET NULL,
+    FOREIGN KEY (closed_by) REFERENCES "User"(user_id) ON DELETE SET NULL,
+    FOREIGN KEY (closed_api_key_id) REFERENCES Api_Key(key_id) ON DELETE SET NULL
+);
+-- One open session per rack, so two teams cannot count the same shelf.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stocktake_session_open_rack ON Stocktake_Session(rack_number)
+WHERE status = 'open';
+
+CREATE TABLE IF NOT EXISTS Stocktake_Scan (
+    scan_id SERIAL PRIMARY KEY,
+    session_id INT NOT NULL,
+    barcode VARCHAR(50) NOT NULL,
+    copy_id INT,
+    scanned_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (session_id) REFERENCES Stocktake_Session(session_id) ON DELETE CASCADE,
+    FOREIGN KEY (copy_id) REFERENCES Book_copy(copy_id) ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stocktake_scan_barcode ON Stocktake_Scan(session_id, barcode);
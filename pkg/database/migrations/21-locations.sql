@@ -0,0 +1,155 @@
+-- Shelving locations form a tree (building, floor, room, rack, shelf) that
+-- replaces Book_copy.rack_number. Existing racks become "Rack N" under a
+-- "Main library" building, and stocktakes count a location instead of a rack.
+CREATE TABLE IF NOT EXISTS Location (
+    location_id SERIAL PRIMARY KEY,
+    parent_id INT,
+    kind VARCHAR(10) NOT NULL CHECK (
+        kind IN ('building', 'floor', 'room', 'rack', 'shelf')
+    ),
+    label VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (parent_id) REFERENCES Location(location_id) ON DELETE RESTRICT
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_location_label ON Location(COALESCE(parent_id, 0), LOWER(label));
+
+-- display_label is the full path, e.g. "Main library, Floor 2, Rack 3";
+-- shelf_label keeps only the rack and shelf part for spine labels; ancestors
+-- includes the location itself, so a subtree is "? = ANY(ancestors)".
+CREATE OR REPLACE VIEW location_path AS
+WITH RECURSIVE tree AS (
+    SELECT location_id,
+        parent_id,
+        kind,
+        label,
+        label::TEXT AS display_label,
+        CASE
+            WHEN kind IN ('rack', 'shelf') THEN label::TEXT
+        END AS shelf_label,
+        ARRAY [location_id] AS ancestors
+    FROM Location
+    WHERE parent_id IS NULL
+    UNION ALL
+    SELECT l.location_id,
+        l.parent_id,
+        l.kind,
+        l.label,
+        p.display_label || ', ' || l.label,
+        CASE
+            WHEN l.kind IN ('rack', 'shelf') THEN CONCAT_WS(', ', p.shelf_label, l.label)
+            ELSE p.shelf_label
+        END,
+        p.ancestors || l.location_id
+    FROM Location l
+        JOIN tree p ON l.parent_id = p.location_id
+)
+SELECT location_id,
+    parent_id,
+    kind,
+    label,
+    display_label,
+    COALESCE(shelf_label, label::TEXT) AS shelf_label,
+    ancestors
+FROM tree;
+
+ALTER TABLE Book_copy
+ADD COLUMN IF NOT EXISTS location_id INT REFERENCES Location(location_id) ON DELETE RESTRICT;
+CREATE INDEX IF NOT EXISTS idx_book_copy_location_id ON Book_copy(location_id);
+
+CREATE TABLE IF NOT EXISTS Copy_Location_History (
+    history_id SERIAL PRIMARY KEY,
+    copy_id INT NOT NULL,
+    old_location_id INT,
+    new_location_id INT,
+    reason VARCHAR(255),
+    moved_by INT,
+    api_key_id INT,
+    moved_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (copy_id) REFERENCES Book_copy(copy_id) ON DELETE CASCADE,
+    FOREIGN KEY (old_location_id) REFERENCES Location(location_id) ON DELETE SET NULL,
+    FOREIGN KEY (new_location_id) REFERENCES Location(location_id) ON DELETE SET NULL,
+    FOREIGN KEY (moved_by) REFERENCES "User"(user_id) ON DELETE SET NULL,
+    FOREIGN KEY (api_key_id) REFERENCES Api_Key(key_id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_copy_location_history_copy_id ON Copy_Location_History(copy_id);
+
+INSERT INTO Location (kind, label)
+SELECT 'building',
+    'Main library'
+WHERE EXISTS (
+        SELECT 1
+        FROM Book_copy
+        WHERE rack_number IS NOT NULL
+    )
+    OR EXISTS (
+        SELECT 1
+        FROM Stocktake_Session
+    );
+INSERT INTO Location (parent_id, kind, label)
+SELECT l.location_id,
+    'rack',
+    'Rack ' || r.rack_number
+FROM (
+        SELECT rack_number
+        FROM Book_copy
+        WHERE rack_number IS NOT NULL
+        UNION
+        SELECT rack_number
+        FROM Stocktake_Session
+    ) r
+    JOIN Location l ON l.parent_id IS NULL
+    AND l.label = 'Main library'
+ORDER BY r.rack_number;
+
+UPDATE Book_copy bc
+SET location_id = l.location_id
+FROM Location l
+WHERE l.kind = 'rack'
+    AND l.label = 'Rack ' || bc.rack_number
+    AND bc.location_id IS NULL;
+INSERT INTO Copy_Location_History (copy_id, new_location_id, reason, moved_at)
+SELECT copy_id,
+    location_id,
+    'migrated from rack_number',
+    created_at
+FROM Book_copy
+WHERE location_id IS NOT NULL;
+ALTER TABLE Book_copy DROP COLUMN IF EXISTS rack_number;
+
+ALTER TABLE Stocktake_Session
+ADD COLUMN IF NOT EXISTS location_id INT REFERENCES Location(location_id) ON DELETE RESTRICT;
+UPDATE Stocktake_Session s
+SET location_id = l.location_id
+FROM Location l
+WHERE l.kind = 'rack'
+    AND l.label = 'Rack ' || s.rack_number
+    AND s.location_id IS NULL;
+ALTER TABLE Stocktake_Session
+ALTER COLUMN location_id SET NOT NULL;
+DROP INDEX IF EXISTS idx_stocktake_session_open_rack;
+ALTER TABLE Stocktake_Session DROP COLUMN IF EXISTS rack_number;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stocktake_session_open_location ON Stocktake_Session(location_id)
+WHERE status = 'open';
+
+-- Students see where the available copies are shelved.
+CREATE OR REPLACE VIEW available_copies AS
+SELECT b.title,
+    STRING_AGG(
+        DISTINCT a.first_name || ' ' || a.last_name,
+        ', '
+    ) AS authors,
+    STRING_AGG(DISTINCT bl.language, ', ') AS languages,
+    p.name AS publisher,
+    COUNT(DISTINCT bc.copy_id) AS available_copies,
+    STRING_AGG(DISTINCT lp.display_label, '; ') AS locations
+FROM Book b
+    JOIN Book_copy bc ON b.book_code = bc.book_code
+    LEFT JOIN location_path lp ON lp.location_id = bc.location_id
+    LEFT JOIN Book_Author ba ON b.book_code = ba.book_code
+    LEFT JOIN Author a ON ba.author_id = a.author_id
+    LEFT JOIN Book_Language bl ON b.book_code = bl.book_code
+    LEFT JOIN Book_Publisher bp ON b.book_code = bp.book_code
+    LEFT JOIN Publisher p ON bp.publisher_id = p.publisher_id
+WHERE bc.status = 'available'
+GROUP BY b.title,
+    p.name;
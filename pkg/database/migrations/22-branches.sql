@@ -0,0 +1,164 @@
+-- Branches own locations, copies and staff accounts. Everything that
+-- exists today belongs to a "Main library" branch. A copy returned at
+-- another branch is in_transit until its home branch receives it, and
+-- staff can transfer copies between branches on purpose.
+CREATE TABLE IF NOT EXISTS Branch (
+    branch_id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    address VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_branch_name ON Branch(LOWER(name));
+
+-- weekday follows EXTRACT(DOW): 0 is Sunday. Days without a row are closed.
+CREATE TABLE IF NOT EXISTS Branch_Hours (
+    branch_id INT NOT NULL,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    opens_at TIME NOT NULL,
+    closes_at TIME NOT NULL CHECK (closes_at > opens_at),
+    PRIMARY KEY (branch_id, weekday),
+    FOREIGN KEY (branch_id) REFERENCES Branch(branch_id) ON DELETE CASCADE
+);
+
+INSERT INTO Branch (name)
+SELECT 'Main library'
+WHERE NOT EXISTS (
+        SELECT 1
+        FROM Branch
+    );
+
+ALTER TABLE Location
+ADD COLUMN IF NOT EXISTS branch_id INT REFERENCES Branch(branch_id) ON DELETE RESTRICT;
+UPDATE Location
+SET branch_id = (
+        SELECT MIN(branch_id)
+        FROM Branch
+    )
+WHERE branch_id IS NULL;
+ALTER TABLE Location
+ALTER COLUMN branch_id SET NOT NULL;
+-- Top-level labels are unique per branch, so every branch can have its
+-- own "Main building".
+DROP INDEX IF EXISTS idx_location_label;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_location_label ON Location(branch_id, COALESCE(parent_id, 0), LOWER(label));
+
+ALTER TABLE Book_copy
+ADD COLUMN IF NOT EXISTS branch_id INT REFERENCES Branch(branch_id) ON DELETE RESTRICT;
+UPDATE Book_copy
+SET branch_id = (
+        SELECT MIN(branch_id)
+        FROM Branch
+    )
+WHERE branch_id IS NULL;
+ALTER TABLE Book_copy
+ALTER COLUMN branch_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_book_copy_branch_id ON Book_copy(branch_id);
+
+ALTER TABLE "User"
+ADD COLUMN IF NOT EXISTS branch_id INT REFERENCES Branch(branch_id) ON DELETE SET NULL;
+UPDATE "User"
+SET branch_id = (
+        SELECT MIN(branch_id)
+        FROM Branch
+    )
+WHERE branch_id IS NULL
+    AND user_role IN ('Admin', 'LibraryAgent');
+
+-- The branch where the loan was checked out.
+ALTER TABLE Loan
+ADD COLUMN IF NOT EXISTS branch_id INT REFERENCES Branch(branch_id) ON DELETE RESTRICT;
+UPDATE Loan l
+SET branch_id = bc.branch_id
+FROM Book_copy bc
+WHERE bc.copy_id = l.copy_id
+    AND l.branch_id IS NULL;
+ALTER TABLE Loan
+ALTER COLUMN branch_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_loan_branch_id ON Loan(branch_id);
+
+ALTER TABLE Book_copy DROP CONSTRAINT IF EXISTS book_copy_status_check;
+ALTER TABLE Book_copy
+ADD CONSTRAINT book_copy_status_check CHECK (
+    status IN (
+        'processing',
+        'available',
+        'on_loan',
+        'on_hold_shelf',
+        'in_transit',
+        'in_repair',
+        'damaged',
+        'missing',
+        'lost',
+        'withdrawn'
+    )
+);
+
+-- kind is 'return' for a copy returned away from home and 'transfer' for
+-- stock moved on purpose.
+CREATE TABLE IF NOT EXISTS Copy_Transfer (
+    transfer_id SERIAL PRIMARY KEY,
+    copy_id INT NOT NULL,
+    from_branch_id INT NOT NULL,
+    to_branch_id INT NOT NULL,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('return', 'transfer')),
+    status VARCHAR(10) NOT NULL DEFAULT 'in_transit' CHECK (
+        status IN ('in_transit', 'received', 'cancelled')
+    ),
+    reason VARCHAR(255),
+    sent_by INT,
+    sent_api_key_id INT,
+    sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    received_by INT,
+    received_api_key_id INT,
+    received_at TIMESTAMPTZ,
+    CHECK (from_branch_id <> to_branch_id),
+    FOREIGN KEY (copy_id) REFERENCES Book_copy(copy_id) ON DELETE CASCADE,
+    FOREIGN KEY (from_branch_id) REFERENCES Branch(branch_id) ON DELETE RESTRICT,
+    FOREIGN KEY (to_branch_id) REFERENCES Branch(branch_id) ON DELETE RESTRICT,
+    FOREIGN KEY (sent_by) REFERENCES "User"(user_id) ON DELETE SET NULL,
+    FOREIGN KEY (sent_api_key_id) REFERENCES Api_Key(key_id) ON DELETE SET NULL,
+    FOREIGN KEY (received_by) REFERENCES "User"(user_id) ON DELETE SET NULL,
+    FOREIGN KEY (received_api_key_id) REFERENCES Api_Key(key_id) ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_copy_transfer_open ON Copy_Transfer(copy_id)
+WHERE status = 'in_transit';
+CREATE INDEX IF NOT EXISTS idx_copy_transfer_to_branch ON Copy_Transfer(to_branch_id, status);
+
+CREATE OR REPLACE VIEW location_path AS
+WITH RECURSIVE tree AS (
+    SELECT location_id,
+        parent_id,
+        kind,
+        label,
+        label::TEXT AS display_label,
+        CASE
+            WHEN kind IN ('rack', 'shelf') THEN label::TEXT
+        END AS shelf_label,
+        ARRAY [location_id] AS ancestors,
+        branch_id
+    FROM Location
+    WHERE parent_id IS NULL
+    UNION ALL
+    SELECT l.location_id,
+        l.parent_id,
+        l.kind,
+        l.label,
+        p.display_label || ', ' || l.label,
+        CASE
+            WHEN l.kind IN ('rack', 'shelf') THEN CONCAT_WS(', ', p.shelf_label, l.label)
+            ELSE p.shelf_label
+        END,
+        p.ancestors || l.location_id,
+        l.branch_id
+    FROM Location l
+        JOIN tree p ON l.parent_id = p.location_id
+)
+SELECT location_id,
+    parent_id,
+    kind,
+    label,
+    display_label,
+    COALESCE(shelf_label, label::TEXT) AS shelf_label,
+    ancestors,
+    branch_id
+FROM tree;
@@ -0,0 +1,100 @@
+// Package isbn validates ISBN-10 and ISBN-13 numbers and converts between
+// them. The canonical form used for Book.book_code is the bare ISBN-13.
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalid = errors.New("invalid ISBN")
+
+// Normalize accepts an ISBN-10 or ISBN-13 with or without hyphens and
+// spaces, verifies its check digit and returns the bare ISBN-13.
+func Normalize(code string) (string, error) {
+	bare := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	switch {
+	case Valid10(bare):
+		return To13(bare)
+	case Valid13(bare):
+		return bare, nil
+	}
+	return "", ErrInvalid
+}
+
+// Valid10 reports whether bare is an ISBN-10 with a correct check digit.
+// Only the check digit may be X.
+func Valid10(bare string) bool {
+	if len(bare) != 10 || !digits(bare[:9]) {
+		return false
+	}
+	last := bare[9]
+	if last != 'X' && (last < '0' || last > '9') {
+		return false
+	}
+	return checkDigit10(bare[:9]) == last
+}
+
+// Valid13 reports whether bare is a 978 or 979 ISBN-13 with a correct check
+// digit.
+func Valid13(bare string) bool {
+	if len(bare) != 13 || !digits(bare) || !(strings.HasPrefix(bare, "978") || strings.HasPrefix(bare, "979")) {
+		return false
+	}
+	return checkDigit13(bare[:12]) == bare[12]
+}
+
+// To13 converts a valid bare ISBN-10 to its ISBN-13.
+func To13(isbn10 string) (string, error) {
+	if !Valid10(isbn10) {
+		return "", ErrInvalid
+	}
+	payload := "978" + isbn10[:9]
+	return payload + string(checkDigit13(payload)), nil
+}
+
+// To10 converts a valid bare ISBN-13 to its ISBN-10. Only 978 numbers have
+// one.
+func To10(isbn13 string) (string, bool) {
+	if !Valid13(isbn13) || !strings.HasPrefix(isbn13, "978") {
+		return "", false
+	}
+	payload := isbn13[3:12]
+	return payload + string(checkDigit10(payload)), true
+}
+
+// checkDigit10 weights the nine digits 10 down to 2; the check digit makes
+// the sum divisible by 11, with X standing for 10.
+func checkDigit10(payload string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += (10 - i) * int(payload[i]-'0')
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// checkDigit13 weights the twelve digits alternately 1 and 3.
+func checkDigit13(payload string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(payload[i]-'0')
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
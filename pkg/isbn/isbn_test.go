@@ -0,0 +1,86 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"0306406152", "9780306406157"},
+		{"9780306406157", "9780306406157"},
+		{"0-306-40615-2", "9780306406157"},
+		{"978-0-306-40615-7", "9780306406157"},
+		{" 978 0 306 40615 7 ", "9780306406157"},
+		{"080442957X", "9780804429573"},
+		{"0-8044-2957-x", "9780804429573"},
+		{"979-10-90636-07-1", "9791090636071"},
+	}
+
+	for _, tt := range tests {
+		got, err := Normalize(tt.input)
+		if err != nil {
+			t.Errorf("Normalize(%q) returned %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Normalize(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeRejectsInvalid(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"0306406153",     // wrong ISBN-10 check digit
+		"9780306406158",  // wrong ISBN-13 check digit
+		"X306406152",     // X outside the check digit
+		"0804429570",     // check digit should be X
+		"9770306406154",  // not a 978 or 979 prefix
+		"978030640615",   // too short
+		"97803064061570", // too long
+		"LOC-THESIS-042",
+	} {
+		if got, err := Normalize(input); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Normalize(%q) = %q, %v, want ErrInvalid", input, got, err)
+		}
+	}
+}
+
+func TestConversionPairs(t *testing.T) {
+	pairs := []struct {
+		isbn10 string
+		isbn13 string
+	}{
+		{"0306406152", "9780306406157"},
+		{"080442957X", "9780804429573"},
+		{"043942089X", "9780439420891"},
+		{"155404295X", "9781554042951"},
+	}
+
+	for _, pair := range pairs {
+		got13, err := To13(pair.isbn10)
+		if err != nil || got13 != pair.isbn13 {
+			t.Errorf("To13(%s) = %s, %v, want %s", pair.isbn10, got13, err, pair.isbn13)
+		}
+		got10, ok := To10(pair.isbn13)
+		if !ok || got10 != pair.isbn10 {
+			t.Errorf("To10(%s) = %s, %v, want %s", pair.isbn13, got10, ok, pair.isbn10)
+		}
+	}
+}
+
+// 979 numbers are valid ISBN-13s but have no ISBN-10.
+func TestTo10Without978Prefix(t *testing.T) {
+	for _, isbn13 := range []string{"9791090636071", "9791234567896"} {
+		if !Valid13(isbn13) {
+			t.Errorf("Valid13(%s) = false", isbn13)
+		}
+		if got, ok := To10(isbn13); ok {
+			t.Errorf("To10(%s) = %s, want no ISBN-10", isbn13, got)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package labels renders spine and barcode labels for book copies: PDF
+// pages laid out for stock label sheets, or a PNG for a single label.
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrUnknownSheet = errors.New("unknown label sheet")
+
+// Label is the content of one sticker.
+type Label struct {
+	Barcode    string
+	Title      string
+	CallNumber string
+	Shelf      string
+}
+
+// Sheet describes a label sheet in PDF points (1/72 inch).
+type Sheet struct {
+	Name        string
+	PageWidth   float64
+	PageHeight  float64
+	Columns     int
+	Rows        int
+	LabelWidth  float64
+	LabelHeight float64
+	MarginLeft  float64
+	MarginTop   float64
+	PitchX      float64
+	PitchY      float64
+}
+
+const mm = 72 / 25.4
+
+// Sheets are the supported stock layouts, keyed by name.
+var Sheets = map[string]Sheet{
+	// Avery 5160 / 8160: US Letter, 3 x 10 labels of 2 5/8" x 1".
+	"avery5160": {
+		Name: "avery5160", PageWidth: 612, PageHeight: 792,
+		Columns: 3, Rows: 10, LabelWidth: 189, LabelHeight: 72,
+		MarginLeft: 13.5, MarginTop: 36, PitchX: 198, PitchY: 72,
+	},
+	// Avery L7160: A4, 3 x 7 labels of 63.5 x 38.1 mm.
+	"l7160": {
+		Name: "l7160", PageWidth: 210 * mm, PageHeight: 297 * mm,
+		Columns: 3, Rows: 7, LabelWidth: 63.5 * mm, LabelHeight: 38.1 * mm,
+		MarginLeft: 7.2 * mm, MarginTop: 15.15 * mm, PitchX: 66 * mm, PitchY: 38.1 * mm,
+	},
+}
+
+// DefaultSheet is used when the caller does not name one.
+const DefaultSheet = "avery5160"
+
+// LookupSheet returns the sheet layout called name, or the default for "".
+func LookupSheet(name string) (Sheet, error) {
+	if name == "" {
+		name = DefaultSheet
+	}
+	sheet, ok := Sheets[name]
+	if !ok {
+		return Sheet{}, fmt.Errorf("%w: %s", ErrUnknownSheet, name)
+	}
+	return sheet, nil
+}
+
+// detailLine joins the call number and shelf for the second line of text.
+func (l Label) detailLine() string {
+	switch {
+	case l.CallNumber != "" && l.Shelf != "":
+		return l.CallNumber + "  |  " + l.Shelf
+	case l.Shelf != "":
+		return l.Shelf
+	default:
+		return l.CallNumber
+	}
+}
+
+// truncateText cuts text to max characters, ending with an ellipsis.
+func truncateText(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max || max < 4 {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:max-3])) + "..."
+}
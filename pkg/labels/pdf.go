@@ -0,0 +1,159 @@
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"db_project2/pkg/code128"
+)
+
+// approximate average glyph width of Helvetica, as a fraction of the font
+// size; text is also clipped to the label, so this only guides truncation.
+const helveticaWidth = 0.52
+
+// WritePDF lays labels out on sheet, left to right and top to bottom,
+// starting after skip positions so a partly used sheet can be fed again.
+func WritePDF(w io.Writer, sheet Sheet, labels []Label, skip int) error {
+	perPage := sheet.Columns * sheet.Rows
+	if skip < 0 || skip >= perPage {
+		return fmt.Errorf("skip must be between 0 and %d", perPage-1)
+	}
+
+	var pages []bytes.Buffer
+	for i, label := range labels {
+		position := skip + i
+		if position/perPage >= len(pages) {
+			pages = append(pages, bytes.Buffer{})
+		}
+		slot := position % perPage
+		x := sheet.MarginLeft + float64(slot%sheet.Columns)*sheet.PitchX
+		top := sheet.PageHeight - sheet.MarginTop - float64(slot/sheet.Columns)*sheet.PitchY
+		if err := drawPDFLabel(&pages[len(pages)-1], label, x, top-sheet.LabelHeight, sheet.LabelWidth, sheet.LabelHeight); err != nil {
+			return fmt.Errorf("label %d (%s): %w", i+1, label.Barcode, err)
+		}
+	}
+	if len(pages) == 0 {
+		pages = append(pages, bytes.Buffer{})
+	}
+
+	doc := &pdfWriter{}
+	doc.object("<< /Type /Catalog /Pages 2 0 R >>")
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 5+2*i))
+	}
+	doc.object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	doc.object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	doc.object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range pages {
+		doc.object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			sheet.PageWidth, sheet.PageHeight, 6+2*i))
+		doc.object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", page.Len(), page.String()))
+	}
+
+	_, err := w.Write(doc.finish())
+	return err
+}
+
+// drawPDFLabel writes one label with its lower left corner at x, y: the
+// title, call number and shelf, then the barcode with its text beneath.
+func drawPDFLabel(out *bytes.Buffer, label Label, x, y, width, height float64) error {
+	modules, err := code128.Encode(label.Barcode)
+	if err != nil {
+		return err
+	}
+
+	padding := height * 0.08
+	inner := width - 2*padding
+	titleSize := height * 0.12
+	detailSize := height * 0.105
+	codeSize := height * 0.1
+
+	fmt.Fprintf(out, "q %.2f %.2f %.2f %.2f re W n\n", x, y, width, height)
+	line := y + height - padding - titleSize
+	pdfText(out, "F2", titleSize, x+padding, line, fitText(label.Title, inner, titleSize))
+	line -= detailSize * 1.25
+	pdfText(out, "F1", detailSize, x+padding, line, fitText(label.detailLine(), inner, detailSize))
+
+	barTop := line - detailSize*0.6
+	barBottom := y + padding + codeSize*1.3
+	total := float64(len(modules) + 2*code128.QuietZone)
+	module := width / total
+	barX := x + (width-module*float64(len(modules)))/2
+	out.WriteString("0 g\n")
+	for i := 0; i < len(modules); {
+		if !modules[i] {
+			i++
+			continue
+		}
+		run := i
+		for run < len(modules) && modules[run] {
+			run++
+		}
+		fmt.Fprintf(out, "%.3f %.2f %.3f %.2f re\n", barX+float64(i)*module, barBottom, float64(run-i)*module, barTop-barBottom)
+		i = run
+	}
+	out.WriteString("f\n")
+
+	codeWidth := float64(len(label.Barcode)) * codeSize * helveticaWidth
+	pdfText(out, "F1", codeSize, x+(width-codeWidth)/2, y+padding, label.Barcode)
+	out.WriteString("Q\n")
+	return nil
+}
+
+func pdfText(out *bytes.Buffer, font string, size, x, y float64, text string) {
+	if text == "" {
+		return
+	}
+	fmt.Fprintf(out, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfString(text))
+}
+
+// fitText shortens text with an ellipsis so it fits width at size.
+func fitText(text string, width, size float64) string {
+	return truncateText(text, int(width/(size*helveticaWidth)))
+}
+
+// pdfString escapes text for a literal string in WinAnsi encoding;
+// characters outside Latin-1 print as "?".
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r >= 32 && r <= 126 || r >= 160 && r <= 255:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// pdfWriter numbers objects from 1 in the order they are added and builds
+// the cross-reference table.
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+func (p *pdfWriter) object(body string) {
+	if p.buf.Len() == 0 {
+		p.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	}
+	p.offsets = append(p.offsets, p.buf.Len())
+	fmt.Fprintf(&p.buf, "%d 0 obj\n%s\nendobj\n", len(p.offsets), body)
+}
+
+func (p *pdfWriter) finish() []byte {
+	xref := p.buf.Len()
+	fmt.Fprintf(&p.buf, "xref\n0 %d\n0000000000 65535 f \n", len(p.offsets)+1)
+	for _, offset := range p.offsets {
+		fmt.Fprintf(&p.buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&p.buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(p.offsets)+1, xref)
+	return p.buf.Bytes()
+}
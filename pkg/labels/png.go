@@ -0,0 +1,97 @@
+package labels
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	"db_project2/pkg/code128"
+)
+
+// pngModule is the width of one barcode module in pixels; at 300 dpi this
+// keeps the narrowest bar at about 0.25 mm.
+const (
+	pngModule    = 3
+	pngTextScale = 3
+	pngPadding   = 24
+	pngMaxChars  = 40
+)
+
+// WritePNG renders a single label as a PNG sized to its barcode.
+func WritePNG(w io.Writer, label Label) error {
+	modules, err := code128.Encode(label.Barcode)
+	if err != nil {
+		return err
+	}
+	label.Title = truncateText(label.Title, pngMaxChars)
+	label.CallNumber = truncateText(label.CallNumber, pngMaxChars/2)
+
+	lineHeight := 10 * pngTextScale
+	width := (len(modules) + 2*code128.QuietZone) * pngModule
+	if textWidth := maxTextWidth(label) + 2*pngPadding; textWidth > width {
+		width = textWidth
+	}
+	barHeight := width / 4
+	height := pngPadding + 2*lineHeight + lineHeight/2 + barHeight + lineHeight/2 + lineHeight + pngPadding
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+
+	y := pngPadding
+	drawText(img, pngPadding, y, label.Title)
+	y += lineHeight
+	drawText(img, pngPadding, y, label.detailLine())
+	y += lineHeight + lineHeight/2
+
+	x := (width - len(modules)*pngModule) / 2
+	for i, bar := range modules {
+		if !bar {
+			continue
+		}
+		for dx := 0; dx < pngModule; dx++ {
+			for dy := 0; dy < barHeight; dy++ {
+				img.SetGray(x+i*pngModule+dx, y+dy, color.Gray{})
+			}
+		}
+	}
+	y += barHeight + lineHeight/2
+
+	drawText(img, (width-textWidth(label.Barcode))/2, y, label.Barcode)
+
+	return png.Encode(w, img)
+}
+
+func maxTextWidth(label Label) int {
+	max := textWidth(label.Title)
+	if width := textWidth(label.detailLine()); width > max {
+		max = width
+	}
+	return max
+}
+
+func textWidth(text string) int {
+	return len([]rune(text)) * glyphAdvance * pngTextScale
+}
+
+// drawText draws text with its top left corner at x, y.
+func drawText(img *image.Gray, x, y int, text string) {
+	for _, r := range text {
+		glyph := glyphFor(r)
+		for column, bits := range glyph {
+			for row := 0; row < 8; row++ {
+				if bits&(1<<row) == 0 {
+					continue
+				}
+				for dx := 0; dx < pngTextScale; dx++ {
+					for dy := 0; dy < pngTextScale; dy++ {
+						img.SetGray(x+(column*pngTextScale)+dx, y+row*pngTextScale+dy, color.Gray{})
+					}
+				}
+			}
+		}
+		x += glyphAdvance * pngTextScale
+	}
+}
@@ -0,0 +1,102 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+type SMTPMailer struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{host: host, port: port, username: username, password: password, from: from}
+}
+
+// Send delivers msg through the configured relay. Authentication is only
+// attempted when a username is set, which keeps MailHog-style relays simple.
+func (s *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", s.host, s.port)
+	err := smtp.SendMail(addr, auth, s.from, []string{msg.To}, formatMessage(s.from, msg))
+	if err != nil {
+		return fmt.Errorf("failed to send mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// LogMailer writes messages to a file, or to the application log when no
+// path is given. It is meant for local development and tests.
+type LogMailer struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+func NewLogMailer(path, from string) *LogMailer {
+	return &LogMailer{path: path, from: from}
+}
+
+func (l *LogMailer) Send(msg Message) error {
+	content := formatMessage(l.from, msg)
+	if l.path == "" {
+		log.Printf("Outgoing mail:\n%s", content)
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(content, []byte("\r\n")...)); err != nil {
+		return fmt.Errorf("failed to write mail log: %w", err)
+	}
+	return nil
+}
+
+func formatMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// headerValue strips line breaks so a value cannot inject extra headers.
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
@@ -0,0 +1,292 @@
+// Package marc reads bibliographic records in binary MARC21 (ISO 2709) and
+// MARCXML. It only decodes the record structure; mapping fields to the
+// catalog is left to the caller.
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	recordTerminator = 0x1D
+	fieldTerminator  = 0x1E
+	subfieldDelim    = 0x1F
+	leaderLength     = 24
+)
+
+var ErrUnknownFormat = errors.New("input is neither MARC21 nor MARCXML")
+
+type Subfield struct {
+	Code  string
+	Value string
+}
+
+// Field is a control field (tags below 010, Value set) or a data field
+// with indicators and subfields.
+type Field struct {
+	Tag       string
+	Ind1      string
+	Ind2      string
+	Value     string
+	Subfields []Subfield
+}
+
+type Record struct {
+	Leader string
+	Fields []Field
+	// Err is set when the record could not be decoded. The other records of
+	// the file are still returned.
+	Err error
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// ReadAll skips a UTF-8 byte order mark, detects the format from the first
+// byte and decodes every record. It fails only when the input as a whole
+// cannot be read.
+func ReadAll(r io.Reader) ([]Record, error) {
+	reader := bufio.NewReader(r)
+	if bom, _ := reader.Peek(len(utf8BOM)); bytes.Equal(bom, utf8BOM) {
+		reader.Discard(len(utf8BOM))
+	}
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return nil, ErrUnknownFormat
+			}
+			return nil, err
+		}
+		switch {
+		case b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n':
+			reader.ReadByte()
+		case b[0] == '<':
+			return readXML(reader)
+		case b[0] >= '0' && b[0] <= '9':
+			return readBinary(reader)
+		default:
+			return nil, ErrUnknownFormat
+		}
+	}
+}
+
+func readBinary(reader *bufio.Reader) ([]Record, error) {
+	var records []Record
+	for {
+		raw, err := reader.ReadBytes(recordTerminator)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(raw)) > 0 {
+			record, decodeErr := decodeBinary(raw)
+			if decodeErr != nil {
+				record.Err = decodeErr
+			}
+			records = append(records, record)
+		}
+		if err == io.EOF {
+			return records, nil
+		}
+	}
+}
+
+// decodeBinary parses one ISO 2709 record: the leader, a directory of
+// 12-byte entries (tag, length, offset) and the field data at the base
+// address given in the leader.
+func decodeBinary(raw []byte) (Record, error) {
+	raw = bytes.TrimLeft(raw, "\r\n")
+	if len(raw) < leaderLength+1 {
+		return Record{}, fmt.Errorf("record is shorter than its leader")
+	}
+	record := Record{Leader: string(raw[:leaderLength])}
+
+	base, ok := digits(raw[12:17])
+	if !ok || base <= leaderLength || base > len(raw) {
+		return record, fmt.Errorf("invalid base address %q", raw[12:17])
+	}
+
+	directory := raw[leaderLength : base-1]
+	if len(directory)%12 != 0 {
+		return record, fmt.Errorf("directory length %d is not a multiple of 12", len(directory))
+	}
+	data := raw[base:]
+
+	for i := 0; i < len(directory); i += 12 {
+		entry := directory[i : i+12]
+		tag := string(entry[:3])
+		length, ok1 := digits(entry[3:7])
+		start, ok2 := digits(entry[7:12])
+		if !ok1 || !ok2 || start+length > len(data) || length < 1 {
+			return record, fmt.Errorf("invalid directory entry for tag %s", tag)
+		}
+		content := text(bytes.TrimRight(data[start:start+length], string([]byte{fieldTerminator, recordTerminator})))
+
+		if isControlTag(tag) {
+			record.Fields = append(record.Fields, Field{Tag: tag, Value: content})
+			continue
+		}
+
+		field := Field{Tag: tag, Ind1: " ", Ind2: " "}
+		parts := strings.Split(content, string(rune(subfieldDelim)))
+		if len(parts[0]) >= 1 {
+			field.Ind1 = parts[0][:1]
+		}
+		if len(parts[0]) >= 2 {
+			field.Ind2 = parts[0][1:2]
+		}
+		for _, part := range parts[1:] {
+			if part == "" {
+				continue
+			}
+			field.Subfields = append(field.Subfields, Subfield{Code: part[:1], Value: part[1:]})
+		}
+		record.Fields = append(record.Fields, field)
+	}
+	return record, nil
+}
+
+type xmlRecord struct {
+	Leader        string `xml:"leader"`
+	ControlFields []struct {
+		Tag   string `xml:"tag,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"controlfield"`
+	DataFields []struct {
+		Tag       string `xml:"tag,attr"`
+		Ind1      string `xml:"ind1,attr"`
+		Ind2      string `xml:"ind2,attr"`
+		Subfields []struct {
+			Code  string `xml:"code,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"subfield"`
+	} `xml:"datafield"`
+}
+
+// readXML streams <record> elements, so it accepts a <collection> as well as
+// a single record, with or without the MARC21 slim namespace.
+func readXML(reader io.Reader) ([]Record, error) {
+	decoder := xml.NewDecoder(reader)
+	var records []Record
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			if len(records) == 0 {
+				return nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+			}
+			// The rest of the document is unreadable; keep what was decoded.
+			records = append(records, Record{Err: fmt.Errorf("malformed XML: %v", err)})
+			return records, nil
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		var parsed xmlRecord
+		if err := decoder.DecodeElement(&parsed, &start); err != nil {
+			records = append(records, Record{Err: fmt.Errorf("malformed record: %v", err)})
+			return records, nil
+		}
+
+		record := Record{Leader: parsed.Leader}
+		for _, control := range parsed.ControlFields {
+			record.Fields = append(record.Fields, Field{Tag: control.Tag, Value: control.Value})
+		}
+		for _, data := range parsed.DataFields {
+			field := Field{Tag: data.Tag, Ind1: indicator(data.Ind1), Ind2: indicator(data.Ind2)}
+			for _, subfield := range data.Subfields {
+				field.Subfields = append(field.Subfields, Subfield{Code: subfield.Code, Value: subfield.Value})
+			}
+			record.Fields = append(record.Fields, field)
+		}
+		records = append(records, record)
+	}
+}
+
+// Control returns the value of the first control field with tag.
+func (r *Record) Control(tag string) string {
+	for _, field := range r.Fields {
+		if field.Tag == tag {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// DataFields returns every data field with tag, in record order.
+func (r *Record) DataFields(tag string) []Field {
+	var fields []Field
+	for _, field := range r.Fields {
+		if field.Tag == tag {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// Subfield returns the first subfield with code.
+func (f *Field) Subfield(code string) string {
+	for _, subfield := range f.Subfields {
+		if subfield.Code == code {
+			return subfield.Value
+		}
+	}
+	return ""
+}
+
+// SubfieldValues returns every subfield with code.
+func (f *Field) SubfieldValues(code string) []string {
+	var values []string
+	for _, subfield := range f.Subfields {
+		if subfield.Code == code {
+			values = append(values, subfield.Value)
+		}
+	}
+	return values
+}
+
+// digits parses the unsigned decimal numbers of the leader and directory.
+// strconv.Atoi would also take a sign, and a negative offset would slice
+// outside the record.
+func digits(raw []byte) (int, bool) {
+	n := 0
+	for _, b := range raw {
+		if b < '0' || b > '9' {
+			return 0, false
+		}
+		n = n*10 + int(b-'0')
+	}
+	return n, len(raw) > 0
+}
+
+func isControlTag(tag string) bool {
+	return strings.HasPrefix(tag, "00")
+}
+
+func indicator(value string) string {
+	if value == "" {
+		return " "
+	}
+	return value[:1]
+}
+
+// text decodes field data. Records are expected in UTF-8 (leader/09 = a);
+// MARC-8 is not supported, so invalid bytes are dropped rather than
+// guessed at.
+func text(raw []byte) string {
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+	return strings.ToValidUTF8(string(raw), "")
+}
@@ -0,0 +1,178 @@
+package marc
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// binaryRecord assembles an ISO 2709 record from tag and content pairs. Data
+// field content starts with the indicators; subfields are written with $ for
+// the delimiter.
+func binaryRecord(fields ...[2]string) []byte {
+	var directory, data bytes.Buffer
+	for _, field := range fields {
+		content := strings.ReplaceAll(field[1], "$", string(rune(subfieldDelim))) + string(rune(fieldTerminator))
+		fmt.Fprintf(&directory, "%s%04d%05d", field[0], len(content), data.Len())
+		data.WriteString(content)
+	}
+	directory.WriteByte(fieldTerminator)
+
+	base := leaderLength + directory.Len()
+	total := base + data.Len() + 1
+
+	var record bytes.Buffer
+	fmt.Fprintf(&record, "%05dnam a22%05d   4500", total, base)
+	record.Write(directory.Bytes())
+	record.Write(data.Bytes())
+	record.WriteByte(recordTerminator)
+	return record.Bytes()
+}
+
+func sampleRecord() []byte {
+	return binaryRecord(
+		[2]string{"001", "ocm123"},
+		[2]string{"020", "  $a9780306406157"},
+		[2]string{"245", "10$aThe title$bsubtitle"},
+	)
+}
+
+func TestReadAllBinary(t *testing.T) {
+	records, err := ReadAll(bytes.NewReader(sampleRecord()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Err != nil {
+		t.Fatalf("got %d records, first error %v", len(records), records[0].Err)
+	}
+
+	record := records[0]
+	if got := record.Control("001"); got != "ocm123" {
+		t.Errorf("001 = %q, want ocm123", got)
+	}
+	titles := record.DataFields("245")
+	if len(titles) != 1 {
+		t.Fatalf("got %d 245 fields, want 1", len(titles))
+	}
+	if titles[0].Ind1 != "1" || titles[0].Ind2 != "0" {
+		t.Errorf("245 indicators = %q %q, want 1 0", titles[0].Ind1, titles[0].Ind2)
+	}
+	if got := titles[0].Subfield("a"); got != "The title" {
+		t.Errorf("245$a = %q, want The title", got)
+	}
+	isbns := record.DataFields("020")
+	if len(isbns) != 1 || isbns[0].Subfield("a") != "9780306406157" {
+		t.Errorf("020 = %+v", isbns)
+	}
+}
+
+// Each malformed record must come back with Err set, not panic, and must not
+// stop the records after it from being read.
+func TestReadAllMalformedBinary(t *testing.T) {
+	// The first directory entry starts right after the leader: tag (3),
+	// length (4), offset (5).
+	const (
+		entryLength = leaderLength + 3
+		entryOffset = leaderLength + 7
+	)
+
+	tests := []struct {
+		name    string
+		corrupt func(raw []byte) []byte
+	}{
+		{"negative offset", func(raw []byte) []byte {
+			copy(raw[entryOffset:], "-0001")
+			return raw
+		}},
+		{"negative length", func(raw []byte) []byte {
+			copy(raw[entryLength:], "-001")
+			return raw
+		}},
+		{"signed offset", func(raw []byte) []byte {
+			copy(raw[entryOffset:], "+0000")
+			return raw
+		}},
+		{"offset past the data", func(raw []byte) []byte {
+			copy(raw[entryOffset:], "99999")
+			return raw
+		}},
+		{"zero length", func(raw []byte) []byte {
+			copy(raw[entryLength:], "0000")
+			return raw
+		}},
+		{"negative base address", func(raw []byte) []byte {
+			copy(raw[12:], "-0001")
+			return raw
+		}},
+		{"base address past the record", func(raw []byte) []byte {
+			copy(raw[12:], "99999")
+			return raw
+		}},
+		{"non-numeric base address", func(raw []byte) []byte {
+			copy(raw[12:], "00x40")
+			return raw
+		}},
+		{"directory not a multiple of 12", func(raw []byte) []byte {
+			return append(raw[:leaderLength+5:leaderLength+5], raw[leaderLength+6:]...)
+		}},
+		{"shorter than the leader", func(raw []byte) []byte {
+			return append([]byte("00010nam"), recordTerminator)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input []byte
+			input = append(input, tt.corrupt(sampleRecord())...)
+			input = append(input, sampleRecord()...)
+
+			records, err := ReadAll(bytes.NewReader(input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 2 {
+				t.Fatalf("got %d records, want 2", len(records))
+			}
+			if records[0].Err == nil {
+				t.Error("malformed record decoded without an error")
+			}
+			if records[1].Err != nil {
+				t.Errorf("following record failed: %v", records[1].Err)
+			}
+		})
+	}
+}
+
+func TestReadAllXML(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<collection xmlns="http://www.loc.gov/MARC21/slim">
+  <record>
+    <leader>00000nam a2200000   4500</leader>
+    <controlfield tag="001">ocm123</controlfield>
+    <datafield tag="245" ind1="1" ind2="">
+      <subfield code="a">The title</subfield>
+    </datafield>
+  </record>
+</collection>`
+
+	records, err := ReadAll(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Err != nil {
+		t.Fatalf("got %+v", records)
+	}
+	titles := records[0].DataFields("245")
+	if len(titles) != 1 || titles[0].Subfield("a") != "The title" || titles[0].Ind2 != " " {
+		t.Errorf("245 = %+v", titles)
+	}
+}
+
+func TestReadAllUnknownFormat(t *testing.T) {
+	for _, input := range []string{"", "   ", "title,author\n"} {
+		if _, err := ReadAll(strings.NewReader(input)); err != ErrUnknownFormat {
+			t.Errorf("ReadAll(%q) error = %v, want ErrUnknownFormat", input, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// publicKeys decodes the signing keys of the set. Keys of other types or
+// uses are skipped rather than failing the whole set.
+func (s jwkSet) publicKeys() map[string]interface{} {
+	keys := map[string]interface{}{}
+	for _, key := range s.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		switch key.Kty {
+		case "RSA":
+			n, errN := decodeBigInt(key.N)
+			e, errE := decodeBigInt(key.E)
+			if errN != nil || errE != nil || !e.IsInt64() {
+				continue
+			}
+			keys[key.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			if key.Crv != "P-256" {
+				continue
+			}
+			x, errX := decodeBigInt(key.X)
+			y, errY := decodeBigInt(key.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[key.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		}
+	}
+	return keys
+}
+
+func verifySignature(alg string, key interface{}, signingInput string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("signing key does not match token algorithm")
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("invalid id token signature")
+		}
+		return nil
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return errors.New("signing key does not match token algorithm")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return errors.New("invalid id token signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported id token algorithm %q", alg)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
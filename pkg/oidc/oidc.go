@@ -0,0 +1,359 @@
+// Package oidc is a small OpenID Connect relying party: discovery, the
+// authorization code flow with PKCE and ID token verification against the
+// provider's JWKS (RS256 and ES256).
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// AuthorizationEndpoint overrides the discovered endpoint, for setups
+	// where browsers reach the provider under a different host name than
+	// the server does (for example a provider running in docker compose).
+	AuthorizationEndpoint string
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the verified ID token claims.
+type Claims map[string]interface{}
+
+func (c Claims) String(name string) string {
+	value, _ := c[name].(string)
+	return value
+}
+
+// Strings reads a claim that providers send either as a list or as a single
+// (possibly space separated) string, as is common for group claims.
+func (c Claims) Strings(name string) []string {
+	switch value := c[name].(type) {
+	case []interface{}:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				items = append(items, s)
+			}
+		}
+		return items
+	case string:
+		return strings.Fields(value)
+	default:
+		return nil
+	}
+}
+
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]interface{}
+	keysAt    time.Time
+}
+
+func NewProvider(config Config) *Provider {
+	return &Provider{config: config, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// NewCodeVerifier returns a PKCE code verifier (RFC 7636, 43 characters).
+func NewCodeVerifier() (string, error) {
+	return randomString(32)
+}
+
+// NewState returns an opaque value for the state or nonce parameters.
+func NewState() (string, error) {
+	return randomString(32)
+}
+
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := d.AuthorizationEndpoint
+	if p.config.AuthorizationEndpoint != "" {
+		endpoint = p.config.AuthorizationEndpoint
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(p.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", CodeChallenge(codeVerifier))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(endpoint, "?") {
+		separator = "&"
+	}
+	return endpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified claims of
+// the ID token in the response.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Claims, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return p.VerifyIDToken(ctx, token.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed id token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed id token header")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, errors.New("malformed id token header")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed id token signature")
+	}
+
+	key, err := p.getKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed id token payload")
+	}
+	var claims Claims
+	decoder := json.NewDecoder(strings.NewReader(string(payload)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, errors.New("malformed id token payload")
+	}
+
+	if claims.String("iss") != p.config.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.String("iss"))
+	}
+	if !containsString(claims.Strings("aud"), p.config.ClientID) {
+		return nil, errors.New("id token was not issued for this client")
+	}
+	if nonce != "" && claims.String("nonce") != nonce {
+		return nil, errors.New("id token nonce mismatch")
+	}
+
+	exp, err := numericClaim(claims, "exp")
+	if err != nil {
+		return nil, err
+	}
+	// One minute of leeway for clock skew between us and the provider.
+	if time.Now().After(time.Unix(exp, 0).Add(time.Minute)) {
+		return nil, errors.New("id token expired")
+	}
+	if claims.String("sub") == "" {
+		return nil, errors.New("id token has no subject")
+	}
+
+	return claims, nil
+}
+
+func (p *Provider) getDiscovery(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d discovery
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &d); err != nil {
+		return nil, fmt.Errorf("failed to load provider configuration: %w", err)
+	}
+	if d.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("provider reports issuer %q, expected %q", d.Issuer, p.config.Issuer)
+	}
+
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// getKey returns the signing key for kid. The key set is refetched when an
+// unknown kid shows up, at most once a minute, so provider key rotation is
+// picked up without a restart.
+func (p *Provider) getKey(ctx context.Context, kid string) (interface{}, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysAt) < time.Minute {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set jwkSet
+	if err := p.getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to load provider keys: %w", err)
+	}
+	p.keys = set.publicKeys()
+	p.keysAt = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *Provider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) getJSON(ctx context.Context, target string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+func numericClaim(claims Claims, name string) (int64, error) {
+	number, ok := claims[name].(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("id token has no %s claim", name)
+	}
+	value, err := number.Int64()
+	if err != nil {
+		floatValue, err := number.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s claim", name)
+		}
+		value = int64(floatValue)
+	}
+	return value, nil
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+func randomString(size int) (string, error) {
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
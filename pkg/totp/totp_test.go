@@ -0,0 +1,76 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the RFC 6238 Appendix B SHA-1 seed "12345678901234567890"
+// in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC lists 8-digit codes; with 6 digits the code is their last six.
+func TestCodeAtRFC6238Vectors(t *testing.T) {
+	vectors := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},          // 94287082
+		{1111111109, "081804"},  // 07081804
+		{1111111111, "050471"},  // 14050471
+		{1234567890, "005924"},  // 89005924
+		{2000000000, "279037"},  // 69279037
+		{20000000000, "353130"}, // 65353130
+	}
+
+	for _, v := range vectors {
+		got, err := CodeAt(rfcSecret, Counter(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("CodeAt at %d returned %v", v.unix, err)
+		}
+		if got != v.want {
+			t.Errorf("CodeAt at %d = %s, want %s", v.unix, got, v.want)
+		}
+	}
+}
+
+func TestCodeAtAcceptsLowerCaseSecret(t *testing.T) {
+	got, err := CodeAt("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", Counter(time.Unix(59, 0)))
+	if err != nil || got != "287082" {
+		t.Fatalf("CodeAt with a lower-case secret = %s, %v, want 287082", got, err)
+	}
+}
+
+func TestValidateSkewWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Counter(now)
+
+	for delta := int64(-2); delta <= 2; delta++ {
+		code, err := CodeAt(rfcSecret, current+delta)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		counter, ok := Validate(rfcSecret, code, now, 1)
+		wantOK := delta >= -1 && delta <= 1
+		if ok != wantOK {
+			t.Errorf("step %+d: accepted = %v, want %v", delta, ok, wantOK)
+			continue
+		}
+		if ok && counter != current+delta {
+			t.Errorf("step %+d: matched counter %d, want %d", delta, counter, current+delta)
+		}
+	}
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870820", "94287082"} {
+		if _, ok := Validate(rfcSecret, code, now, 1); ok {
+			t.Errorf("Validate(%q) accepted", code)
+		}
+	}
+	if _, ok := Validate(rfcSecret, " 287082 ", now, 0); !ok {
+		t.Error("Validate rejected a code with surrounding spaces")
+	}
+}
@@ -4,18 +4,29 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
+
+	"db_project2/internal/services"
+	"db_project2/internal/services/subservices"
+	"db_project2/pkg/mailer"
+	"db_project2/pkg/oidc"
 
 	"github.com/gin-contrib/cors"
 	"gopkg.in/ini.v1"
 )
 
-func LoadCorsConfig() cors.Config {
+func loadConfigFile() *ini.File {
 	f, _ := os.Getwd()
 	log.Println(f)
 	cfg, err := ini.Load(f + "/server/config.cfg")
 	if err != nil {
 		log.Fatalf("Failed to read config file: %v", err)
 	}
+	return cfg
+}
+
+func LoadCorsConfig() cors.Config {
+	cfg := loadConfigFile()
 
 	corsSection := cfg.Section("cors")
 	allowOrigins := strings.Split(corsSection.Key("allow_origins").String(), ",")
@@ -50,4 +61,237 @@ func LoadCorsConfig() cors.Config {
 		ExposeHeaders:    exposeHeaders,
 		AllowCredentials: allowCredentials,
 	}
-}
\ No newline at end of file
+}
+
+// LoadTrustedProxies returns the proxies allowed to set the client IP
+// through X-Forwarded-For. None are trusted by default.
+func LoadTrustedProxies() []string {
+	cfg := loadConfigFile()
+
+	var proxies []string
+	for _, proxy := range strings.Split(cfg.Section("server").Key("trusted_proxies").String(), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+func LoadServicesConfig() services.Config {
+	return services.Config{
+		Auth:           LoadAuthConfig(),
+		Lockout:        LoadLockoutConfig(),
+		PasswordPolicy: LoadPasswordPolicyConfig(),
+		PasswordReset:  LoadPasswordResetConfig(),
+		TwoFactor:      LoadTwoFactorConfig(),
+		OIDC:           LoadOIDCConfig(),
+		Cards:          LoadCardConfig(),
+		Mailer:         LoadMailer(),
+	}
+}
+
+func parseDurationKey(section *ini.Section, key, defaultValue string) time.Duration {
+	value, err := time.ParseDuration(section.Key(key).MustString(defaultValue))
+	if err != nil {
+		log.Fatalf("Failed to parse %s: %v", key, err)
+	}
+	return value
+}
+
+func LoadAuthConfig() subservices.AuthConfig {
+	cfg := loadConfigFile()
+
+	sessionSection := cfg.Section("session")
+	absoluteTTL, err := time.ParseDuration(sessionSection.Key("absolute_ttl").MustString("12h"))
+	if err != nil {
+		log.Fatalf("Failed to parse absolute_ttl: %v", err)
+	}
+
+	idleTimeout, err := time.ParseDuration(sessionSection.Key("idle_timeout").MustString("30m"))
+	if err != nil {
+		log.Fatalf("Failed to parse idle_timeout: %v", err)
+	}
+
+	authSection := cfg.Section("auth")
+	mode := authSection.Key("mode").In(subservices.AuthModeSession, []string{
+		subservices.AuthModeSession, subservices.AuthModeJWT, subservices.AuthModeBoth,
+	})
+
+	accessTokenTTL, err := time.ParseDuration(authSection.Key("access_token_ttl").MustString("15m"))
+	if err != nil {
+		log.Fatalf("Failed to parse access_token_ttl: %v", err)
+	}
+
+	refreshTokenTTL, err := time.ParseDuration(authSection.Key("refresh_token_ttl").MustString("720h"))
+	if err != nil {
+		log.Fatalf("Failed to parse refresh_token_ttl: %v", err)
+	}
+
+	// The signing secret is read from the environment so it never lands in
+	// the repository alongside config.cfg.
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if mode != subservices.AuthModeSession && len(jwtSecret) < 32 {
+		log.Fatalf("Auth mode %q requires JWT_SECRET of at least 32 characters", mode)
+	}
+
+	return subservices.AuthConfig{
+		Mode:               mode,
+		SessionAbsoluteTTL: absoluteTTL,
+		SessionIdleTimeout: idleTimeout,
+		JWTSecret:          []byte(jwtSecret),
+		JWTIssuer:          authSection.Key("jwt_issuer").MustString("db_project2"),
+		AccessTokenTTL:     accessTokenTTL,
+		RefreshTokenTTL:    refreshTokenTTL,
+	}
+}
+
+func LoadLockoutConfig() subservices.LockoutConfig {
+	cfg := loadConfigFile()
+	lockoutSection := cfg.Section("lockout")
+
+	return subservices.LockoutConfig{
+		MaxFailures:     lockoutSection.Key("max_failures").MustInt(5),
+		IPMaxFailures:   lockoutSection.Key("ip_max_failures").MustInt(50),
+		LockoutDuration: parseDurationKey(lockoutSection, "lockout_duration", "15m"),
+		BackoffBase:     parseDurationKey(lockoutSection, "backoff_base", "1s"),
+		BackoffMax:      parseDurationKey(lockoutSection, "backoff_max", "5m"),
+		FailureWindow:   parseDurationKey(lockoutSection, "failure_window", "1h"),
+	}
+}
+
+func LoadPasswordPolicyConfig() subservices.PasswordPolicyConfig {
+	cfg := loadConfigFile()
+	policySection := cfg.Section("password_policy")
+
+	denyList := map[string]bool{}
+	if denyListFile := policySection.Key("deny_list_file").String(); denyListFile != "" {
+		f, _ := os.Getwd()
+		content, err := os.ReadFile(f + "/" + denyListFile)
+		if err != nil {
+			log.Fatalf("Failed to read password deny list: %v", err)
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			line = strings.ToLower(strings.TrimSpace(line))
+			if line != "" && !strings.HasPrefix(line, "#") {
+				denyList[line] = true
+			}
+		}
+	}
+
+	return subservices.PasswordPolicyConfig{
+		MinLength:     policySection.Key("min_length").MustInt(10),
+		RequireUpper:  policySection.Key("require_upper").MustBool(true),
+		RequireLower:  policySection.Key("require_lower").MustBool(true),
+		RequireDigit:  policySection.Key("require_digit").MustBool(true),
+		RequireSymbol: policySection.Key("require_symbol").MustBool(false),
+		HistorySize:   policySection.Key("history_size").MustInt(5),
+		DenyList:      denyList,
+	}
+}
+
+func LoadPasswordResetConfig() subservices.PasswordResetConfig {
+	cfg := loadConfigFile()
+	resetSection := cfg.Section("password_reset")
+
+	return subservices.PasswordResetConfig{
+		TokenTTL:        parseDurationKey(resetSection, "token_ttl", "30m"),
+		RequestCooldown: parseDurationKey(resetSection, "request_cooldown", "1m"),
+		ResetURL:        resetSection.Key("reset_url").MustString("http://localhost:3000/password/reset"),
+	}
+}
+
+func LoadTwoFactorConfig() subservices.TwoFactorConfig {
+	cfg := loadConfigFile()
+	twoFactorSection := cfg.Section("two_factor")
+
+	return subservices.TwoFactorConfig{
+		Issuer:            twoFactorSection.Key("issuer").MustString("Library"),
+		RequireForAdmin:   twoFactorSection.Key("require_for_admin").MustBool(false),
+		ChallengeTTL:      parseDurationKey(twoFactorSection, "challenge_ttl", "5m"),
+		MaxAttempts:       twoFactorSection.Key("max_attempts").MustInt(5),
+		Skew:              twoFactorSection.Key("skew").MustInt(1),
+		RecoveryCodeCount: twoFactorSection.Key("recovery_codes").MustInt(10),
+	}
+}
+
+func splitConfigList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// LoadOIDCConfig reads the single sign-on settings. OIDC_CLIENT_SECRET is
+// read from the environment; public clients relying on PKCE alone leave it
+// unset.
+func LoadOIDCConfig() subservices.OIDCConfig {
+	cfg := loadConfigFile()
+	oidcSection := cfg.Section("oidc")
+
+	config := subservices.OIDCConfig{
+		Enabled: oidcSection.Key("enabled").MustBool(false),
+		Provider: oidc.Config{
+			Issuer:                oidcSection.Key("issuer").String(),
+			ClientID:              oidcSection.Key("client_id").String(),
+			ClientSecret:          os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:           oidcSection.Key("redirect_url").MustString("http://localhost:3000/oidc/callback"),
+			Scopes:                splitConfigList(oidcSection.Key("scopes").MustString("openid, email, profile")),
+			AuthorizationEndpoint: oidcSection.Key("authorization_endpoint").String(),
+		},
+		StateTTL:             parseDurationKey(oidcSection, "state_ttl", "10m"),
+		EmailClaim:           oidcSection.Key("email_claim").MustString("email"),
+		GroupsClaim:          oidcSection.Key("groups_claim").MustString("groups"),
+		RequireVerifiedEmail: oidcSection.Key("require_verified_email").MustBool(true),
+		RoleGroups: map[string][]string{
+			"Admin":        splitConfigList(oidcSection.Key("admin_groups").String()),
+			"LibraryAgent": splitConfigList(oidcSection.Key("library_agent_groups").String()),
+			"Student":      splitConfigList(oidcSection.Key("student_groups").String()),
+		},
+	}
+
+	if config.Enabled && (config.Provider.Issuer == "" || config.Provider.ClientID == "") {
+		log.Fatalf("OIDC is enabled but issuer or client_id is missing")
+	}
+	return config
+}
+
+func LoadCardConfig() subservices.CardConfig {
+	cfg := loadConfigFile()
+	cardSection := cfg.Section("cards")
+
+	validityMonths := cardSection.Key("validity_months").MustInt(12)
+	if validityMonths < 1 {
+		log.Fatalf("Card validity_months must be at least 1")
+	}
+
+	return subservices.CardConfig{
+		ValidityMonths: validityMonths,
+	}
+}
+
+// LoadMailer picks the mail transport. SMTP_PASSWORD is read from the
+// environment so relay credentials stay out of config.cfg.
+func LoadMailer() mailer.Mailer {
+	cfg := loadConfigFile()
+	mailerSection := cfg.Section("mailer")
+	from := mailerSection.Key("from").MustString("library@localhost")
+
+	switch driver := mailerSection.Key("driver").MustString("log"); driver {
+	case "smtp":
+		return mailer.NewSMTPMailer(
+			mailerSection.Key("smtp_host").MustString("localhost"),
+			mailerSection.Key("smtp_port").MustInt(1025),
+			mailerSection.Key("smtp_username").String(),
+			os.Getenv("SMTP_PASSWORD"),
+			from,
+		)
+	case "log":
+		return mailer.NewLogMailer(mailerSection.Key("log_file").String(), from)
+	default:
+		log.Fatalf("Unknown mailer driver %q", driver)
+		return nil
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"db_project2/internal/services/subservices"
+	"db_project2/pkg/database"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// ImportMARC runs the "import-marc" command: it loads each MARC21 or
+// MARCXML file given on the command line into the catalog and prints the
+// report. The exit code is 1 when a file fails or any record is rejected.
+func ImportMARC(args []string) int {
+	flags := flag.NewFlagSet("import-marc", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the full report as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: db_project2 import-marc [-json] FILE...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	db := database.DatabaseInit()
+	if err := database.RunMigrations(db, "pkg/database/migrations"); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+	catalog := subservices.NewCatalogServiceInstance(db)
+
+	exitCode := 0
+	for _, path := range flags.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Printf("%s: %v", path, err)
+			exitCode = 1
+			continue
+		}
+
+		// The command runs outside any login, so the audit entry has no actor.
+		report, err := catalog.ImportMARC(subservices.Actor{}, file)
+		file.Close()
+		if err != nil {
+			log.Printf("%s: %v", path, err)
+			exitCode = 1
+			// A partial import still reports what was written.
+			if report == nil {
+				continue
+			}
+		}
+		if report.Rejected > 0 {
+			exitCode = 1
+		}
+
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(report)
+			continue
+		}
+
+		fmt.Printf("%s: %d records, %d created, %d updated, %d rejected\n", path, report.Total, report.Created, report.Updated, report.Rejected)
+		for _, record := range report.Records {
+			if record.Status == subservices.MARCRecordRejected {
+				fmt.Printf("  record %d %s: rejected: %s\n", record.Record, record.BookCode, strings.Join(record.Errors, "; "))
+			}
+			for _, warning := range record.Warnings {
+				fmt.Printf("  record %d %s: warning: %s\n", record.Record, record.BookCode, warning)
+			}
+		}
+	}
+	return exitCode
+}
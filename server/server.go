@@ -12,10 +12,16 @@ import (
 
 func Start() {
 	db := database.DatabaseInit()
+	if err := database.RunMigrations(db, "pkg/database/migrations"); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
 
 	router := gin.Default()
+	if err := router.SetTrustedProxies(LoadTrustedProxies()); err != nil {
+		log.Fatalf("Invalid trusted_proxies: %v", err)
+	}
 	router.Use(cors.New(LoadCorsConfig()))
-	services.InitServices(db) 
+	services.InitServices(db, LoadServicesConfig())
 	API.InitAPI(router)
 
 	err := router.Run(":3000")